@@ -3,8 +3,9 @@ module github.com/mattermost/mattermost-plugin-starter-template
 go 1.16
 
 require (
-	github.com/mattermost/mattermost-plugin-api v0.0.19 // indirect
-	github.com/mattermost/mattermost-server/v5 v5.39.1 // indirect
+	github.com/gorilla/mux v1.8.0
+	github.com/mattermost/mattermost-plugin-api v0.0.19
+	github.com/mattermost/mattermost-server/v5 v5.39.1
 	github.com/pkg/errors v0.9.1
 	github.com/stretchr/testify v1.7.0
 )
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/mattermost/mattermost-server/v5/plugin"
+	"github.com/pkg/errors"
+)
+
+const (
+	// audiencePageSize is the number of channel members read at once.
+	audiencePageSize = 200
+
+	// maxListedUnacknowledged bounds the users named by /mbotc acks.
+	maxListedUnacknowledged = 100
+
+	// audienceCacheTTL is how long the audience of a channel is reused for the counts on notice
+	// posts, which are updated on every acknowledgement.
+	audienceCacheTTL = time.Minute
+)
+
+// cachedAudience is the audience of a channel, as listed by listNoticeAudience.
+type cachedAudience struct {
+	userIds  map[string]bool
+	expireAt time.Time
+}
+
+// acknowledgeNoticeAs records that the user read the notice, and returns the message to show to
+// the user. The count of acknowledgements on the notice post is updated.
+func (p *Plugin) acknowledgeNoticeAs(userId string, notice *Notice) (string, error) {
+	added, err := p.store.AcknowledgeNotice(notice.Id, userId)
+	if err != nil {
+		return "", err
+	}
+	if !added {
+		return "You already acknowledged this notice.", nil
+	}
+
+	if notice.PostId != "" {
+		if err := p.updateNoticePost(notice); err != nil {
+			p.API.LogWarn("Failed to update acknowledgements of notice post", "notice_id", notice.Id, "err", err.Error())
+		}
+	}
+	return ":white_check_mark: You acknowledged the notice.", nil
+}
+
+// hasAcknowledged reports whether the user acknowledged the notice.
+func (p *Plugin) hasAcknowledged(noticeId, userId string) (bool, error) {
+	userIds, err := p.store.ListNoticeAcks(noticeId)
+	if err != nil {
+		return false, err
+	}
+	for _, id := range userIds {
+		if id == userId {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// listNoticeAudience returns the users a notice in the channel is for: its active members,
+// without bots.
+func (p *Plugin) listNoticeAudience(channelId string) ([]*model.User, error) {
+	var audience []*model.User
+	for page := 0; ; page++ {
+		users, appErr := p.API.GetUsersInChannel(channelId, "username", page, audiencePageSize)
+		if appErr != nil {
+			return nil, errors.Wrapf(appErr, "failed to get members of channel %s", channelId)
+		}
+		for _, user := range users {
+			if !user.IsBot && user.DeleteAt == 0 {
+				audience = append(audience, user)
+			}
+		}
+		if len(users) < audiencePageSize {
+			return audience, nil
+		}
+	}
+}
+
+// noticeAcknowledgements splits the audience of the notice by whether they acknowledged it.
+// Acknowledgements of users who left the channel are not counted.
+func (p *Plugin) noticeAcknowledgements(notice *Notice) (acknowledged, pending []*model.User, err error) {
+	userIds, err := p.store.ListNoticeAcks(notice.Id)
+	if err != nil {
+		return nil, nil, err
+	}
+	acked := map[string]bool{}
+	for _, userId := range userIds {
+		acked[userId] = true
+	}
+
+	audience, err := p.listNoticeAudience(notice.ChannelId)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, user := range audience {
+		if acked[user.Id] {
+			acknowledged = append(acknowledged, user)
+		} else {
+			pending = append(pending, user)
+		}
+	}
+	return acknowledged, pending, nil
+}
+
+// noticeAudienceIds returns the ids of the audience of the channel, as listNoticeAudience does.
+// The audience is cached for audienceCacheTTL.
+func (p *Plugin) noticeAudienceIds(channelId string) (map[string]bool, error) {
+	p.audienceLock.Lock()
+	defer p.audienceLock.Unlock()
+
+	if cached, ok := p.audiences[channelId]; ok && time.Now().Before(cached.expireAt) {
+		return cached.userIds, nil
+	}
+	audience, err := p.listNoticeAudience(channelId)
+	if err != nil {
+		return nil, err
+	}
+	userIds := map[string]bool{}
+	for _, user := range audience {
+		userIds[user.Id] = true
+	}
+	if p.audiences == nil {
+		p.audiences = map[string]cachedAudience{}
+	}
+	p.audiences[channelId] = cachedAudience{userIds: userIds, expireAt: time.Now().Add(audienceCacheTTL)}
+	return userIds, nil
+}
+
+// acknowledgementField shows on the notice post how many members acknowledged the notice, out
+// of the same audience as /mbotc acks. It is only shown once someone did.
+func (p *Plugin) acknowledgementField(notice Notice) (*model.SlackAttachmentField, error) {
+	userIds, err := p.store.ListNoticeAcks(notice.Id)
+	if err != nil || len(userIds) == 0 {
+		return nil, err
+	}
+
+	audience, err := p.noticeAudienceIds(notice.ChannelId)
+	if err != nil {
+		return nil, err
+	}
+	acknowledged := 0
+	for _, userId := range userIds {
+		if audience[userId] {
+			acknowledged++
+		}
+	}
+	return &model.SlackAttachmentField{
+		Title: ":white_check_mark: Acknowledged",
+		Value: fmt.Sprintf("%d/%d", acknowledged, len(audience)),
+		Short: false,
+	}, nil
+}
+
+// handleAcknowledgeAction handles the "Acknowledge" button of a notice post.
+func (p *Plugin) handleAcknowledgeAction(w http.ResponseWriter, r *http.Request) {
+	userId := r.Header.Get("Mattermost-User-ID")
+	log := p.loggerFromContext(r.Context())
+
+	request := model.PostActionIntegrationRequestFromJson(r.Body)
+	if request == nil {
+		http.Error(w, "Invalid action request", http.StatusBadRequest)
+		return
+	}
+	noticeId, _ := request.Context["notice_id"].(string)
+	log = log.With("notice_id", noticeId, "user_id", userId)
+
+	notice := p.getReadableNotice(noticeId, userId)
+	if notice == nil {
+		writeActionResponse(w, "This notice was cancelled or doesn't exist anymore.")
+		return
+	}
+
+	text, err := p.acknowledgeNoticeAs(userId, notice)
+	if err != nil {
+		log.Error("Failed to acknowledge notice", "err", err.Error())
+		text = "Failed to acknowledge the notice. Please try again later."
+	}
+	writeActionResponse(w, text)
+}
+
+func executeAcks(p *Plugin, c *plugin.Context, header *model.CommandArgs, args ...string) *model.CommandResponse {
+	if len(args) != 1 {
+		p.postCommandResponse(header, "Usage: `/mbotc acks <notice-or-post-id>`")
+		return &model.CommandResponse{}
+	}
+
+	notice, err := p.findNotice(args[0])
+	if err == ErrNoticeNotFound {
+		p.postCommandResponse(header, fmt.Sprintf("Notice %s was not found.", args[0]))
+		return &model.CommandResponse{}
+	}
+	if err != nil {
+		p.API.LogError("Failed to get notice", "user_id", header.UserId, "notice_id", args[0], "err", err.Error())
+		p.postCommandResponse(header, "Failed to get the notice. Please try again later.")
+		return &model.CommandResponse{}
+	}
+	if !p.canManageNotice(header.UserId, notice) {
+		p.postCommandResponse(header, "Only the author or a channel admin can see who acknowledged this notice.")
+		return &model.CommandResponse{}
+	}
+
+	acknowledged, pending, err := p.noticeAcknowledgements(notice)
+	if err != nil {
+		p.API.LogError("Failed to get acknowledgements", "notice_id", notice.Id, "err", err.Error())
+		p.postCommandResponse(header, "Failed to get the acknowledgements. Please try again later.")
+		return &model.CommandResponse{}
+	}
+	p.postCommandResponse(header, formatAcknowledgements(notice, acknowledged, pending))
+	return &model.CommandResponse{}
+}
+
+func formatAcknowledgements(notice *Notice, acknowledged, pending []*model.User) string {
+	text := fmt.Sprintf("#### Acknowledgements of \"%s\"\n%d of %d members acknowledged the notice.\n",
+		previewMessage(notice.Message), len(acknowledged), len(acknowledged)+len(pending))
+	if len(pending) == 0 {
+		return text
+	}
+
+	var names []string
+	for i, user := range pending {
+		if i == maxListedUnacknowledged {
+			names = append(names, fmt.Sprintf("and %d more", len(pending)-i))
+			break
+		}
+		names = append(names, "@"+user.Username)
+	}
+	return text + "**Not acknowledged yet**: " + strings.Join(names, ", ") + "\n"
+}
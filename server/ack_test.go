@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/mattermost/mattermost-server/v5/plugin/plugintest/mock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAcknowledgements(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	api := newKVAPI()
+	api.On("GetUser", "author").Return(&model.User{Id: "author", Username: "author"}, nil)
+	for _, userId := range []string{"author", "alice", "bob"} {
+		api.On("GetChannelMember", "channel1", userId).Return(&model.ChannelMember{}, nil)
+	}
+	api.On("HasPermissionToChannel", "bob", "channel1", model.PERMISSION_MANAGE_CHANNEL_ROLES).Return(false)
+	api.On("GetChannel", "channel1").Return(&model.Channel{Id: "channel1", TeamId: "team1", DisplayName: "Town Square"}, nil)
+	api.On("GetTeam", "team1").Return(&model.Team{Id: "team1", DisplayName: "Team"}, nil)
+	api.On("GetUsersInChannel", "channel1", "username", 0, audiencePageSize).Return([]*model.User{
+		{Id: "alice", Username: "alice"},
+		{Id: "author", Username: "author"},
+		{Id: "bob", Username: "bob"},
+		{Id: "bot", Username: "mbotc", IsBot: true},
+	}, nil)
+	api.On("GetPost", "post1").Return(&model.Post{Id: "post1"}, nil)
+	var updated *model.Post
+	api.On("UpdatePost", mock.Anything).Return(&model.Post{}, nil).Run(func(args mock.Arguments) {
+		updated = args.Get(0).(*model.Post)
+	})
+	var replies []string
+	api.On("SendEphemeralPost", mock.Anything, mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+		replies = append(replies, args.Get(1).(*model.Post).Message)
+	})
+
+	p := &Plugin{botUserID: "bot"}
+	p.SetAPI(api)
+	p.store = NewStore(p)
+	p.router = p.initRouter()
+
+	notice := &Notice{UserId: "author", TeamId: "team1", ChannelId: "channel1", PostId: "post1", Message: "Read the new policy",
+		StartTime: "2021-11-05T09:00:00Z", EndTime: "2021-11-05T09:00:00Z"}
+	require.NoError(p.store.CreateNotice(notice))
+
+	acknowledge := func(userId string) string {
+		request := &model.PostActionIntegrationRequest{PostId: "post1", ChannelId: "channel1", Context: map[string]interface{}{"notice_id": notice.Id}}
+		r := httptest.NewRequest(http.MethodPost, "/actions/acknowledge", bytes.NewReader(request.ToJson()))
+		r.Header.Set("Mattermost-User-ID", userId)
+		w := httptest.NewRecorder()
+		p.ServeHTTP(nil, w, r)
+		response := model.PostActionIntegrationResponseFromJson(w.Body)
+		require.NotNil(response)
+		return response.EphemeralText
+	}
+
+	assert.Contains(acknowledge("alice"), "You acknowledged the notice.")
+	require.NotNil(updated)
+	fields := updated.Attachments()[0].Fields
+	assert.Equal(":white_check_mark: Acknowledged", fields[len(fields)-1].Title)
+	assert.Equal("1/3", fields[len(fields)-1].Value)
+	api.AssertNumberOfCalls(t, "GetUsersInChannel", 1)
+
+	updated = nil
+	assert.Equal("You already acknowledged this notice.", acknowledge("alice"))
+	assert.Nil(updated)
+
+	// The audience is cached between acknowledgements, and acknowledgements of users who are not
+	// in it, such as members who left, are not counted.
+	require.NoError(p.updateNoticePost(notice))
+	fields = updated.Attachments()[0].Fields
+	assert.Equal("1/3", fields[len(fields)-1].Value)
+	_, err := p.store.AcknowledgeNotice(notice.Id, "carol")
+	require.NoError(err)
+	require.NoError(p.updateNoticePost(notice))
+	fields = updated.Attachments()[0].Fields
+	assert.Equal("1/3", fields[len(fields)-1].Value)
+	api.AssertNumberOfCalls(t, "GetUsersInChannel", 1)
+
+	execute := func(userId, command string) string {
+		replies = nil
+		_, appErr := p.ExecuteCommand(nil, &model.CommandArgs{UserId: userId, ChannelId: "channel1", Command: command})
+		require.Nil(appErr)
+		require.Len(replies, 1)
+		return replies[0]
+	}
+	assert.Equal("#### Acknowledgements of \"Read the new policy\"\n1 of 3 members acknowledged the notice.\n"+
+		"**Not acknowledged yet**: @author, @bob\n", execute("author", "/mbotc acks post1"))
+	assert.Contains(execute("bob", "/mbotc acks "+notice.Id), "Only the author or a channel admin")
+	assert.Contains(execute("author", "/mbotc acks missing"), "Notice missing was not found.")
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"runtime/debug"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/mattermost/mattermost-server/v5/plugin"
+)
+
+const requestIdHeader = "X-Request-ID"
+
+// initRouter registers the plugin HTTP routes.
+func (p *Plugin) initRouter() *mux.Router {
+	router := mux.NewRouter()
+	router.Use(p.withRequestLogger, p.withRecovery)
+
+	router.HandleFunc("/fe", p.handleFrontendNotice).Methods(http.MethodPost)
+	router.Handle("/mm", p.withMattermostUser(http.HandlerFunc(p.handleDialog))).Methods(http.MethodPost)
+
+	calendar := router.PathPrefix("/calendar").Subrouter()
+	calendar.HandleFunc("/channel/{id:[A-Za-z0-9]+}.ics", p.handleChannelCalendar).Methods(http.MethodGet)
+	calendar.HandleFunc("/user/{id:[A-Za-z0-9]+}.ics", p.handleUserCalendar).Methods(http.MethodGet)
+
+	actions := router.PathPrefix("/actions").Subrouter()
+	actions.Use(p.withMattermostUser)
+	actions.HandleFunc("/cancel", p.handleCancelAction).Methods(http.MethodPost)
+	actions.HandleFunc("/acknowledge", p.handleAcknowledgeAction).Methods(http.MethodPost)
+	actions.HandleFunc("/rsvp", p.handleRSVPAction).Methods(http.MethodPost)
+	actions.HandleFunc("/import/confirm", p.handleImportConfirmAction).Methods(http.MethodPost)
+	actions.HandleFunc("/import/cancel", p.handleImportCancelAction).Methods(http.MethodPost)
+	actions.HandleFunc("/listing", p.handleListingAction).Methods(http.MethodPost)
+
+	return router
+}
+
+// ServeHTTP handles the requests of the MBotC frontend and of the create dialog.
+func (p *Plugin) ServeHTTP(c *plugin.Context, w http.ResponseWriter, r *http.Request) {
+	p.router.ServeHTTP(w, r)
+}
+
+// withRequestLogger stores a logger tagged with the request in the request context.
+func (p *Plugin) withRequestLogger(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestId := r.Header.Get(requestIdHeader)
+		if requestId == "" {
+			requestId = model.NewId()
+		}
+
+		l := newLogger(p.API, "request_id", requestId, "method", r.Method, "path", r.URL.Path)
+		if userId := r.Header.Get("Mattermost-User-ID"); userId != "" {
+			l = l.With("user_id", userId)
+		}
+
+		next.ServeHTTP(w, r.WithContext(contextWithLogger(r.Context(), l)))
+	})
+}
+
+// withRecovery turns a panic in a handler into an internal server error, so that a single bad
+// request cannot crash the plugin process.
+func (p *Plugin) withRecovery(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			if x := recover(); x != nil {
+				p.loggerFromContext(r.Context()).Error("Recovered from a panic", "panic", x, "stack", string(debug.Stack()))
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			}
+		}()
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// withMattermostUser rejects requests that don't come from a logged in Mattermost user.
+func (p *Plugin) withMattermostUser(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Mattermost-User-ID") == "" {
+			http.Error(w, "Not authorized", http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// handleFrontendNotice creates a notice posted by the MBotC frontend. The caller must be the
+// author of the notice, or the frontend signing on their behalf, and be allowed to post in the
+// notice channel.
+func (p *Plugin) handleFrontendNotice(w http.ResponseWriter, r *http.Request) {
+	log := p.loggerFromContext(r.Context())
+
+	callerId, signed, err := p.authenticateFrontendRequest(r)
+	if err != nil {
+		log.Warn("Rejected unauthenticated notice", "err", err.Error())
+		http.Error(w, "Not authorized", http.StatusUnauthorized)
+		return
+	}
+
+	notice, err := ConvertRequest(p, r)
+	log = log.With("author_id", notice.UserId, "channel_id", notice.ChannelId)
+	if errs, ok := asValidationErrors(err); ok {
+		log.Debug("Rejected invalid notice", "err", errs.Error())
+		writeValidationErrors(w, errs)
+		return
+	}
+	if err != nil {
+		log.Warn("Failed to read notice", "err", err.Error())
+		http.Error(w, "Invalid notice", http.StatusBadRequest)
+		return
+	}
+
+	if !signed {
+		if notice.UserId == "" {
+			notice.UserId = callerId
+		}
+		if notice.UserId != callerId {
+			log.Warn("Rejected notice on behalf of another user")
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+	}
+	errs := p.validateNotice(&notice, noticeValidation{
+		Now:   time.Now(),
+		Files: requestFiles(r),
+	})
+	if errs != nil {
+		if errs.Has(ValidationForbidden) {
+			log.Warn("Rejected unauthorized notice", "err", errs.Error())
+		} else {
+			log.Debug("Rejected invalid notice", "err", errs.Error())
+		}
+		writeValidationErrors(w, errs)
+		return
+	}
+
+	if err := UploadRequestFiles(p, r, &notice); err != nil {
+		log.Error("Failed to upload notice files", "err", err.Error())
+		http.Error(w, "Failed to upload files", http.StatusInternalServerError)
+		return
+	}
+
+	if err := p.publishNotice(&notice); err != nil {
+		log.Error("Failed to publish notice", "err", err.Error())
+		http.Error(w, "Failed to create notice", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+}
+
+// frontendFieldNames maps the fields of validation errors to the form fields of the MBotC
+// frontend where they differ.
+var frontendFieldNames = map[string]string{"content": "message", "files": "file"}
+
+// validationErrorResponse is the body of a rejected notice of the MBotC frontend.
+type validationErrorResponse struct {
+	Error  string           `json:"error"`
+	Errors ValidationErrors `json:"errors"`
+}
+
+// writeValidationErrors answers a notice of the MBotC frontend with 403 Forbidden when the author
+// can't post in the channel, and 400 Bad Request otherwise, and the errors.
+func writeValidationErrors(w http.ResponseWriter, errs ValidationErrors) {
+	response := validationErrorResponse{Error: "Invalid notice"}
+	for _, err := range errs {
+		if name, ok := frontendFieldNames[err.Field]; ok {
+			err.Field = name
+		}
+		response.Errors = append(response.Errors, err)
+	}
+	statusCode := http.StatusBadRequest
+	if errs.Has(ValidationForbidden) {
+		response.Error = "Forbidden"
+		statusCode = http.StatusForbidden
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	_ = json.NewEncoder(w).Encode(response)
+}
+
+// handleCancelAction handles the "Cancel notice" button of a notice post.
+func (p *Plugin) handleCancelAction(w http.ResponseWriter, r *http.Request) {
+	userId := r.Header.Get("Mattermost-User-ID")
+	log := p.loggerFromContext(r.Context())
+
+	request := model.PostActionIntegrationRequestFromJson(r.Body)
+	if request == nil {
+		http.Error(w, "Invalid action request", http.StatusBadRequest)
+		return
+	}
+	noticeId, _ := request.Context["notice_id"].(string)
+	log = log.With("notice_id", noticeId)
+
+	notice, err := p.store.GetNotice(noticeId)
+	if err != nil {
+		log.Warn("Failed to get notice of cancel action", "err", err.Error())
+		writeActionResponse(w, "Oops! This notice doesn't exist anymore.")
+		return
+	}
+
+	writeActionResponse(w, p.cancelNoticeAs(userId, notice))
+}
+
+// writeActionResponse answers a post action with an ephemeral message to the user.
+func writeActionResponse(w http.ResponseWriter, text string) {
+	response := &model.PostActionIntegrationResponse{EphemeralText: text}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(response.ToJson())
+}
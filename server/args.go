@@ -0,0 +1,116 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/pkg/errors"
+)
+
+// splitCommandArgs splits a slash command into arguments like a shell does: arguments are
+// separated by spaces, unless quoted with "double" or 'single' quotes, and a backslash escapes
+// the next character. The curly quotes of mobile keyboards work like straight ones. A single
+// quote right after a letter or a digit is an apostrophe, as in "don't", not a quote.
+func splitCommandArgs(command string) ([]string, error) {
+	var args []string
+	var current strings.Builder
+	inArg := false
+	var quote, prev rune
+	escaped := false
+
+	for _, c := range command {
+		apostrophe := unicode.IsLetter(prev) || unicode.IsDigit(prev)
+		prev = c
+		switch {
+		case escaped:
+			current.WriteRune(c)
+			escaped = false
+		case c == '\\' && quote != '\'':
+			escaped = true
+			inArg = true
+		case quote != 0:
+			if closesQuote(quote, c) {
+				quote = 0
+			} else {
+				current.WriteRune(c)
+			}
+		case c == '"' || c == '“' || (c == '\'' || c == '‘') && !apostrophe:
+			quote = c
+			inArg = true
+		case unicode.IsSpace(c):
+			if inArg {
+				args = append(args, current.String())
+				current.Reset()
+				inArg = false
+			}
+		default:
+			current.WriteRune(c)
+			inArg = true
+		}
+	}
+
+	if quote != 0 {
+		return nil, errors.New("unterminated quote")
+	}
+	if escaped {
+		current.WriteRune('\\')
+	}
+	if inArg {
+		args = append(args, current.String())
+	}
+	return args, nil
+}
+
+func closesQuote(quote, c rune) bool {
+	switch quote {
+	case '“':
+		return c == '”' || c == '"'
+	case '‘':
+		return c == '’' || c == '\''
+	default:
+		return c == quote
+	}
+}
+
+// parseCommandFlags separates "--name value" and "--name=value" flags from the positional
+// arguments. Only the flags in names are accepted.
+func parseCommandFlags(args []string, names ...string) (flags map[string]string, positional []string, err error) {
+	known := map[string]bool{}
+	for _, name := range names {
+		known[name] = true
+	}
+
+	flags = map[string]string{}
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if !strings.HasPrefix(arg, "--") || arg == "--" {
+			if arg == "--" {
+				// Everything after "--" is positional, even if it starts with "--".
+				return flags, append(positional, args[i+1:]...), nil
+			}
+			positional = append(positional, arg)
+			continue
+		}
+
+		name, value := strings.TrimPrefix(arg, "--"), ""
+		hasValue := false
+		if eq := strings.Index(name, "="); eq >= 0 {
+			name, value, hasValue = name[:eq], name[eq+1:], true
+		}
+		if !known[name] {
+			return nil, nil, errors.Errorf("unknown option --%s", name)
+		}
+		if !hasValue {
+			if i+1 >= len(args) {
+				return nil, nil, errors.Errorf("option --%s needs a value", name)
+			}
+			i++
+			value = args[i]
+		}
+		if _, ok := flags[name]; ok {
+			return nil, nil, errors.Errorf("option --%s is given twice", name)
+		}
+		flags[name] = value
+	}
+	return flags, positional, nil
+}
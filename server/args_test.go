@@ -0,0 +1,50 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitCommandArgs(t *testing.T) {
+	for command, expected := range map[string][]string{
+		`/mbotc today`:       {"/mbotc", "today"},
+		`  /mbotc   today  `: {"/mbotc", "today"},
+		`/mbotc create --start "tomorrow 9am" "Team lunch"`: {"/mbotc", "create", "--start", "tomorrow 9am", "Team lunch"},
+		`--start='내일 오후 3시'`:                                {"--start=내일 오후 3시"},
+		`“smart quotes” ‘work too’`:                         {"smart quotes", "work too"},
+		`"say \"hi\"" it\'s`:                                {`say "hi"`, "it's"},
+		`'no \escape'`:                                      {`no \escape`},
+		`""`:                                                {""},
+		`a"b c"d`:                                           {"ab cd"},
+		`/mbotc create --start tomorrow Don't forget`: {"/mbotc", "create", "--start", "tomorrow", "Don't", "forget"},
+		`rock'n'roll 'it’s' l‘été`:                    {"rock'n'roll", "it’s", "l‘été"},
+	} {
+		args, err := splitCommandArgs(command)
+		require.NoError(t, err, command)
+		assert.Equal(t, expected, args, command)
+	}
+
+	for _, command := range []string{`/mbotc create "unterminated`, `'half`, `“curly`} {
+		_, err := splitCommandArgs(command)
+		assert.Error(t, err, command)
+	}
+}
+
+func TestParseCommandFlags(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	flags, positional, err := parseCommandFlags([]string{"--start", "tomorrow", "hello", "--remind=1h", "world", "--", "--end"}, "start", "end", "remind")
+	require.NoError(err)
+	assert.Equal(map[string]string{"start": "tomorrow", "remind": "1h"}, flags)
+	assert.Equal([]string{"hello", "world", "--end"}, positional)
+
+	_, _, err = parseCommandFlags([]string{"--color", "red"}, "start")
+	assert.Error(err)
+	_, _, err = parseCommandFlags([]string{"--start"}, "start")
+	assert.Error(err)
+	_, _, err = parseCommandFlags([]string{"--start", "a", "--start", "b"}, "start")
+	assert.Error(err)
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/pkg/errors"
+)
+
+const (
+	// signatureHeader carries "sha256=" followed by the hex encoded HMAC-SHA256 of the
+	// timestamp, a dot and the request body, keyed with the frontend signing secret.
+	signatureHeader = "X-MBotC-Signature"
+	timestampHeader = "X-MBotC-Timestamp"
+
+	// maxSignatureAge bounds the clock skew accepted for signed requests, limiting replays.
+	maxSignatureAge = 5 * time.Minute
+
+	// maxSignedBodySize bounds the body read into memory to verify a signature.
+	maxSignedBodySize = 40 << 20
+)
+
+var (
+	ErrUnauthenticated = errors.New("request is not authenticated")
+	ErrForbidden       = errors.New("request is not allowed")
+)
+
+// authenticateFrontendRequest identifies the caller of /fe. Requests of logged in users carry
+// the Mattermost-User-ID header, set by the server. Requests of the MBotC frontend are signed
+// with the shared secret instead, and act on behalf of the user_id they post, so signed is
+// true and userId is empty.
+func (p *Plugin) authenticateFrontendRequest(r *http.Request) (userId string, signed bool, err error) {
+	if userId = r.Header.Get("Mattermost-User-ID"); userId != "" {
+		return userId, false, nil
+	}
+
+	if r.Header.Get(signatureHeader) == "" {
+		return "", false, ErrUnauthenticated
+	}
+	if err := verifyRequestSignature(r, p.getConfiguration().FrontendSigningSecret, time.Now()); err != nil {
+		return "", false, errors.Wrap(ErrUnauthenticated, err.Error())
+	}
+	return "", true, nil
+}
+
+// verifyRequestSignature checks the signature headers of r against its body. The body is
+// restored, so that it can be read again by the handler.
+func verifyRequestSignature(r *http.Request, secret string, now time.Time) error {
+	if secret == "" {
+		return errors.New("signed requests are disabled")
+	}
+
+	timestamp := r.Header.Get(timestampHeader)
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return errors.Errorf("invalid %s header", timestampHeader)
+	}
+	age := now.Sub(time.Unix(seconds, 0))
+	if age > maxSignatureAge || age < -maxSignatureAge {
+		return errors.New("signature expired")
+	}
+
+	body, err := ioutil.ReadAll(http.MaxBytesReader(nil, r.Body, maxSignedBodySize))
+	if err != nil {
+		return errors.Wrap(err, "failed to read request body")
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	if !hmac.Equal([]byte(r.Header.Get(signatureHeader)), []byte(signRequest(secret, timestamp, body))) {
+		return errors.New("invalid signature")
+	}
+	return nil
+}
+
+// signRequest computes the signature header value of a request body.
+func signRequest(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// authorizeNoticeAuthor checks that the user may post a notice in the channel.
+func (p *Plugin) authorizeNoticeAuthor(userId, channelId string) error {
+	if userId == "" || channelId == "" {
+		return errors.Wrap(ErrForbidden, "missing user or channel")
+	}
+	if _, appErr := p.API.GetChannelMember(channelId, userId); appErr != nil {
+		return errors.Wrapf(ErrForbidden, "user %s is not a member of channel %s", userId, channelId)
+	}
+	if !p.API.HasPermissionToChannel(userId, channelId, model.PERMISSION_CREATE_POST) {
+		return errors.Wrapf(ErrForbidden, "user %s cannot post in channel %s", userId, channelId)
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/mattermost/mattermost-server/v5/plugin/plugintest/mock"
+	"github.com/stretchr/testify/assert"
+)
+
+func newNoticeForm(userId, channelId string) (body, contentType string) {
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+	_ = writer.WriteField("user_id", userId)
+	_ = writer.WriteField("channel_id", channelId)
+	_ = writer.WriteField("message", "hello")
+	_ = writer.WriteField("start_time", "2021-11-05 09:00")
+	_ = writer.Close()
+	return buf.String(), writer.FormDataContentType()
+}
+
+func newNoticeRequest(callerId, userId, channelId string) *http.Request {
+	body, contentType := newNoticeForm(userId, channelId)
+	r := httptest.NewRequest(http.MethodPost, "/fe", strings.NewReader(body))
+	r.Header.Set("Content-Type", contentType)
+	r.Header.Set("Mattermost-User-ID", callerId)
+	return r
+}
+
+func newSignedRequest(secret string, at time.Time, body string) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/fe", strings.NewReader(body))
+	timestamp := strconv.FormatInt(at.Unix(), 10)
+	r.Header.Set(timestampHeader, timestamp)
+	r.Header.Set(signatureHeader, signRequest(secret, timestamp, []byte(body)))
+	return r
+}
+
+func TestVerifyRequestSignature(t *testing.T) {
+	assert := assert.New(t)
+	now := time.Now()
+
+	r := newSignedRequest("secret", now, "payload")
+	assert.NoError(verifyRequestSignature(r, "secret", now))
+	body, err := ioutil.ReadAll(r.Body)
+	assert.NoError(err)
+	assert.Equal("payload", string(body), "the body must be readable by the handler")
+
+	assert.Error(verifyRequestSignature(newSignedRequest("secret", now, "payload"), "", now))
+	assert.Error(verifyRequestSignature(newSignedRequest("other", now, "payload"), "secret", now))
+	assert.Error(verifyRequestSignature(newSignedRequest("secret", now.Add(-time.Hour), "payload"), "secret", now))
+
+	r = newSignedRequest("secret", now, "payload")
+	r.Body = ioutil.NopCloser(strings.NewReader("tampered"))
+	assert.Error(verifyRequestSignature(r, "secret", now))
+}
+
+func TestHandleFrontendNoticeAuthorization(t *testing.T) {
+	api := newKVAPI()
+	api.On("GetChannelMember", "channel1", "user1").Return(&model.ChannelMember{}, nil)
+	api.On("HasPermissionToChannel", "user1", "channel1", model.PERMISSION_CREATE_POST).Return(false)
+	api.On("GetChannelMember", mock.Anything, mock.Anything).Return(nil, &model.AppError{Message: "not found"})
+
+	p := &Plugin{}
+	p.SetAPI(api)
+	p.setConfiguration(&configuration{FrontendSigningSecret: "secret"})
+	p.router = p.initRouter()
+
+	newSignedNoticeRequest := func(secret, userId, channelId string) *http.Request {
+		body, contentType := newNoticeForm(userId, channelId)
+		r := newSignedRequest(secret, time.Now(), body)
+		r.Header.Set("Content-Type", contentType)
+		return r
+	}
+
+	for name, tc := range map[string]struct {
+		request    *http.Request
+		statusCode int
+	}{
+		"anonymous":         {newNoticeRequest("", "user1", "channel1"), http.StatusUnauthorized},
+		"bad signature":     {newSignedNoticeRequest("other", "user1", "channel1"), http.StatusUnauthorized},
+		"another author":    {newNoticeRequest("user1", "user2", "channel1"), http.StatusForbidden},
+		"not a member":      {newNoticeRequest("user1", "user1", "channel2"), http.StatusForbidden},
+		"cannot post":       {newNoticeRequest("user1", "user1", "channel1"), http.StatusForbidden},
+		"signed non-member": {newSignedNoticeRequest("secret", "user1", "channel2"), http.StatusForbidden},
+	} {
+		t.Run(name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+
+			p.ServeHTTP(nil, w, tc.request)
+
+			assert.Equal(t, tc.statusCode, w.Result().StatusCode)
+		})
+	}
+}
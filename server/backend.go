@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	backendNotificationPath = "/api/v1/notification"
+	backendDateLayout       = "2006-01-02"
+
+	// maxBackendErrorBody bounds how much of an error response is read.
+	maxBackendErrorBody = 64 * 1024
+)
+
+var (
+	ErrBackendBadRequest   = errors.New("backend rejected the request")
+	ErrBackendUnauthorized = errors.New("backend rejected the credentials")
+	ErrBackendNotFound     = errors.New("backend resource not found")
+	ErrBackendUnavailable  = errors.New("backend is unavailable")
+)
+
+// BackendError is returned when the MBotC backend answers with a non-2xx status code.
+// It unwraps to one of the ErrBackend* errors, so callers can use errors.Is.
+type BackendError struct {
+	StatusCode int    `json:"-"`
+	Code       string `json:"code"`
+	Message    string `json:"message"`
+}
+
+func (e *BackendError) Error() string {
+	if e.Code != "" {
+		return fmt.Sprintf("backend returned %d (%s): %s", e.StatusCode, e.Code, e.Message)
+	}
+	return fmt.Sprintf("backend returned %d: %s", e.StatusCode, e.Message)
+}
+
+func (e *BackendError) Unwrap() error {
+	switch {
+	case e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden:
+		return ErrBackendUnauthorized
+	case e.StatusCode == http.StatusNotFound:
+		return ErrBackendNotFound
+	case e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= 500:
+		return ErrBackendUnavailable
+	default:
+		return ErrBackendBadRequest
+	}
+}
+
+type DailyNotice struct {
+	ChannelName string `json:"channel_name"`
+	EndTime     string `json:"end_time"`
+	Message     string `json:"message"`
+	StartTime   string `json:"start_time"`
+	TeamName    string `json:"team_name"`
+	UserName    string `json:"user_name"`
+}
+
+// BackendClient is the MBotC backend API used by the plugin. Backend notices are keyed by the
+// id of the Mattermost post that announced them.
+type BackendClient interface {
+	CreateNotice(ctx context.Context, notice *Notice) error
+	UpdateNotice(ctx context.Context, notice *Notice) error
+	DeleteNotice(ctx context.Context, notice *Notice) error
+	// ListToday returns today's notices visible to the given user.
+	ListToday(ctx context.Context, userId string) ([]DailyNotice, error)
+	// ListRange returns the notices visible to the given user between two days, inclusive.
+	ListRange(ctx context.Context, userId string, from, to time.Time) ([]DailyNotice, error)
+}
+
+type backendClient struct {
+	plugin     *Plugin
+	httpClient *http.Client
+}
+
+// NewBackendClient returns a BackendClient using the backend settings of the plugin
+// configuration at the time of each request.
+func NewBackendClient(p *Plugin) BackendClient {
+	return &backendClient{plugin: p, httpClient: &http.Client{}}
+}
+
+func (c *backendClient) CreateNotice(ctx context.Context, notice *Notice) error {
+	return c.do(ctx, http.MethodPost, backendNotificationPath, "", notice, nil)
+}
+
+func (c *backendClient) UpdateNotice(ctx context.Context, notice *Notice) error {
+	return c.do(ctx, http.MethodPut, backendNotificationPath+"/"+url.PathEscape(notice.PostId), "", notice, nil)
+}
+
+func (c *backendClient) DeleteNotice(ctx context.Context, notice *Notice) error {
+	return c.do(ctx, http.MethodDelete, backendNotificationPath+"/"+url.PathEscape(notice.PostId), "", nil, nil)
+}
+
+func (c *backendClient) ListToday(ctx context.Context, userId string) ([]DailyNotice, error) {
+	var notices []DailyNotice
+	if err := c.do(ctx, http.MethodGet, backendNotificationPath+"/today", userId, nil, &notices); err != nil {
+		return nil, err
+	}
+	return notices, nil
+}
+
+func (c *backendClient) ListRange(ctx context.Context, userId string, from, to time.Time) ([]DailyNotice, error) {
+	query := url.Values{}
+	query.Set("from", from.Format(backendDateLayout))
+	query.Set("to", to.Format(backendDateLayout))
+
+	var notices []DailyNotice
+	if err := c.do(ctx, http.MethodGet, backendNotificationPath+"?"+query.Encode(), userId, nil, &notices); err != nil {
+		return nil, err
+	}
+	return notices, nil
+}
+
+// do sends a request to the backend, encoding in as the JSON body and decoding the response
+// into out when they are not nil.
+func (c *backendClient) do(ctx context.Context, method, path, userId string, in, out interface{}) error {
+	config := c.plugin.getConfiguration()
+	siteURL := ""
+	if c.plugin.API != nil {
+		if mmConfig := c.plugin.API.GetConfig(); mmConfig != nil && mmConfig.ServiceSettings.SiteURL != nil {
+			siteURL = *mmConfig.ServiceSettings.SiteURL
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, config.backendTimeout())
+	defer cancel()
+
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return errors.Wrap(err, "failed to encode backend request")
+		}
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, config.backendURL(siteURL, path), body)
+	if err != nil {
+		return errors.Wrap(err, "failed to create backend request")
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+	if config.BackendAPIToken != "" {
+		req.Header.Set("Authorization", "Bearer "+config.BackendAPIToken)
+	}
+	if userId != "" {
+		req.Header.Set("userId", userId)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return errors.Wrapf(ErrBackendUnavailable, "%s %s: %s", method, path, err.Error())
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return decodeBackendError(resp)
+	}
+
+	if out == nil {
+		_, _ = io.Copy(ioutil.Discard, resp.Body)
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return errors.Wrap(err, "failed to decode backend response")
+	}
+	return nil
+}
+
+// decodeBackendError reads a backend error response. JSON bodies of the form
+// {"code": "...", "message": "..."} are decoded, anything else is kept as the message.
+func decodeBackendError(resp *http.Response) error {
+	backendErr := &BackendError{StatusCode: resp.StatusCode}
+
+	data, _ := ioutil.ReadAll(io.LimitReader(resp.Body, maxBackendErrorBody))
+	if err := json.Unmarshal(data, backendErr); err != nil || backendErr.Message == "" {
+		backendErr.Message = strings.TrimSpace(string(data))
+	}
+	if backendErr.Message == "" {
+		backendErr.Message = http.StatusText(resp.StatusCode)
+	}
+	return backendErr
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/mattermost/mattermost-server/v5/plugin/plugintest"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestBackendClient(t *testing.T, handler http.HandlerFunc) BackendClient {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	api := &plugintest.API{}
+	api.On("GetConfig").Return(&model.Config{ServiceSettings: model.ServiceSettings{SiteURL: model.NewString("http://mm.example.com")}})
+
+	p := &Plugin{}
+	p.SetAPI(api)
+	p.setConfiguration(&configuration{BackendURL: server.URL, BackendAPIToken: "secret", BackendTimeoutSeconds: 1})
+	return NewBackendClient(p)
+}
+
+func TestBackendClientCreateNotice(t *testing.T) {
+	assert := assert.New(t)
+	client := newTestBackendClient(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(http.MethodPost, r.Method)
+		assert.Equal("/api/v1/notification", r.URL.Path)
+		assert.Equal("Bearer secret", r.Header.Get("Authorization"))
+
+		var notice Notice
+		assert.NoError(json.NewDecoder(r.Body).Decode(&notice))
+		assert.Equal("post1", notice.PostId)
+		w.WriteHeader(http.StatusCreated)
+	})
+
+	assert.NoError(client.CreateNotice(context.Background(), &Notice{PostId: "post1"}))
+}
+
+func TestBackendClientListRange(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	client := newTestBackendClient(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal("2021-11-01", r.URL.Query().Get("from"))
+		assert.Equal("2021-11-07", r.URL.Query().Get("to"))
+		assert.Equal("user1", r.Header.Get("userId"))
+		_, _ = w.Write([]byte(`[{"message": "hello", "end_time": "2021-11-05 09:00"}]`))
+	})
+
+	from := time.Date(2021, 11, 1, 0, 0, 0, 0, time.UTC)
+	notices, err := client.ListRange(context.Background(), "user1", from, from.AddDate(0, 0, 6))
+	require.NoError(err)
+	require.Len(notices, 1)
+	assert.Equal("hello", notices[0].Message)
+}
+
+func TestBackendClientErrors(t *testing.T) {
+	assert := assert.New(t)
+
+	client := newTestBackendClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"code": "notice.not_found", "message": "no such notice"}`))
+	})
+	err := client.DeleteNotice(context.Background(), &Notice{PostId: "post1"})
+	var backendErr *BackendError
+	assert.True(errors.As(err, &backendErr))
+	assert.Equal("notice.not_found", backendErr.Code)
+	assert.True(errors.Is(err, ErrBackendNotFound))
+
+	client = newTestBackendClient(t, func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "maintenance", http.StatusServiceUnavailable)
+	})
+	_, err = client.ListToday(context.Background(), "user1")
+	assert.True(errors.Is(err, ErrBackendUnavailable))
+	assert.Contains(err.Error(), "maintenance")
+
+	client = newTestBackendClient(t, func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	})
+	_, err = client.ListToday(context.Background(), "user1")
+	assert.True(errors.Is(err, ErrBackendUnavailable))
+}
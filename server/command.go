@@ -1,10 +1,8 @@
 package main
 
 import (
-	"encoding/json"
 	"fmt"
-	"io/ioutil"
-	"net/http"
+	"runtime/debug"
 	"strings"
 	"time"
 
@@ -32,18 +30,25 @@ func (p *Plugin) getCommand() (*model.Command, error) {
 	}, nil
 }
 
-type DailyNotice struct {
-	ChannelName string `json:"channel_name"`
-	EndTime     string `json:"end_time"`
-	Message     string `json:"message"`
-	StartTime   string `json:"start_time"`
-	TeamName    string `json:"team_name"`
-	UserName    string `json:"user_name"`
-}
-
 const helpText = "###### Mattermost MBotC Plugin - Slash Command Help\n" +
 	"* `/mbotc help` - help text\n" +
 	"* `/mbotc create` - Create your Notice\n" +
+	"* `/mbotc create --start \"tomorrow 9am\" [--end <date>] [--channel ~channel] [--remind 1h] [--repeat weekly] [--skip <dates>] [--priority high] \"content\"` - Create a Notice without the dialog\n" +
+	"* `/mbotc today [--scope channel|team|all]` - Show today's notices, by default in all your channels\n" +
+	"* `/mbotc week [--scope channel|team|all]` - Show the notices of the next 7 days, by default in all your channels\n" +
+	"* `/mbotc month [--scope channel|team|all]` - Show the notices of the next month\n" +
+	"* `/mbotc range <from> <to> [--scope channel|team|all]` - Show the notices between two days, e.g. `2021-11-01 2021-11-30`\n" +
+	"* `/mbotc edit <id>` - Edit your Notice, by notice or post id\n" +
+	"* `/mbotc delete <id>` - Cancel a Notice, by notice or post id\n" +
+	"* `/mbotc acks <id>` - Show who hasn't acknowledged your Notice yet, by notice or post id\n" +
+	"* `/mbotc attendees [export] <id>` - Show who is going to your event Notice, or get the list as a CSV file\n" +
+	"* `/mbotc import [file-id]` - Import notices from an .ics file, by default the latest one posted in the channel\n" +
+	"* `/mbotc feed [reset|revoke]` - Get, replace or turn off your private calendar feed links\n" +
+	"* `/mbotc digest [on [--at 08:30] [--timezone Asia/Seoul] | off]` - Post the notices of the day in this channel every working day\n" +
+	"* `/mbotc digest me [on [--at 08:30] | off]` - Get a direct message with your notices of the day from all your channels every working day\n" +
+	"* `/mbotc outbox` - Show backend deliveries that are pending or failed (system admins only)\n" +
+	"* `/mbotc outbox retry <id|all>` - Deliver failed outbox items again (system admins only)\n" +
+	"* `/mbotc outbox discard <id>` - Remove an item from the outbox (system admins only)\n" +
 	" File Upload is not supported\n" +
 	" If you want to upload file, please visit [here](https://www.mbotc.com)\n"
 
@@ -63,6 +68,33 @@ var mbotcCommandHandler = CommandHandler{
 		"help":   executeHelp,
 		"create": executeCreate,
 		"today":  executeToday,
+		"week":   executeWeek,
+		"month":  executeMonth,
+		"range":  executeRange,
+		"edit":   executeEdit,
+		"delete": executeDelete,
+		"acks":   executeAcks,
+
+		"attendees":        executeAttendees,
+		"attendees/export": executeAttendeesExport,
+
+		"import": executeImport,
+
+		"feed":        executeFeed,
+		"feed/reset":  executeFeedReset,
+		"feed/revoke": executeFeedRevoke,
+
+		"digest":     executeDigest,
+		"digest/on":  executeDigestOn,
+		"digest/off": executeDigestOff,
+
+		"digest/me":     executeUserDigest,
+		"digest/me/on":  executeUserDigestOn,
+		"digest/me/off": executeUserDigestOff,
+
+		"outbox":         executeOutbox,
+		"outbox/retry":   executeOutboxRetry,
+		"outbox/discard": executeOutboxDiscard,
 	},
 	defaultHandler: executeHelp,
 }
@@ -86,83 +118,270 @@ func (p *Plugin) help(header *model.CommandArgs) *model.CommandResponse {
 	return &model.CommandResponse{}
 }
 
+const createUsage = "Usage: `/mbotc create --start \"<date>\" [--end \"<date>\"] [--channel ~channel] [--remind 1d,1h] [--repeat weekly] [--skip \"<dates>\"] [--priority low|normal|high|urgent] \"<content>\"`, " +
+	"or `/mbotc create` to fill in a dialog."
+
+// createFlags are the options of /mbotc create, named after the create dialog fields.
+var createFlags = []string{"start", "end", "channel", "remind", "repeat", "skip", "priority"}
+
 func executeCreate(p *Plugin, c *plugin.Context, header *model.CommandArgs, args ...string) *model.CommandResponse {
-	p.openCreateDialog(header)
+	if len(args) == 0 {
+		p.openCreateDialog(header)
+		return &model.CommandResponse{}
+	}
+
+	flags, content, err := parseCommandFlags(args, createFlags...)
+	if err != nil {
+		p.postCommandResponse(header, fmt.Sprintf("%s.\n%s", err.Error(), createUsage))
+		return &model.CommandResponse{}
+	}
+	if flags["start"] == "" || len(content) == 0 {
+		p.postCommandResponse(header, createUsage)
+		return &model.CommandResponse{}
+	}
+
+	notice := Notice{
+		UserId:    header.UserId,
+		TeamId:    header.TeamId,
+		ChannelId: header.ChannelId,
+		Message:   strings.Join(content, " "),
+		StartTime: flags["start"],
+		EndTime:   flags["end"],
+		Reminders: strings.TrimSpace(flags["remind"]),
+		Priority:  normalizePriority(flags["priority"]),
+	}
+	if notice.EndTime == "" {
+		notice.EndTime = notice.StartTime
+	}
+	if name := flags["channel"]; name != "" {
+		channel, appErr := p.API.GetChannelByName(header.TeamId, strings.TrimPrefix(name, "~"), false)
+		if appErr != nil {
+			p.postCommandResponse(header, fmt.Sprintf("Channel %s was not found.", name))
+			return &model.CommandResponse{}
+		}
+		notice.TeamId = channel.TeamId
+		notice.ChannelId = channel.Id
+	}
+	if notice.Recurrence, err = parseRecurrenceFields(flags["repeat"], flags["skip"]); err != nil {
+		p.postCommandResponse(header, formatCreateErrors(err))
+		return &model.CommandResponse{}
+	}
+	entered := notice
+	if errs := p.validateNotice(&notice, noticeValidation{Now: time.Now()}); errs != nil {
+		p.postCommandResponse(header, formatCreateErrors(errs))
+		return &model.CommandResponse{}
+	}
+	p.echoResolvedTimes(header.UserId, header.ChannelId, entered, notice)
+
+	if err = p.publishNotice(&notice); err != nil {
+		p.API.LogError("Failed to publish notice", "user_id", header.UserId, "channel_id", notice.ChannelId, "err", err.Error())
+		p.postCommandResponse(header, "Failed to create the notice. Please try again later.")
+		return &model.CommandResponse{}
+	}
+	if notice.ChannelId != header.ChannelId {
+		p.postCommandResponse(header, fmt.Sprintf("The notice was posted in %s.", flags["channel"]))
+	}
 	return &model.CommandResponse{}
 }
 
-func executeToday(p *Plugin, c *plugin.Context, header *model.CommandArgs, args ...string) *model.CommandResponse {
-	getNoticeList(p, header)
-	return &model.CommandResponse{}
+// createFlagNames maps the fields of validation errors to the options of /mbotc create.
+var createFlagNames = map[string]string{
+	"start_time": "--start",
+	"end_time":   "--end",
+	"reminders":  "--remind",
+	"repeat":     "--repeat",
+	"skip_dates": "--skip",
+	"priority":   "--priority",
+	"channel_id": "--channel",
 }
 
-func getNoticeList(p *Plugin, commandArgs *model.CommandArgs) {
-	siteURL := *p.API.GetConfig().ServiceSettings.SiteURL
+// formatCreateErrors lists why /mbotc create failed.
+func formatCreateErrors(err error) string {
+	errs, ok := asValidationErrors(err)
+	if !ok {
+		return "Invalid notice: " + err.Error()
+	}
+
+	lines := []string{"Failed to create the notice:"}
+	for _, err := range errs {
+		name, ok := createFlagNames[err.Field]
+		if !ok {
+			name = err.Field
+		}
+		if name == "" {
+			lines = append(lines, "- "+err.Message)
+		} else {
+			lines = append(lines, "- `"+name+"`: "+err.Message)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func executeEdit(p *Plugin, c *plugin.Context, header *model.CommandArgs, args ...string) *model.CommandResponse {
+	if len(args) != 1 {
+		p.postCommandResponse(header, "Usage: `/mbotc edit <notice-or-post-id>`")
+		return &model.CommandResponse{}
+	}
 
-	requestUrl := siteURL + ":8080/api/v1/notification/today"
-	// create new request
-	req, err := http.NewRequest("GET", requestUrl, nil)
+	notice, err := p.findNotice(args[0])
+	if err == ErrNoticeNotFound {
+		p.postCommandResponse(header, fmt.Sprintf("Notice %s was not found.", args[0]))
+		return &model.CommandResponse{}
+	}
 	if err != nil {
-		// panic()함수는 현재 함수를 즉시 멈추고 현재 함수에 defer 함수들을 모두 실행한 후 즉시 리턴한다
-		fmt.Println("NewRequest Error: ", err)
-		panic(err)
+		p.API.LogError("Failed to get notice", "user_id", header.UserId, "notice_id", args[0], "err", err.Error())
+		p.postCommandResponse(header, "Failed to get the notice. Please try again later.")
+		return &model.CommandResponse{}
+	}
+	if notice.DeleteAt != 0 {
+		p.postCommandResponse(header, "This notice was cancelled and can't be edited anymore.")
+		return &model.CommandResponse{}
+	}
+	if notice.UserId != header.UserId {
+		p.postCommandResponse(header, "Only the author can edit this notice.")
+		return &model.CommandResponse{}
 	}
 
-	// set the header
-	req.Header.Add("userId", commandArgs.UserId)
+	p.openDialog(header.TriggerId, getEditDialog(notice, p.userLocation(header.UserId)))
+	return &model.CommandResponse{}
+}
+
+func executeDelete(p *Plugin, c *plugin.Context, header *model.CommandArgs, args ...string) *model.CommandResponse {
+	if len(args) != 1 {
+		p.postCommandResponse(header, "Usage: `/mbotc delete <notice-or-post-id>`")
+		return &model.CommandResponse{}
+	}
 
-	client := &http.Client{}
-	resp, err := client.Do(req) // send request
+	notice, err := p.findNotice(args[0])
+	if err == ErrNoticeNotFound {
+		p.postCommandResponse(header, fmt.Sprintf("Notice %s was not found.", args[0]))
+		return &model.CommandResponse{}
+	}
 	if err != nil {
-		fmt.Println("client.Do Error: ", err)
-		panic(err)
+		p.API.LogError("Failed to get notice", "user_id", header.UserId, "notice_id", args[0], "err", err.Error())
+		p.postCommandResponse(header, "Failed to get the notice. Please try again later.")
+		return &model.CommandResponse{}
+	}
+
+	p.postCommandResponse(header, p.cancelNoticeAs(header.UserId, notice))
+	return &model.CommandResponse{}
+}
+
+// cancelNoticeAs cancels the notice if the user is allowed to, and returns the message to show
+// to the user.
+func (p *Plugin) cancelNoticeAs(userId string, notice *Notice) string {
+	if notice.DeleteAt != 0 {
+		return "This notice was already cancelled."
+	}
+	if !p.canManageNotice(userId, notice) {
+		return "Only the author or a channel admin can cancel this notice."
 	}
-	defer resp.Body.Close()
 
-	bytes, _ := ioutil.ReadAll(resp.Body)
+	if err := p.cancelNotice(notice, userId); err != nil {
+		p.API.LogError("Failed to cancel notice", "user_id", userId, "notice_id", notice.Id, "err", err.Error())
+		return "Failed to cancel the notice. Please try again later."
+	}
+	return "The notice was cancelled."
+}
 
-	var dailyNotices []DailyNotice
-	json.Unmarshal(bytes, &dailyNotices)
+// findNotice gets a notice by its id or by the id of its post.
+func (p *Plugin) findNotice(id string) (*Notice, error) {
+	notice, err := p.store.GetNotice(id)
+	if err == ErrNoticeNotFound {
+		return p.store.GetNoticeByPostId(id)
+	}
+	return notice, err
+}
 
-	post := &model.Post{
-		UserId:    p.botUserID,
-		ChannelId: commandArgs.ChannelId,
+func executeOutbox(p *Plugin, c *plugin.Context, header *model.CommandArgs, args ...string) *model.CommandResponse {
+	if !p.API.HasPermissionTo(header.UserId, model.PERMISSION_MANAGE_SYSTEM) {
+		p.postCommandResponse(header, "Only system admins can inspect the outbox.")
+		return &model.CommandResponse{}
 	}
 
-	var text string
+	items, err := p.store.ListOutboxItems()
+	if err != nil {
+		p.API.LogError("Failed to list outbox items", "err", err.Error())
+		p.postCommandResponse(header, "Failed to list the outbox.")
+		return &model.CommandResponse{}
+	}
+
+	p.postCommandResponse(header, formatOutboxItems(items))
+	return &model.CommandResponse{}
+}
 
-	text = "# Today's Notice\n" +
-		"| Preview :loudspeaker: | Deadline :calendar: |\n" +
-		"| --- | --- |\n"
+func executeOutboxRetry(p *Plugin, c *plugin.Context, header *model.CommandArgs, args ...string) *model.CommandResponse {
+	if !p.API.HasPermissionTo(header.UserId, model.PERMISSION_MANAGE_SYSTEM) {
+		p.postCommandResponse(header, "Only system admins can retry outbox items.")
+		return &model.CommandResponse{}
+	}
+	if len(args) != 1 {
+		p.postCommandResponse(header, "Usage: `/mbotc outbox retry <id|all>`")
+		return &model.CommandResponse{}
+	}
 
-	if len(dailyNotices) == 0 {
-		text += "| Nothing ... | - |\n"
-	} else {
-		for _, dn := range dailyNotices {
-			var message = strings.Replace(dn.Message, "\n", " ", -1)
-			if len(message) >= 100 {
-				message = message[:100] + " ..."
+	ids := args
+	if args[0] == "all" {
+		items, err := p.store.ListOutboxItems()
+		if err != nil {
+			p.API.LogError("Failed to list outbox items", "err", err.Error())
+			p.postCommandResponse(header, "Failed to list the outbox.")
+			return &model.CommandResponse{}
+		}
+		ids = nil
+		for _, item := range items {
+			if item.Failed {
+				ids = append(ids, item.Id)
 			}
-			text += "| " + message + " | " + dn.EndTime + " | \n"
 		}
 	}
 
-	currentTime := time.Now()
+	for _, id := range ids {
+		if err := p.retryOutboxItem(id); err != nil {
+			p.postCommandResponse(header, fmt.Sprintf("Failed to retry outbox item %s: %s", id, err.Error()))
+			return &model.CommandResponse{}
+		}
+	}
+
+	p.postCommandResponse(header, fmt.Sprintf("Retrying %d outbox item(s).", len(ids)))
+	return &model.CommandResponse{}
+}
 
-	text += "[See More](https://www.mbotc.com/main/detail/" + currentTime.Format("20060102") + ")"
-	var attachment = []*model.SlackAttachment{
-		{
-			Color: "#1352ab",
-			Text:  text,
-		},
+func executeOutboxDiscard(p *Plugin, c *plugin.Context, header *model.CommandArgs, args ...string) *model.CommandResponse {
+	if !p.API.HasPermissionTo(header.UserId, model.PERMISSION_MANAGE_SYSTEM) {
+		p.postCommandResponse(header, "Only system admins can discard outbox items.")
+		return &model.CommandResponse{}
+	}
+	if len(args) != 1 {
+		p.postCommandResponse(header, "Usage: `/mbotc outbox discard <id>`")
+		return &model.CommandResponse{}
+	}
+
+	if err := p.store.DeleteOutboxItem(args[0]); err != nil {
+		p.postCommandResponse(header, fmt.Sprintf("Failed to discard outbox item %s: %s", args[0], err.Error()))
+		return &model.CommandResponse{}
 	}
-	post.AddProp("attachments", attachment)
 
-	_ = p.API.SendEphemeralPost(commandArgs.UserId, post)
+	p.postCommandResponse(header, fmt.Sprintf("Discarded outbox item %s.", args[0]))
+	return &model.CommandResponse{}
 }
 
-func (p *Plugin) ExecuteCommand(c *plugin.Context, commandArgs *model.CommandArgs) (*model.CommandResponse, *model.AppError) {
-	args := strings.Fields(commandArgs.Command)
+func (p *Plugin) ExecuteCommand(c *plugin.Context, commandArgs *model.CommandArgs) (response *model.CommandResponse, appErr *model.AppError) {
+	defer func() {
+		if x := recover(); x != nil {
+			p.API.LogError("Recovered from a panic in a slash command",
+				"user_id", commandArgs.UserId, "channel_id", commandArgs.ChannelId, "command", commandArgs.Command,
+				"panic", x, "stack", string(debug.Stack()))
+			p.postCommandResponse(commandArgs, "Something went wrong. Please try again later.")
+			response = &model.CommandResponse{}
+		}
+	}()
+
+	args, err := splitCommandArgs(commandArgs.Command)
+	if err != nil {
+		p.postCommandResponse(commandArgs, fmt.Sprintf("Failed to read the command: %s.", err.Error()))
+		return &model.CommandResponse{}, nil
+	}
 	if len(args) == 0 || args[0] != "/mbotc" {
 		return p.help(commandArgs), nil
 	}
@@ -176,54 +395,162 @@ func getAutocompleteData() *model.AutocompleteData {
 	help := model.NewAutocompleteData("help", "", "Guide for mbotc")
 	mbotcAutocomplete.AddCommand(help)
 
-	create := model.NewAutocompleteData("create", "", "Register your Notice")
+	create := model.NewAutocompleteData("create", "[--start <date> \"content\"]", "Register your Notice, in a dialog or inline")
 	mbotcAutocomplete.AddCommand(create)
 
-	today := model.NewAutocompleteData("today", "", "Get all today's notices")
+	today := model.NewAutocompleteData("today", "[--scope channel|team|all]", "Get all today's notices")
 	mbotcAutocomplete.AddCommand(today)
 
+	week := model.NewAutocompleteData("week", "[--scope channel|team|all]", "Get the notices of the next 7 days")
+	mbotcAutocomplete.AddCommand(week)
+
+	month := model.NewAutocompleteData("month", "[--scope channel|team|all]", "Get the notices of the next month")
+	mbotcAutocomplete.AddCommand(month)
+
+	rangeCommand := model.NewAutocompleteData("range", "[from] [to] [--scope channel|team|all]", "Get the notices between two days")
+	mbotcAutocomplete.AddCommand(rangeCommand)
+
+	edit := model.NewAutocompleteData("edit", "[notice-or-post-id]", "Edit your Notice")
+	mbotcAutocomplete.AddCommand(edit)
+
+	deleteCommand := model.NewAutocompleteData("delete", "[notice-or-post-id]", "Cancel a Notice")
+	mbotcAutocomplete.AddCommand(deleteCommand)
+
+	acks := model.NewAutocompleteData("acks", "[notice-or-post-id]", "Show who hasn't acknowledged your notice yet")
+	mbotcAutocomplete.AddCommand(acks)
+
+	attendees := model.NewAutocompleteData("attendees", "[notice-or-post-id]", "Show who is going to your event notice")
+	attendees.AddCommand(model.NewAutocompleteData("export", "[notice-or-post-id]", "Get the attendee list as a CSV file"))
+	mbotcAutocomplete.AddCommand(attendees)
+
+	importCommand := model.NewAutocompleteData("import", "[file-id]", "Import notices from an .ics file")
+	mbotcAutocomplete.AddCommand(importCommand)
+
+	feed := model.NewAutocompleteData("feed", "", "Get your private calendar feed links")
+	feed.AddCommand(model.NewAutocompleteData("reset", "", "Replace your calendar feed links"))
+	feed.AddCommand(model.NewAutocompleteData("revoke", "", "Turn off your calendar feed links"))
+	mbotcAutocomplete.AddCommand(feed)
+
+	digest := model.NewAutocompleteData("digest", "", "Show the daily digest of this channel")
+	digest.AddCommand(model.NewAutocompleteData("on", "[--at 08:30] [--timezone Asia/Seoul]", "Post the notices of the day in this channel every working day"))
+	digest.AddCommand(model.NewAutocompleteData("off", "", "Turn off the daily digest of this channel"))
+	me := model.NewAutocompleteData("me", "", "Show your personal digest")
+	me.AddCommand(model.NewAutocompleteData("on", "[--at 08:30]", "Get your notices of the day in a direct message every working day"))
+	me.AddCommand(model.NewAutocompleteData("off", "", "Turn off your personal digest"))
+	digest.AddCommand(me)
+	mbotcAutocomplete.AddCommand(digest)
+
+	outbox := model.NewAutocompleteData("outbox", "", "Show backend deliveries that are pending or failed")
+	outbox.RoleID = model.SYSTEM_ADMIN_ROLE_ID
+	retry := model.NewAutocompleteData("retry", "[id|all]", "Deliver a failed item again")
+	retry.RoleID = model.SYSTEM_ADMIN_ROLE_ID
+	outbox.AddCommand(retry)
+	discard := model.NewAutocompleteData("discard", "[id]", "Remove an item from the outbox")
+	discard.RoleID = model.SYSTEM_ADMIN_ROLE_ID
+	outbox.AddCommand(discard)
+	mbotcAutocomplete.AddCommand(outbox)
+
 	return mbotcAutocomplete
 }
 
 // Post Message to Channel with Bot
 func (p *Plugin) postCommandResponse(args *model.CommandArgs, text string) {
+	p.postEphemeral(args.UserId, args.ChannelId, text)
+}
+
+// postEphemeral shows a message from the bot to a single user.
+func (p *Plugin) postEphemeral(userId, channelId, text string) {
+	post := &model.Post{
+		UserId:    p.botUserID,
+		ChannelId: channelId,
+		Message:   text,
+	}
+	_ = p.API.SendEphemeralPost(userId, post)
+}
+
+// sendDirectMessage posts a message from the bot in its direct channel with the user.
+func (p *Plugin) sendDirectMessage(userId, text string) error {
+	channel, appErr := p.API.GetDirectChannel(userId, p.botUserID)
+	if appErr != nil {
+		return errors.Wrapf(appErr, "failed to get direct channel of %s", userId)
+	}
+
 	post := &model.Post{
 		UserId:    p.botUserID,
-		ChannelId: args.ChannelId,
+		ChannelId: channel.Id,
 		Message:   text,
 	}
-	_ = p.API.SendEphemeralPost(args.UserId, post)
+	if _, appErr := p.API.CreatePost(post); appErr != nil {
+		return errors.Wrapf(appErr, "failed to send direct message to %s", userId)
+	}
+	return nil
 }
 
 func (p *Plugin) openCreateDialog(args *model.CommandArgs) {
+	p.openDialog(args.TriggerId, getDialog())
+}
+
+// openDialog opens a dialog submitted to the /mm route.
+func (p *Plugin) openDialog(triggerId string, dialog model.Dialog) {
 	siteURL := *p.API.GetConfig().ServiceSettings.SiteURL
 	listenAddress := *p.API.GetConfig().ServiceSettings.ListenAddress
 	dialogRequest := model.OpenDialogRequest{
-		TriggerId: args.TriggerId,
-		URL:       fmt.Sprintf("%s/plugins/%s/mm", siteURL+listenAddress, "com.mattermost.plugin-mbotc"),
-		Dialog:    getDialog(),
+		TriggerId: triggerId,
+		URL:       fmt.Sprintf("%s/plugins/%s/mm", siteURL+listenAddress, manifest.Id),
+		Dialog:    dialog,
 	}
 
-	p.API.OpenInteractiveDialog(dialogRequest)
+	if appErr := p.API.OpenInteractiveDialog(dialogRequest); appErr != nil {
+		p.API.LogError("Failed to open dialog", "callback_id", dialog.CallbackId, "err", appErr.Error())
+	}
 }
 
 func getDialog() model.Dialog {
 	return model.Dialog{
-		CallbackId: "somecallbackid",
+		CallbackId: createNoticeCallbackId,
 		Title:      "Create Notice",
 		Elements: []model.DialogElement{{
 			DisplayName: "Date",
 			Name:        "start_time",
 			Type:        "text",
 			Placeholder: "YYYY-MM-DD hh:mm",
-			HelpText:    "e.g. 2021-11-05 09:00",
+			HelpText:    "e.g. 2021-11-05 09:00, tomorrow 9am, next fri 18:00 or 내일 오후 3시, in your Mattermost timezone",
 		}, {
 			DisplayName: "End date",
 			Name:        "end_time",
 			Type:        "text",
 			Optional:    true,
 			Placeholder: "YYYY-MM-DD hh:mm",
-			HelpText:    "e.g. 2021-11-05 18:00",
+			HelpText:    "e.g. 2021-11-05 18:00 or in 3 days",
+		}, {
+			DisplayName: "Reminders",
+			Name:        "reminders",
+			Type:        "text",
+			Optional:    true,
+			Placeholder: "1d,1h,0m",
+			HelpText:    "When to remind the channel before the start: d days, h hours, m minutes, 0m at start. Leave empty for the default, or write none.",
+		}, {
+			DisplayName: "Repeat",
+			Name:        "repeat",
+			Type:        "text",
+			Optional:    true,
+			Placeholder: "weekly",
+			HelpText:    "daily, weekly, monthly or a rule such as FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,WE;UNTIL=20211231",
+		}, {
+			DisplayName: "Skip dates",
+			Name:        "skip_dates",
+			Type:        "text",
+			Optional:    true,
+			Placeholder: "YYYY-MM-DD, YYYY-MM-DD",
+			HelpText:    "Days without an occurrence of a repeated notice, e.g. 2021-12-24, 2021-12-31",
+		}, {
+			DisplayName: "Priority",
+			Name:        "priority",
+			Type:        "select",
+			Optional:    true,
+			Default:     priorityNormal,
+			Options:     priorityOptions(),
+			HelpText:    "High and urgent notices may also notify the whole channel.",
 		}, {
 			DisplayName: "Content",
 			Name:        "content",
@@ -235,3 +562,43 @@ func getDialog() model.Dialog {
 		NotifyOnCancel: false,
 	}
 }
+
+// getEditDialog returns the create dialog filled in with the notice, with its times in loc.
+func getEditDialog(notice *Notice, loc *time.Location) model.Dialog {
+	dialog := getDialog()
+	dialog.CallbackId = editNoticeCallbackId
+	dialog.State = encodeDialogState(editNoticeState{NoticeId: notice.Id})
+	dialog.Title = "Edit Notice"
+	dialog.SubmitLabel = "Update"
+
+	startTime, endTime := notice.StartTime, notice.EndTime
+	if start, end, err := notice.period(); err == nil {
+		startTime, endTime = start.In(loc).Format(noticeTimeLayout), end.In(loc).Format(noticeTimeLayout)
+	}
+	if notice.EndTime == notice.StartTime {
+		endTime = ""
+	}
+	for i := range dialog.Elements {
+		switch dialog.Elements[i].Name {
+		case "start_time":
+			dialog.Elements[i].Default = startTime
+		case "end_time":
+			dialog.Elements[i].Default = endTime
+		case "reminders":
+			dialog.Elements[i].Default = notice.Reminders
+		case "repeat":
+			if notice.Recurrence != nil {
+				dialog.Elements[i].Default = notice.Recurrence.String()
+			}
+		case "skip_dates":
+			if notice.Recurrence != nil {
+				dialog.Elements[i].Default = strings.Join(notice.Recurrence.Exceptions, ", ")
+			}
+		case "priority":
+			dialog.Elements[i].Default = notice.priority().value
+		case "content":
+			dialog.Elements[i].Default = notice.Message
+		}
+	}
+	return dialog
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/mattermost/mattermost-server/v5/plugin/plugintest/mock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExecuteCreateInline(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	api := newKVAPI()
+	api.On("GetUser", "user1").Return(&model.User{Id: "user1", Username: "alice", Timezone: map[string]string{
+		"useAutomaticTimezone": "false",
+		"manualTimezone":       "Asia/Seoul",
+	}}, nil)
+	api.On("GetChannelByName", "team1", "town-square", false).Return(&model.Channel{Id: "channel2", TeamId: "team1"}, nil)
+	api.On("GetChannelByName", "team1", "nowhere", false).Return(nil, &model.AppError{Message: "not found"})
+	api.On("GetChannelMember", mock.Anything, "user1").Return(&model.ChannelMember{}, nil)
+	api.On("HasPermissionToChannel", "user1", mock.Anything, model.PERMISSION_CREATE_POST).Return(true)
+	api.On("GetChannel", "channel2").Return(&model.Channel{Id: "channel2", TeamId: "team1", Name: "town-square"}, nil)
+	api.On("GetChannel", "channel1").Return(&model.Channel{Id: "channel1", TeamId: "team1"}, nil)
+	api.On("GetTeam", "team1").Return(&model.Team{Id: "team1"}, nil)
+	api.On("CreatePost", mock.Anything).Return(func(post *model.Post) *model.Post {
+		post.Id = model.NewId()
+		return post
+	}, nil)
+	var replies []string
+	api.On("SendEphemeralPost", "user1", mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+		replies = append(replies, args.Get(1).(*model.Post).Message)
+	})
+
+	p := &Plugin{botUserID: "bot"}
+	p.SetAPI(api)
+	p.store = NewStore(p)
+	p.backend = &fakeBackend{}
+	p.setConfiguration(&configuration{ReminderLeadTimes: noRemindersSpec})
+
+	execute := func(command string) {
+		_, appErr := p.ExecuteCommand(nil, &model.CommandArgs{UserId: "user1", TeamId: "team1", ChannelId: "channel1", Command: command})
+		require.Nil(appErr)
+	}
+
+	seoul := loadLocation("Asia/Seoul")
+	day := time.Now().In(seoul).AddDate(1, 0, 0)
+	start := time.Date(day.Year(), day.Month(), day.Day(), 9, 0, 0, 0, seoul)
+	execute(fmt.Sprintf(`/mbotc create --start "%s" --end="%s" --channel ~town-square --remind 1h "Team lunch, bring snacks"`,
+		start.Format(noticeTimeLayout), start.Add(9*time.Hour).Format(noticeTimeLayout)))
+	notices, err := p.store.ListNoticesByChannel("channel2")
+	require.NoError(err)
+	require.Len(notices, 1)
+	assert.Equal("Team lunch, bring snacks", notices[0].Message)
+	assert.Equal(start.UTC().Format(storedTimeLayout), notices[0].StartTime)
+	assert.Equal(start.Add(9*time.Hour).UTC().Format(storedTimeLayout), notices[0].EndTime)
+	assert.Equal("1h", notices[0].Reminders)
+	assert.Equal("Asia/Seoul", notices[0].TimeZone)
+	assert.Equal([]string{"The notice was posted in ~town-square."}, replies)
+
+	replies = nil
+	execute(`/mbotc create --start "2021-11-05 09:00" --channel ~nowhere "x"`)
+	execute(`/mbotc create --start "2021-11-05 09:00"`)
+	execute(`/mbotc create --colour red "x"`)
+	execute(`/mbotc create --start "2021-11-05 09:00 "x`)
+	execute(`/mbotc create --start "2021-11-05 09:00" "unterminated`)
+	execute(`/mbotc create --start "2021-11-05 09:00" --remind soon "x"`)
+	require.Len(replies, 6)
+	assert.Equal("Channel ~nowhere was not found.", replies[0])
+	assert.Equal(createUsage, replies[1])
+	assert.Contains(replies[2], "unknown option --colour")
+	assert.Contains(replies[3], createUsage)
+	assert.Contains(replies[4], "unterminated quote")
+	assert.Equal("Failed to create the notice:\n"+
+		"- `--start`: The date is in the past.\n"+
+		"- `--remind`: Use lead times such as 1d,1h,30m, 0m for the start, or none.", replies[5])
+
+	notices, err = p.store.ListNoticesByChannel("channel2")
+	require.NoError(err)
+	assert.Len(notices, 1)
+}
+
+func TestOutboxCommandsAreForAdmins(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Contains(helpText, "`/mbotc outbox retry <id|all>`")
+	for _, command := range getAutocompleteData().SubCommands {
+		if command.Trigger != "outbox" {
+			continue
+		}
+		assert.Equal(model.SYSTEM_ADMIN_ROLE_ID, command.RoleID)
+		for _, subCommand := range command.SubCommands {
+			assert.Equal(model.SYSTEM_ADMIN_ROLE_ID, subCommand.RoleID, subCommand.Trigger)
+		}
+		return
+	}
+	assert.Fail("outbox command missing from the autocomplete")
+}
@@ -1,11 +1,16 @@
 package main
 
 import (
+	"net/url"
 	"reflect"
+	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 )
 
+const defaultBackendTimeout = 10 * time.Second
+
 // configuration captures the plugin's external configuration as exposed in the Mattermost server
 // configuration, as well as values computed from the configuration. Any public fields will be
 // deserialized from the Mattermost server configuration in OnConfigurationChange.
@@ -18,6 +23,46 @@ import (
 // If you add non-reference types to your configuration struct, be sure to rewrite Clone as a deep
 // copy appropriate for your types.
 type configuration struct {
+	// BackendURL is the base URL of the MBotC backend, e.g. https://api.mbotc.com. When empty,
+	// the backend is expected on port 8080 of the Mattermost site URL.
+	BackendURL string
+
+	// BackendAPIToken is sent as a bearer token with every request to the backend.
+	BackendAPIToken string
+
+	// BackendTimeoutSeconds bounds every request to the backend. Zero means the default timeout.
+	BackendTimeoutSeconds int
+
+	// FrontendSigningSecret is shared with the MBotC frontend, which signs the notices it posts
+	// on behalf of users with it. Signed requests are refused while it is empty.
+	FrontendSigningSecret string
+
+	// DeleteCancelledPosts deletes the post of a cancelled notice, instead of marking it as
+	// cancelled.
+	DeleteCancelledPosts bool
+
+	// ReminderLeadTimes lists the default lead times of notice reminders, e.g. "1d,1h,0m".
+	ReminderLeadTimes string
+
+	// HighPriorityMention is "here" or "channel" to mention the channel in the post of a high
+	// priority notice. Empty or "none" doesn't.
+	HighPriorityMention string
+
+	// HighPriorityDirectMessage sends high priority notices to every member of the channel.
+	HighPriorityDirectMessage bool
+
+	// HighPriorityPin pins the post of high priority notices.
+	HighPriorityPin bool
+
+	// UrgentPriorityMention, UrgentPriorityDirectMessage and UrgentPriorityPin are the policy of
+	// urgent notices, like those of high priority notices.
+	UrgentPriorityMention       string
+	UrgentPriorityDirectMessage bool
+	UrgentPriorityPin           bool
+
+	// PriorityDirectMessageMaxMembers bounds the channels whose members get priority notices as
+	// direct messages. Zero means the default of 500 members.
+	PriorityDirectMessageMaxMembers int
 }
 
 // Clone shallow copies the configuration. Your implementation may require a deep copy if
@@ -27,6 +72,83 @@ func (c *configuration) Clone() *configuration {
 	return &clone
 }
 
+// IsValid checks that the configuration can be used to reach the backend.
+func (c *configuration) IsValid() error {
+	if c.BackendURL != "" {
+		u, err := url.Parse(c.BackendURL)
+		if err != nil {
+			return errors.Wrap(err, "invalid backend URL")
+		}
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return errors.Errorf("invalid backend URL %q: scheme must be http or https", c.BackendURL)
+		}
+		if u.Host == "" {
+			return errors.Errorf("invalid backend URL %q: missing host", c.BackendURL)
+		}
+	}
+
+	if c.BackendTimeoutSeconds < 0 {
+		return errors.New("backend timeout must not be negative")
+	}
+
+	if _, err := parseLeadTimes(c.ReminderLeadTimes); err != nil {
+		return errors.Wrap(err, "invalid reminder lead times")
+	}
+
+	if c.PriorityDirectMessageMaxMembers < 0 {
+		return errors.New("priority direct message member cap must not be negative")
+	}
+
+	for _, mention := range []string{c.HighPriorityMention, c.UrgentPriorityMention} {
+		switch mention {
+		case "", mentionNone, mentionHere, mentionChannel:
+		default:
+			return errors.Errorf("invalid priority mention %q: must be none, here or channel", mention)
+		}
+	}
+
+	return nil
+}
+
+// backendURL joins path to the configured backend base URL, falling back to port 8080 of siteURL.
+func (c *configuration) backendURL(siteURL, path string) string {
+	base := c.BackendURL
+	if base == "" {
+		base = siteURL + ":8080"
+	}
+	return strings.TrimSuffix(base, "/") + path
+}
+
+// backendTimeout returns the timeout of a single request to the backend.
+func (c *configuration) backendTimeout() time.Duration {
+	if c.BackendTimeoutSeconds == 0 {
+		return defaultBackendTimeout
+	}
+	return time.Duration(c.BackendTimeoutSeconds) * time.Second
+}
+
+// priorityPolicy returns how the delivery of notices of the priority is escalated. Only high
+// and urgent notices are.
+func (c *configuration) priorityPolicy(priority string) priorityPolicy {
+	switch priority {
+	case priorityHigh:
+		return priorityPolicy{Mention: c.HighPriorityMention, DirectMessage: c.HighPriorityDirectMessage, Pin: c.HighPriorityPin}
+	case priorityUrgent:
+		return priorityPolicy{Mention: c.UrgentPriorityMention, DirectMessage: c.UrgentPriorityDirectMessage, Pin: c.UrgentPriorityPin}
+	default:
+		return priorityPolicy{}
+	}
+}
+
+// priorityDirectMessageMaxMembers returns the largest channel whose members get priority notices
+// as direct messages.
+func (c *configuration) priorityDirectMessageMaxMembers() int {
+	if c.PriorityDirectMessageMaxMembers == 0 {
+		return defaultPriorityDirectMessageMaxMembers
+	}
+	return c.PriorityDirectMessageMaxMembers
+}
+
 // getConfiguration retrieves the active configuration under lock, making it safe to use
 // concurrently. The active configuration may change underneath the client of this method, but
 // the struct returned by this API call is considered immutable.
@@ -77,6 +199,10 @@ func (p *Plugin) OnConfigurationChange() error {
 		return errors.Wrap(err, "failed to load plugin configuration")
 	}
 
+	if err := configuration.IsValid(); err != nil {
+		return errors.Wrap(err, "invalid plugin configuration")
+	}
+
 	p.setConfiguration(configuration)
 
 	return nil
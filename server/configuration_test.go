@@ -0,0 +1,45 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfigurationIsValid(t *testing.T) {
+	for name, tc := range map[string]struct {
+		config  configuration
+		isValid bool
+	}{
+		"empty":            {configuration{}, true},
+		"https backend":    {configuration{BackendURL: "https://api.mbotc.com/prefix"}, true},
+		"unsupported":      {configuration{BackendURL: "ftp://api.mbotc.com"}, false},
+		"missing host":     {configuration{BackendURL: "http://"}, false},
+		"negative timeout": {configuration{BackendTimeoutSeconds: -1}, false},
+		"priority mention": {configuration{UrgentPriorityMention: mentionChannel}, true},
+		"unknown mention":  {configuration{HighPriorityMention: "all"}, false},
+		"negative cap":     {configuration{PriorityDirectMessageMaxMembers: -1}, false},
+	} {
+		t.Run(name, func(t *testing.T) {
+			err := tc.config.IsValid()
+			if tc.isValid {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestConfigurationBackend(t *testing.T) {
+	assert := assert.New(t)
+
+	config := &configuration{}
+	assert.Equal("http://mm.example.com:8080/api/v1/notification", config.backendURL("http://mm.example.com", "/api/v1/notification"))
+	assert.Equal(defaultBackendTimeout, config.backendTimeout())
+
+	config = &configuration{BackendURL: "https://api.mbotc.com/v/", BackendTimeoutSeconds: 3}
+	assert.Equal("https://api.mbotc.com/v/api/v1/notification", config.backendURL("http://mm.example.com", "/api/v1/notification"))
+	assert.Equal(3*time.Second, config.backendTimeout())
+}
@@ -0,0 +1,346 @@
+// Package dateparse resolves the dates users type, absolute or in natural English or Korean,
+// such as "2021-11-05 09:00", "tomorrow 9am", "next fri 18:00", "in 3 days", "내일 오후 3시" or
+// "다음주 월요일".
+package dateparse
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultHour is the time of day of a date typed without a time, e.g. "tomorrow".
+const DefaultHour = 9
+
+// eveningHour is the time of day of "tonight".
+const eveningHour = 20
+
+// ErrUnrecognized is returned for text that isn't a date.
+var ErrUnrecognized = errors.New("unrecognized date")
+
+// expression collects the parts of a date expression as the rules match them.
+type expression struct {
+	now time.Time
+
+	hasDate          bool
+	year, month, day int
+
+	hasTime      bool
+	hour, minute int
+	defaultHour  int
+
+	// days and offset are relative to now, e.g. "in 3 days" or "2시간 후".
+	days   int
+	offset time.Duration
+}
+
+type rule struct {
+	pattern *regexp.Regexp
+	apply   func(e *expression, match []string) error
+}
+
+// rules are tried in order, each at most once. Dates come before times so that the numbers of
+// a date aren't read as a time, and relative durations before Korean times so that "2시간 후"
+// isn't read as 2 o'clock.
+var rules = []rule{
+	{regexp.MustCompile(`(\d{4})[-./](\d{1,2})[-./](\d{1,2})`), applyNumericDate},
+	{regexp.MustCompile(`(?:(\d{4})\s*년\s*)?(\d{1,2})\s*월\s*(\d{1,2})\s*일`), applyNumericDate},
+	{regexp.MustCompile(`\b()(\d{1,2})/(\d{1,2})\b`), applyNumericDate},
+	{regexp.MustCompile(`\b(jan|feb|mar|apr|may|jun|jul|aug|sep|oct|nov|dec)[a-z]*\.?\s+(\d{1,2})(?:st|nd|rd|th)?\b`), applyMonthNameDate},
+	{regexp.MustCompile(`\b(\d{1,2})(?:st|nd|rd|th)?\s+(jan|feb|mar|apr|may|jun|jul|aug|sep|oct|nov|dec)[a-z]*\b`), applyDayMonthNameDate},
+
+	{regexp.MustCompile(`\bin\s+(\d+|an?|one)\s*(minutes?|mins?|m|hours?|hrs?|h|days?|d|weeks?|w)\b`), applyRelative},
+	{regexp.MustCompile(`(\d+)\s*(분|시간|일|주)\s*(?:후|뒤)`), applyRelative},
+
+	{regexp.MustCompile(`\bday after tomorrow\b|글피|모레|\btomorrow\b|\btmr\b|내일|\btonight\b|\btoday\b|오늘`), applyDayWord},
+
+	{regexp.MustCompile(`\b(?:(this|next|coming)\s+)?(monday|mon|tuesday|tues|tue|wednesday|wed|thursday|thurs|thur|thu|friday|fri|saturday|sat|sunday|sun)\b`), applyWeekday},
+	{regexp.MustCompile(`(?:(이번\s*주|금주|다음\s*주|차주|다다음\s*주)\s*)?([월화수목금토일])요일`), applyWeekday},
+	{regexp.MustCompile(`\bnext week\b|다다음\s*주|다음\s*주|차주`), applyWeek},
+
+	{regexp.MustCompile(`\b(\d{1,2})(?::(\d{2}))?\s*(am|pm|a\.m\.|p\.m\.)`), applyEnglishTime},
+	{regexp.MustCompile(`(오전|오후|아침|낮|저녁|밤)?\s*(\d{1,2})\s*시(?:\s*(\d{1,2})\s*분|\s*(반))?`), applyKoreanTime},
+	{regexp.MustCompile(`(오전|오후|아침|낮|저녁|밤)?\s*\b(\d{1,2}):(\d{2})\b`), applyClockTime},
+	{regexp.MustCompile(`\bnoon\b|정오|\bmidnight\b|자정`), applyNamedTime},
+}
+
+// fillers are the words left between the parts of an expression, such as "at" in "tomorrow
+// at 9am", that carry no meaning of their own.
+var fillers = regexp.MustCompile(`\b(at|on|by|the|of)\b|에|까지|,`)
+
+// Parse resolves text relative to now. The result is in the location of now.
+func Parse(text string, now time.Time) (time.Time, error) {
+	e := &expression{now: now, defaultHour: DefaultHour}
+
+	rest := " " + strings.ToLower(strings.TrimSpace(text)) + " "
+	matched := false
+	for _, r := range rules {
+		loc := r.pattern.FindStringSubmatchIndex(rest)
+		if loc == nil {
+			continue
+		}
+		match := make([]string, len(loc)/2)
+		for i := range match {
+			if loc[2*i] >= 0 {
+				match[i] = rest[loc[2*i]:loc[2*i+1]]
+			}
+		}
+		if err := r.apply(e, match); err != nil {
+			return time.Time{}, errors.Wrapf(err, "invalid date %q", text)
+		}
+		rest = rest[:loc[0]] + " " + rest[loc[1]:]
+		matched = true
+	}
+
+	if rest = strings.TrimSpace(fillers.ReplaceAllString(rest, " ")); !matched || rest != "" {
+		return time.Time{}, errors.Wrapf(ErrUnrecognized, "%q", text)
+	}
+	return e.resolve()
+}
+
+func (e *expression) setDate(t time.Time) error {
+	if e.hasDate {
+		return errors.New("more than one date")
+	}
+	e.hasDate = true
+	e.year, e.month, e.day = t.Year(), int(t.Month()), t.Day()
+	return nil
+}
+
+func (e *expression) setTime(hour, minute int) error {
+	if e.hasTime {
+		return errors.New("more than one time")
+	}
+	if hour < 0 || hour > 23 || minute < 0 || minute > 59 {
+		return errors.Errorf("invalid time %02d:%02d", hour, minute)
+	}
+	e.hasTime = true
+	e.hour, e.minute = hour, minute
+	return nil
+}
+
+func (e *expression) today() time.Time {
+	return time.Date(e.now.Year(), e.now.Month(), e.now.Day(), 0, 0, 0, 0, e.now.Location())
+}
+
+func (e *expression) resolve() (time.Time, error) {
+	if e.offset != 0 {
+		if e.hasDate || e.hasTime || e.days != 0 {
+			return time.Time{}, errors.New("a duration in hours or minutes can't have a date or time")
+		}
+		return e.now.Add(e.offset).Truncate(time.Minute), nil
+	}
+
+	if e.days != 0 {
+		if e.hasDate {
+			return time.Time{}, errors.New("a duration in days can't have a date")
+		}
+		if !e.hasTime {
+			return e.now.AddDate(0, 0, e.days).Truncate(time.Minute), nil
+		}
+		_ = e.setDate(e.today().AddDate(0, 0, e.days))
+	}
+
+	rollOver := false
+	if !e.hasDate {
+		_ = e.setDate(e.today())
+		rollOver = true
+	}
+	if !e.hasTime {
+		e.hour = e.defaultHour
+	}
+
+	t := time.Date(e.year, time.Month(e.month), e.day, e.hour, e.minute, 0, 0, e.now.Location())
+	if t.Day() != e.day {
+		return time.Time{}, errors.Errorf("invalid date %04d-%02d-%02d", e.year, e.month, e.day)
+	}
+	// A time alone, e.g. "9am", is the next one to come.
+	if rollOver && t.Before(e.now) {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
+
+// dateWithoutYear returns the next month and day to come, this year or the next.
+func (e *expression) dateWithoutYear(month, day int) time.Time {
+	t := time.Date(e.now.Year(), time.Month(month), day, 0, 0, 0, 0, e.now.Location())
+	if t.Before(e.today()) {
+		t = t.AddDate(1, 0, 0)
+	}
+	return t
+}
+
+func applyNumericDate(e *expression, match []string) error {
+	month, _ := strconv.Atoi(match[2])
+	day, _ := strconv.Atoi(match[3])
+	if month < 1 || month > 12 || day < 1 || day > 31 {
+		return errors.Errorf("invalid date %s", strings.TrimSpace(match[0]))
+	}
+	if match[1] == "" {
+		return e.setDate(e.dateWithoutYear(month, day))
+	}
+
+	year, _ := strconv.Atoi(match[1])
+	t := time.Date(year, time.Month(month), day, 0, 0, 0, 0, e.now.Location())
+	if t.Day() != day {
+		return errors.Errorf("invalid date %s", strings.TrimSpace(match[0]))
+	}
+	return e.setDate(t)
+}
+
+var monthNames = map[string]int{
+	"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+	"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+}
+
+func applyMonthNameDate(e *expression, match []string) error {
+	return applyNumericDate(e, []string{match[0], "", strconv.Itoa(monthNames[match[1]]), match[2]})
+}
+
+func applyDayMonthNameDate(e *expression, match []string) error {
+	return applyNumericDate(e, []string{match[0], "", strconv.Itoa(monthNames[match[2]]), match[1]})
+}
+
+func applyRelative(e *expression, match []string) error {
+	n, err := strconv.Atoi(match[1])
+	if err != nil {
+		// "an hour", "a day" or "one week"
+		n = 1
+	}
+
+	switch unit := match[2]; {
+	case strings.HasPrefix(unit, "m") || unit == "분":
+		e.offset += time.Duration(n) * time.Minute
+	case strings.HasPrefix(unit, "h") || unit == "시간":
+		e.offset += time.Duration(n) * time.Hour
+	case strings.HasPrefix(unit, "d") || unit == "일":
+		e.days += n
+	case strings.HasPrefix(unit, "w") || unit == "주":
+		e.days += 7 * n
+	}
+	return nil
+}
+
+func applyDayWord(e *expression, match []string) error {
+	days := 0
+	switch match[0] {
+	case "day after tomorrow", "모레":
+		days = 2
+	case "글피":
+		days = 3
+	case "tomorrow", "tmr", "내일":
+		days = 1
+	case "tonight":
+		e.defaultHour = eveningHour
+	}
+	return e.setDate(e.today().AddDate(0, 0, days))
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+	"일": time.Sunday, "월": time.Monday, "화": time.Tuesday, "수": time.Wednesday,
+	"목": time.Thursday, "금": time.Friday, "토": time.Saturday,
+}
+
+// applyWeekday resolves "fri" to the next Friday to come, today included, and "this fri" or
+// "next fri" to the Friday of this or next week. Weeks start on Monday.
+func applyWeekday(e *expression, match []string) error {
+	name := match[2]
+	if len(name) > 3 && name[0] < 0x80 {
+		name = name[:3]
+	}
+	weekday := weekdays[name]
+
+	today := e.today()
+	switch modifier := strings.Join(strings.Fields(match[1]), ""); modifier {
+	case "", "coming":
+		return e.setDate(today.AddDate(0, 0, (int(weekday)-int(today.Weekday())+7)%7))
+	default:
+		weeks := map[string]int{"this": 0, "이번주": 0, "금주": 0, "next": 1, "다음주": 1, "차주": 1, "다다음주": 2}[modifier]
+		return e.setDate(mondayOf(today).AddDate(0, 0, 7*weeks+mondayOffset(weekday)))
+	}
+}
+
+// applyWeek resolves "next week" to the Monday of next week.
+func applyWeek(e *expression, match []string) error {
+	weeks := 1
+	if strings.HasPrefix(match[0], "다다음") {
+		weeks = 2
+	}
+	return e.setDate(mondayOf(e.today()).AddDate(0, 0, 7*weeks))
+}
+
+func mondayOf(day time.Time) time.Time {
+	return day.AddDate(0, 0, -mondayOffset(day.Weekday()))
+}
+
+func mondayOffset(weekday time.Weekday) int {
+	return (int(weekday) + 6) % 7
+}
+
+func applyEnglishTime(e *expression, match []string) error {
+	hour, _ := strconv.Atoi(match[1])
+	minute, _ := strconv.Atoi(match[2])
+	if hour < 1 || hour > 12 {
+		return errors.Errorf("invalid time %s", strings.TrimSpace(match[0]))
+	}
+	hour %= 12
+	if strings.HasPrefix(match[3], "p") {
+		hour += 12
+	}
+	return e.setTime(hour, minute)
+}
+
+func applyKoreanTime(e *expression, match []string) error {
+	hour, _ := strconv.Atoi(match[2])
+	minute, _ := strconv.Atoi(match[3])
+	if match[4] == "반" {
+		minute = 30
+	}
+	return e.setTime(koreanHour(match[1], hour), minute)
+}
+
+func applyClockTime(e *expression, match []string) error {
+	hour, _ := strconv.Atoi(match[2])
+	minute, _ := strconv.Atoi(match[3])
+	if match[1] != "" {
+		hour = koreanHour(match[1], hour)
+	}
+	return e.setTime(hour, minute)
+}
+
+// koreanHour converts the hour of a Korean time of day. Without 오전 or 오후, hours from 1 to 6
+// are read as afternoon hours, as in "3시" for a meeting.
+func koreanHour(period string, hour int) int {
+	if hour > 12 {
+		return hour
+	}
+	switch period {
+	case "오전", "아침":
+		return hour % 12
+	case "오후", "낮", "저녁", "밤":
+		if hour == 12 {
+			if period == "밤" {
+				return 0
+			}
+			return 12
+		}
+		return hour + 12
+	default:
+		if hour >= 1 && hour <= 6 {
+			return hour + 12
+		}
+		return hour
+	}
+}
+
+func applyNamedTime(e *expression, match []string) error {
+	if match[0] == "noon" || match[0] == "정오" {
+		return e.setTime(12, 0)
+	}
+	return e.setTime(0, 0)
+}
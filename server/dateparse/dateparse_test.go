@@ -0,0 +1,68 @@
+package dateparse
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	seoul, err := time.LoadLocation("Asia/Seoul")
+	require.NoError(t, err)
+	// Wednesday
+	now := time.Date(2021, 11, 3, 14, 20, 0, 0, seoul)
+
+	for text, expected := range map[string]string{
+		"2021-11-05 09:00":   "2021-11-05 09:00",
+		"2021.11.05":         "2021-11-05 09:00",
+		"11/5 6pm":           "2021-11-05 18:00",
+		"nov 5th at 10:30":   "2021-11-05 10:30",
+		"3 jan":              "2022-01-03 09:00",
+		"today 5pm":          "2021-11-03 17:00",
+		"tonight":            "2021-11-03 20:00",
+		"tomorrow 9am":       "2021-11-04 09:00",
+		"Tomorrow at 12pm":   "2021-11-04 12:00",
+		"day after tomorrow": "2021-11-05 09:00",
+		"fri":                "2021-11-05 09:00",
+		"wednesday 18:00":    "2021-11-03 18:00",
+		"this monday":        "2021-11-01 09:00",
+		"next fri 18:00":     "2021-11-12 18:00",
+		"next week":          "2021-11-08 09:00",
+		"in 3 days":          "2021-11-06 14:20",
+		"in 2 hours":         "2021-11-03 16:20",
+		"in an hour":         "2021-11-03 15:20",
+		"in 1 week at noon":  "2021-11-10 12:00",
+		"9am":                "2021-11-04 09:00",
+		"3pm":                "2021-11-03 15:00",
+		"midnight":           "2021-11-04 00:00",
+		"내일 오후 3시":           "2021-11-04 15:00",
+		"내일오전10시반":           "2021-11-04 10:30",
+		"모레 3시":              "2021-11-05 15:00",
+		"오늘 밤 11시":           "2021-11-03 23:00",
+		"다음주 월요일":            "2021-11-08 09:00",
+		"이번주 금요일 오후 6시":      "2021-11-05 18:00",
+		"다다음주 화요일":           "2021-11-16 09:00",
+		"금요일 정오":             "2021-11-05 12:00",
+		"11월 5일 오후 2시 30분":   "2021-11-05 14:30",
+		"2022년 1월 3일":        "2022-01-03 09:00",
+		"3일 후":               "2021-11-06 14:20",
+		"2시간 뒤":              "2021-11-03 16:20",
+		"다음주":                "2021-11-08 09:00",
+		"내일 18:00까지":         "2021-11-04 18:00",
+		"오후 3:30":            "2021-11-03 15:30",
+	} {
+		t.Run(text, func(t *testing.T) {
+			parsed, err := Parse(text, now)
+			require.NoError(t, err)
+			assert.Equal(t, expected, parsed.Format("2006-01-02 15:04"))
+			assert.Equal(t, seoul, parsed.Location())
+		})
+	}
+
+	for _, text := range []string{"", "soon", "at", "tomorrow tomorrow", "2021-02-30", "25:00", "13pm", "in 2 hours tomorrow", "내일 모레"} {
+		_, err := Parse(text, now)
+		assert.Error(t, err, text)
+	}
+}
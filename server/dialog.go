@@ -0,0 +1,235 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/pkg/errors"
+)
+
+// Callback ids of the dialogs, which tell their submissions apart.
+const (
+	createNoticeCallbackId = "create_notice"
+	editNoticeCallbackId   = "edit_notice"
+
+	// legacyCreateNoticeCallbackId was the callback id of every dialog, before there was more
+	// than one. Create dialogs left open during an upgrade still use it.
+	legacyCreateNoticeCallbackId = "somecallbackid"
+)
+
+// dialogConfirmationExpiry is how long a user has to confirm the times they typed in words.
+const dialogConfirmationExpiry = 10 * time.Minute
+
+type DialogHandlerFunc func(p *Plugin, w http.ResponseWriter, r *http.Request, dialogForm DialogForm)
+
+type DialogHandler struct {
+	handlers map[string]DialogHandlerFunc
+}
+
+// mbotcDialogHandler routes dialog submissions by the callback id of the dialog.
+var mbotcDialogHandler = DialogHandler{
+	handlers: map[string]DialogHandlerFunc{
+		createNoticeCallbackId:       handleCreateNoticeDialog,
+		legacyCreateNoticeCallbackId: handleCreateNoticeDialog,
+		editNoticeCallbackId:         handleEditNoticeDialog,
+	},
+}
+
+func (dh DialogHandler) Handle(p *Plugin, w http.ResponseWriter, r *http.Request, dialogForm DialogForm) {
+	h := dh.handlers[dialogForm.CallbackId]
+	if h == nil {
+		p.loggerFromContext(r.Context()).Warn("Received submission of an unknown dialog", "callback_id", dialogForm.CallbackId)
+		writeDialogError(w, "This dialog can't be submitted anymore. Please open it again.")
+		return
+	}
+	h(p, w, r, dialogForm)
+}
+
+// handleDialog dispatches the submissions of all dialogs, which are opened with openDialog. The
+// submitting user is the one Mattermost authenticated, never the user id of the submission body.
+func (p *Plugin) handleDialog(w http.ResponseWriter, r *http.Request) {
+	log := p.loggerFromContext(r.Context())
+	dialogForm, err := DecodeDialogForm(r)
+	if err != nil {
+		log.Warn("Failed to read dialog submission", "err", err.Error())
+		http.Error(w, "Invalid dialog submission", http.StatusBadRequest)
+		return
+	}
+
+	userId := r.Header.Get("Mattermost-User-ID")
+	if dialogForm.UserId != "" && dialogForm.UserId != userId {
+		log.Warn("Rejected dialog submission for another user", "callback_id", dialogForm.CallbackId, "submitted_user_id", dialogForm.UserId)
+		http.Error(w, "Not authorized", http.StatusForbidden)
+		return
+	}
+	dialogForm.UserId = userId
+	mbotcDialogHandler.Handle(p, w, r, dialogForm)
+}
+
+// editNoticeState is the state of the edit dialog. Edit dialogs opened before it existed have the
+// bare notice id as their state.
+type editNoticeState struct {
+	NoticeId string `json:"notice_id"`
+}
+
+// encodeDialogState serializes the state of a dialog into model.Dialog.State.
+func encodeDialogState(state interface{}) string {
+	data, _ := json.Marshal(state)
+	return string(data)
+}
+
+// decodeDialogState reads the state of a submitted dialog, as written by encodeDialogState.
+func decodeDialogState(dialogForm DialogForm, state interface{}) error {
+	if err := json.Unmarshal([]byte(dialogForm.State), state); err != nil {
+		return errors.Wrapf(err, "invalid state of dialog %s", dialogForm.CallbackId)
+	}
+	return nil
+}
+
+// handleCreateNoticeDialog publishes the notice of a create dialog in the channel it was opened in.
+func handleCreateNoticeDialog(p *Plugin, w http.ResponseWriter, r *http.Request, dialogForm DialogForm) {
+	p.submitNoticeDialog(w, r, dialogForm, nil)
+}
+
+// handleEditNoticeDialog applies an edit dialog to its notice.
+func handleEditNoticeDialog(p *Plugin, w http.ResponseWriter, r *http.Request, dialogForm DialogForm) {
+	log := p.loggerFromContext(r.Context()).With("user_id", dialogForm.UserId)
+
+	var state editNoticeState
+	if model.IsValidId(dialogForm.State) {
+		state.NoticeId = dialogForm.State
+	} else if err := decodeDialogState(dialogForm, &state); err != nil {
+		log.Warn("Rejected notice edit", "err", err.Error())
+		writeDialogError(w, "This dialog can't be submitted anymore. Please open it again.")
+		return
+	}
+	previous, message := p.getEditedNotice(state.NoticeId, dialogForm.UserId)
+	if previous == nil {
+		log.Warn("Rejected notice edit", "notice_id", state.NoticeId, "reason", message)
+		writeDialogError(w, message)
+		return
+	}
+	p.submitNoticeDialog(w, r, dialogForm, previous)
+}
+
+// submitNoticeDialog creates a notice submitted through the create dialog, or applies the edit
+// dialog to previous. Invalid fields are reported with a dialog response, which keeps the dialog
+// open with the user's input.
+func (p *Plugin) submitNoticeDialog(w http.ResponseWriter, r *http.Request, dialogForm DialogForm, previous *Notice) {
+	log := p.loggerFromContext(r.Context()).With("user_id", dialogForm.UserId, "channel_id", dialogForm.ChannelId)
+	if previous != nil {
+		log = log.With("notice_id", previous.Id)
+	}
+
+	notice, err := ConvertDialogForm(dialogForm)
+	if errs, ok := asValidationErrors(err); ok {
+		writeDialogValidationErrors(w, errs)
+		return
+	}
+	if err != nil {
+		log.Debug("Rejected invalid notice", "err", err.Error())
+		writeDialogError(w, "Invalid notice.")
+		return
+	}
+	if previous != nil {
+		// The edit dialog may be submitted from another channel than the notice's.
+		notice.TeamId, notice.ChannelId = previous.TeamId, previous.ChannelId
+	}
+	// The times are entered in the timezone of the user submitting the dialog.
+	entered := notice
+	if errs := p.validateNotice(&notice, noticeValidation{
+		Now:      time.Now(),
+		Previous: previous,
+	}); errs != nil {
+		log.Debug("Rejected invalid notice", "err", errs.Error())
+		writeDialogValidationErrors(w, errs)
+		return
+	}
+
+	// Times typed in words are shown as understood next to their field, and the notice is only
+	// posted once the user submits the dialog again unchanged.
+	if resolved := resolvedTimes(entered, notice); len(resolved) > 0 {
+		confirmed, err := p.store.ConfirmDialogSubmission(dialogForm.UserId, dialogSubmissionDigest(dialogForm, resolved), dialogConfirmationExpiry)
+		if err == ErrDialogAlreadyConfirmed {
+			// The same submission was confirmed twice at once, and the other request posts it.
+			return
+		}
+		if err != nil {
+			log.Error("Failed to confirm dialog times", "err", err.Error())
+			writeDialogError(w, "Failed to check the dates. Please try again later.")
+			return
+		}
+		if !confirmed {
+			fields := map[string]string{}
+			for field, t := range resolved {
+				fields[field] = "Understood as " + t + ". Submit again to confirm."
+			}
+			writeDialogResponse(w, &model.SubmitDialogResponse{Errors: fields})
+			return
+		}
+	}
+
+	if previous != nil {
+		if err := p.editNotice(previous, notice, dialogForm.UserId); err != nil {
+			log.Error("Failed to edit notice", "err", err.Error())
+			writeDialogError(w, "Failed to update the notice. Please try again later.")
+		}
+		return
+	}
+
+	if err := p.publishNotice(&notice); err != nil {
+		log.Error("Failed to publish notice", "err", err.Error())
+		writeDialogError(w, "Failed to create the notice. Please try again later.")
+	}
+}
+
+// dialogSubmissionDigest identifies a submission of a dialog, with the times it was understood
+// to have, so that a confirmed submission is the one that was shown.
+func dialogSubmissionDigest(dialogForm DialogForm, resolved map[string]string) string {
+	data, _ := json.Marshal(struct {
+		CallbackId string            `json:"callback_id"`
+		State      string            `json:"state"`
+		ChannelId  string            `json:"channel_id"`
+		Submission Sub               `json:"submission"`
+		Resolved   map[string]string `json:"resolved"`
+	}{dialogForm.CallbackId, dialogForm.State, dialogForm.ChannelId, dialogForm.Submission, resolved})
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// getEditedNotice gets a notice if the user may still edit it, and otherwise the message to
+// show in the edit dialog.
+func (p *Plugin) getEditedNotice(noticeId, userId string) (*Notice, string) {
+	notice, err := p.store.GetNotice(noticeId)
+	if err != nil {
+		return nil, "The notice you edited doesn't exist anymore."
+	}
+	if notice.DeleteAt != 0 {
+		return nil, "The notice you edited was cancelled."
+	}
+	if notice.UserId != userId {
+		return nil, "Only the author can edit this notice."
+	}
+	return notice, ""
+}
+
+// writeDialogValidationErrors answers a dialog submission with the errors shown next to the
+// fields they are about, and the others at the bottom of the dialog.
+func writeDialogValidationErrors(w http.ResponseWriter, errs ValidationErrors) {
+	fields, general := errs.DialogErrors()
+	writeDialogResponse(w, &model.SubmitDialogResponse{Error: general, Errors: fields})
+}
+
+// writeDialogError answers a dialog submission with an error shown at the bottom of the dialog.
+func writeDialogError(w http.ResponseWriter, text string) {
+	writeDialogResponse(w, &model.SubmitDialogResponse{Error: text})
+}
+
+func writeDialogResponse(w http.ResponseWriter, response *model.SubmitDialogResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(response.ToJson())
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/mattermost/mattermost-server/v5/plugin/plugintest/mock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDialogHandler(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	api := newKVAPI()
+	api.On("GetUser", mock.Anything).Return(&model.User{Id: "user1", Username: "alice"}, nil)
+	api.On("GetChannelMember", "channel1", "user1").Return(&model.ChannelMember{}, nil)
+	api.On("HasPermissionToChannel", "user1", "channel1", model.PERMISSION_CREATE_POST).Return(true)
+	api.On("GetChannel", "channel1").Return(&model.Channel{Id: "channel1", TeamId: "team1"}, nil)
+	api.On("GetTeam", "team1").Return(&model.Team{Id: "team1"}, nil)
+	api.On("CreatePost", mock.Anything).Return(func(post *model.Post) *model.Post {
+		post.Id = model.NewId()
+		return post
+	}, nil)
+	api.On("GetPost", mock.Anything).Return(&model.Post{}, nil)
+	api.On("UpdatePost", mock.Anything).Return(&model.Post{}, nil)
+
+	p := &Plugin{botUserID: "bot"}
+	p.SetAPI(api)
+	p.store = NewStore(p)
+	p.backend = &fakeBackend{}
+	p.setConfiguration(&configuration{ReminderLeadTimes: noRemindersSpec})
+	p.router = p.initRouter()
+
+	submit := func(dialogForm DialogForm) string {
+		body, err := json.Marshal(dialogForm)
+		require.NoError(err)
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/mm", bytes.NewReader(body))
+		r.Header.Set("Mattermost-User-ID", "user1")
+		p.ServeHTTP(nil, w, r)
+		require.Equal(http.StatusOK, w.Result().StatusCode)
+		return w.Body.String()
+	}
+	start := time.Now().AddDate(1, 0, 0).Format(noticeTimeLayout)
+
+	response := submit(DialogForm{CallbackId: "unknown", UserId: "user1", ChannelId: "channel1"})
+	assert.Contains(response, "can't be submitted anymore")
+
+	for _, callbackId := range []string{createNoticeCallbackId, legacyCreateNoticeCallbackId} {
+		response = submit(DialogForm{CallbackId: callbackId, UserId: "user1", ChannelId: "channel1", Submission: Sub{StartTime: start, Content: callbackId}})
+		assert.Empty(response, callbackId)
+	}
+	notices, err := p.store.ListNoticesByChannel("channel1")
+	require.NoError(err)
+	require.Len(notices, 2)
+
+	dialog := getEditDialog(notices[0], time.Local)
+	assert.Equal(editNoticeCallbackId, dialog.CallbackId)
+	response = submit(DialogForm{CallbackId: dialog.CallbackId, State: dialog.State, UserId: "user1", ChannelId: "elsewhere", Submission: Sub{StartTime: start, Content: "edited"}})
+	assert.Empty(response)
+	edited, err := p.store.GetNotice(notices[0].Id)
+	require.NoError(err)
+	assert.Equal("edited", edited.Message)
+	assert.Equal("channel1", edited.ChannelId)
+
+	// Edit dialogs opened before the state was encoded have the notice id as their state.
+	response = submit(DialogForm{CallbackId: editNoticeCallbackId, State: notices[0].Id, UserId: "user1", ChannelId: "channel1", Submission: Sub{StartTime: start, Content: "edited again"}})
+	assert.Empty(response)
+	edited, err = p.store.GetNotice(notices[0].Id)
+	require.NoError(err)
+	assert.Equal("edited again", edited.Message)
+
+	response = submit(DialogForm{CallbackId: editNoticeCallbackId, State: "{not json", UserId: "user1", ChannelId: "channel1"})
+	assert.Contains(response, "can't be submitted anymore")
+
+	// Times typed in words are confirmed before the notice is posted.
+	natural := DialogForm{CallbackId: createNoticeCallbackId, UserId: "user1", ChannelId: "channel1", Submission: Sub{StartTime: "tomorrow 9am", Content: "natural"}}
+	response = submit(natural)
+	assert.Contains(response, "Understood as ")
+	assert.Contains(response, "Submit again to confirm.")
+	notices, err = p.store.ListNoticesByChannel("channel1")
+	require.NoError(err)
+	assert.Len(notices, 2)
+
+	changed := natural
+	changed.Submission.Content = "changed"
+	assert.Contains(submit(changed), "Submit again to confirm.")
+	assert.Empty(submit(changed))
+	notices, err = p.store.ListNoticesByChannel("channel1")
+	require.NoError(err)
+	assert.Len(notices, 3)
+
+	// The submitting user is the one authenticated by Mattermost.
+	body, err := json.Marshal(DialogForm{CallbackId: createNoticeCallbackId, UserId: "user2", ChannelId: "channel1", Submission: Sub{StartTime: start, Content: "forged"}})
+	require.NoError(err)
+	r := httptest.NewRequest(http.MethodPost, "/mm", bytes.NewReader(body))
+	r.Header.Set("Mattermost-User-ID", "user1")
+	w := httptest.NewRecorder()
+	p.ServeHTTP(nil, w, r)
+	assert.Equal(http.StatusForbidden, w.Result().StatusCode)
+
+	w = httptest.NewRecorder()
+	p.ServeHTTP(nil, w, httptest.NewRequest(http.MethodPost, "/mm", bytes.NewReader(body)))
+	assert.Equal(http.StatusUnauthorized, w.Result().StatusCode)
+	notices, err = p.store.ListNoticesByChannel("channel1")
+	require.NoError(err)
+	assert.Len(notices, 3)
+}
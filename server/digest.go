@@ -0,0 +1,465 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost-plugin-api/cluster"
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/mattermost/mattermost-server/v5/plugin"
+	"github.com/pkg/errors"
+)
+
+const (
+	digestJobKey   = "digest_job"
+	digestInterval = time.Minute
+
+	// digestMaxDelay bounds how late a digest is still posted, e.g. after the plugin was down.
+	digestMaxDelay = 2 * time.Hour
+
+	// digestTimeLayout is the format of the time of day digests are posted at.
+	digestTimeLayout  = "15:04"
+	defaultDigestTime = "08:30"
+
+	digestUsage     = "Usage: `/mbotc digest [on [--at 08:30] [--timezone Asia/Seoul] | off]`"
+	userDigestUsage = "Usage: `/mbotc digest me [on [--at 08:30] | off]`"
+
+	// userDigestOverdueDays is how far back a personal digest looks for deadlines the user
+	// didn't acknowledge.
+	userDigestOverdueDays = 7
+)
+
+// ChannelDigest is the subscription of a channel to a daily post of its notices of the day.
+type ChannelDigest struct {
+	ChannelId string `json:"channel_id"`
+	// UserId is the user who turned the digest on.
+	UserId string `json:"user_id"`
+	// At is the time of day the digest is posted, in TimeZone.
+	At       string `json:"at"`
+	TimeZone string `json:"time_zone"`
+	// LastDay is the last day, in TimeZone, the digest was posted for.
+	LastDay string `json:"last_day,omitempty"`
+}
+
+// UserDigest is the subscription of a user to a daily direct message with their notices, at a
+// time of day in their timezone.
+type UserDigest struct {
+	UserId string `json:"user_id"`
+	At     string `json:"at"`
+	// LastDay is the last day, in the timezone of the user, the digest was sent for.
+	LastDay string `json:"last_day,omitempty"`
+}
+
+func executeDigest(p *Plugin, c *plugin.Context, header *model.CommandArgs, args ...string) *model.CommandResponse {
+	if len(args) > 0 {
+		p.postCommandResponse(header, digestUsage)
+		return &model.CommandResponse{}
+	}
+
+	digest, err := p.store.GetChannelDigest(header.ChannelId)
+	if err == ErrChannelDigestNotFound {
+		p.postCommandResponse(header, "This channel has no daily digest. Turn it on with `/mbotc digest on --at 08:30`.")
+		return &model.CommandResponse{}
+	}
+	if err != nil {
+		p.API.LogError("Failed to get channel digest", "channel_id", header.ChannelId, "err", err.Error())
+		p.postCommandResponse(header, "Failed to get the digest of this channel. Please try again later.")
+		return &model.CommandResponse{}
+	}
+	p.postCommandResponse(header, describeChannelDigest(digest))
+	return &model.CommandResponse{}
+}
+
+func executeDigestOn(p *Plugin, c *plugin.Context, header *model.CommandArgs, args ...string) *model.CommandResponse {
+	flags, positional, err := parseCommandFlags(args, "at", "timezone")
+	if err != nil || len(positional) > 0 {
+		p.postCommandResponse(header, digestUsage)
+		return &model.CommandResponse{}
+	}
+	if errs := p.validateNoticeChannel(header.UserId, header.ChannelId); errs != nil {
+		p.postCommandResponse(header, errs[0].Message)
+		return &model.CommandResponse{}
+	}
+
+	at, problem := parseDigestTime(flags)
+	if problem != "" {
+		p.postCommandResponse(header, problem)
+		return &model.CommandResponse{}
+	}
+	digest := &ChannelDigest{ChannelId: header.ChannelId, UserId: header.UserId, At: at}
+	loc := p.userLocation(header.UserId)
+	if name, ok := flags["timezone"]; ok {
+		if loc, err = time.LoadLocation(name); err != nil || name == "" {
+			p.postCommandResponse(header, fmt.Sprintf("Unknown timezone `%s`. Use a timezone such as `Asia/Seoul`.", name))
+			return &model.CommandResponse{}
+		}
+	}
+	if loc != time.Local {
+		digest.TimeZone = loc.String()
+	}
+
+	// A digest turned on after its time starts on the next working day.
+	now := time.Now().In(loc)
+	if due, _ := digestDueTime(digest.At, now); !now.Before(due) {
+		digest.LastDay = now.Format(listingDayLayout)
+	}
+
+	if err := p.store.SaveChannelDigest(digest); err != nil {
+		p.API.LogError("Failed to save channel digest", "channel_id", header.ChannelId, "err", err.Error())
+		p.postCommandResponse(header, "Failed to turn on the digest. Please try again later.")
+		return &model.CommandResponse{}
+	}
+	p.postCommandResponse(header, describeChannelDigest(digest))
+	return &model.CommandResponse{}
+}
+
+func executeDigestOff(p *Plugin, c *plugin.Context, header *model.CommandArgs, args ...string) *model.CommandResponse {
+	if errs := p.validateNoticeChannel(header.UserId, header.ChannelId); errs != nil {
+		p.postCommandResponse(header, errs[0].Message)
+		return &model.CommandResponse{}
+	}
+	if err := p.store.DeleteChannelDigest(header.ChannelId); err != nil {
+		p.API.LogError("Failed to delete channel digest", "channel_id", header.ChannelId, "err", err.Error())
+		p.postCommandResponse(header, "Failed to turn off the digest. Please try again later.")
+		return &model.CommandResponse{}
+	}
+	p.postCommandResponse(header, "The daily digest of this channel is turned off.")
+	return &model.CommandResponse{}
+}
+
+func executeUserDigest(p *Plugin, c *plugin.Context, header *model.CommandArgs, args ...string) *model.CommandResponse {
+	if len(args) > 0 {
+		p.postCommandResponse(header, userDigestUsage)
+		return &model.CommandResponse{}
+	}
+
+	digest, err := p.store.GetUserDigest(header.UserId)
+	if err == ErrUserDigestNotFound {
+		p.postCommandResponse(header, "You have no personal digest. Turn it on with `/mbotc digest me on --at 08:30`.")
+		return &model.CommandResponse{}
+	}
+	if err != nil {
+		p.API.LogError("Failed to get user digest", "user_id", header.UserId, "err", err.Error())
+		p.postCommandResponse(header, "Failed to get your digest. Please try again later.")
+		return &model.CommandResponse{}
+	}
+	p.postCommandResponse(header, describeUserDigest(digest))
+	return &model.CommandResponse{}
+}
+
+func executeUserDigestOn(p *Plugin, c *plugin.Context, header *model.CommandArgs, args ...string) *model.CommandResponse {
+	flags, positional, err := parseCommandFlags(args, "at")
+	if err != nil || len(positional) > 0 {
+		p.postCommandResponse(header, userDigestUsage)
+		return &model.CommandResponse{}
+	}
+
+	at, problem := parseDigestTime(flags)
+	if problem != "" {
+		p.postCommandResponse(header, problem)
+		return &model.CommandResponse{}
+	}
+	digest := &UserDigest{UserId: header.UserId, At: at}
+
+	now := time.Now().In(p.userLocation(header.UserId))
+	if due, _ := digestDueTime(digest.At, now); !now.Before(due) {
+		digest.LastDay = now.Format(listingDayLayout)
+	}
+
+	if err := p.store.SaveUserDigest(digest); err != nil {
+		p.API.LogError("Failed to save user digest", "user_id", header.UserId, "err", err.Error())
+		p.postCommandResponse(header, "Failed to turn on your digest. Please try again later.")
+		return &model.CommandResponse{}
+	}
+	p.postCommandResponse(header, describeUserDigest(digest))
+	return &model.CommandResponse{}
+}
+
+func executeUserDigestOff(p *Plugin, c *plugin.Context, header *model.CommandArgs, args ...string) *model.CommandResponse {
+	if err := p.store.DeleteUserDigest(header.UserId); err != nil {
+		p.API.LogError("Failed to delete user digest", "user_id", header.UserId, "err", err.Error())
+		p.postCommandResponse(header, "Failed to turn off your digest. Please try again later.")
+		return &model.CommandResponse{}
+	}
+	p.postCommandResponse(header, "Your personal digest is turned off.")
+	return &model.CommandResponse{}
+}
+
+// parseDigestTime reads the --at flag of the digest commands, or tells why it is invalid.
+func parseDigestTime(flags map[string]string) (at, problem string) {
+	at, ok := flags["at"]
+	if !ok {
+		return defaultDigestTime, ""
+	}
+	t, err := time.Parse(digestTimeLayout, at)
+	if err != nil {
+		return "", fmt.Sprintf("Can't read the time `%s`. Use a time such as `08:30`.", at)
+	}
+	return t.Format(digestTimeLayout), ""
+}
+
+func describeUserDigest(digest *UserDigest) string {
+	return fmt.Sprintf("Every working day at %s in your timezone, I will send you the notices of the day and the deadlines you missed, "+
+		"from all your channels. Turn it off with `/mbotc digest me off`.", digest.At)
+}
+
+func describeChannelDigest(digest *ChannelDigest) string {
+	return fmt.Sprintf("Every working day at %s (%s), the notices of the day are posted in this channel. "+
+		"Turn it off with `/mbotc digest off`.", digest.At, loadLocation(digest.TimeZone).String())
+}
+
+// startDigests schedules the cluster-wide job posting due digests.
+func (p *Plugin) startDigests() error {
+	job, err := cluster.Schedule(p.API, digestJobKey, cluster.MakeWaitForInterval(digestInterval), p.postDueDigests)
+	if err != nil {
+		return errors.Wrap(err, "failed to schedule digest job")
+	}
+	p.digestJob = job
+	return nil
+}
+
+// stopDigests stops the digest job on this node.
+func (p *Plugin) stopDigests() error {
+	if p.digestJob == nil {
+		return nil
+	}
+	return p.digestJob.Close()
+}
+
+// postDueDigests posts every due digest. It runs on one cluster node at a time.
+func (p *Plugin) postDueDigests() {
+	p.postDigests(time.Now())
+}
+
+func (p *Plugin) postDigests(now time.Time) {
+	p.postChannelDigests(now)
+	p.sendUserDigests(now)
+}
+
+func (p *Plugin) postChannelDigests(now time.Time) {
+	digests, err := p.store.ListChannelDigests()
+	if err != nil {
+		p.API.LogError("Failed to list channel digests", "err", err.Error())
+		return
+	}
+
+	for _, digest := range digests {
+		day, ok := digestDay(digest.At, now.In(loadLocation(digest.TimeZone)), digest.LastDay)
+		if !ok {
+			continue
+		}
+		// The day is claimed before posting, so that a digest is never posted twice.
+		claimed, err := p.store.ClaimChannelDigest(digest.ChannelId, day.Format(listingDayLayout))
+		if err != nil {
+			p.API.LogError("Failed to claim channel digest", "channel_id", digest.ChannelId, "err", err.Error())
+			continue
+		}
+		if !claimed {
+			continue
+		}
+		if err := p.postChannelDigest(digest, day); err != nil {
+			p.API.LogError("Failed to post channel digest", "channel_id", digest.ChannelId, "err", err.Error())
+		}
+	}
+}
+
+func (p *Plugin) sendUserDigests(now time.Time) {
+	digests, err := p.store.ListUserDigests()
+	if err != nil {
+		p.API.LogError("Failed to list user digests", "err", err.Error())
+		return
+	}
+
+	for _, digest := range digests {
+		localNow := now.In(p.userLocation(digest.UserId))
+		day, ok := digestDay(digest.At, localNow, digest.LastDay)
+		if !ok {
+			continue
+		}
+		claimed, err := p.store.ClaimUserDigest(digest.UserId, day.Format(listingDayLayout))
+		if err != nil {
+			p.API.LogError("Failed to claim user digest", "user_id", digest.UserId, "err", err.Error())
+			continue
+		}
+		if !claimed {
+			continue
+		}
+		if err := p.sendUserDigest(digest.UserId, localNow, day); err != nil {
+			p.API.LogError("Failed to send user digest", "user_id", digest.UserId, "err", err.Error())
+		}
+	}
+}
+
+// digestDay returns the start of the day a digest at the time of day is due for, given now in
+// the timezone of the digest. Digests are posted on working days only, and at most
+// digestMaxDelay late.
+func digestDay(at string, now time.Time, lastDay string) (time.Time, bool) {
+	if now.Weekday() == time.Saturday || now.Weekday() == time.Sunday {
+		return time.Time{}, false
+	}
+	if now.Format(listingDayLayout) == lastDay {
+		return time.Time{}, false
+	}
+	due, err := digestDueTime(at, now)
+	if err != nil || now.Before(due) || now.After(due.Add(digestMaxDelay)) {
+		return time.Time{}, false
+	}
+	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location()), true
+}
+
+// digestDueTime returns the time a digest at the time of day is due on the day of now.
+func digestDueTime(at string, now time.Time) (time.Time, error) {
+	t, err := time.Parse(digestTimeLayout, at)
+	if err != nil {
+		return time.Time{}, errors.Wrapf(err, "invalid digest time %s", at)
+	}
+	return time.Date(now.Year(), now.Month(), now.Day(), t.Hour(), t.Minute(), 0, 0, now.Location()), nil
+}
+
+// postChannelDigest posts the notices of the day in the channel. Nothing is posted on days
+// without notices. The digest of an archived channel is turned off.
+func (p *Plugin) postChannelDigest(digest *ChannelDigest, day time.Time) error {
+	channel, appErr := p.API.GetChannel(digest.ChannelId)
+	if appErr != nil {
+		return errors.Wrap(appErr, "failed to get channel")
+	}
+	if channel.DeleteAt != 0 {
+		p.API.LogInfo("Turned off the digest of an archived channel", "channel_id", digest.ChannelId)
+		return p.store.DeleteChannelDigest(digest.ChannelId)
+	}
+
+	next := day.AddDate(0, 0, 1)
+	occurrences, err := p.listChannelOccurrences(digest.ChannelId, day, next.Add(-time.Minute))
+	if err != nil {
+		return err
+	}
+	if len(occurrences) == 0 {
+		return nil
+	}
+
+	post := &model.Post{
+		UserId:    p.botUserID,
+		ChannelId: digest.ChannelId,
+		Message:   p.formatListing(occurrences, day, next, "in this channel", day.Location()) + "\n" + seeMoreLink(day),
+	}
+	if _, appErr := p.API.CreatePost(post); appErr != nil {
+		return errors.Wrap(appErr, "failed to create digest post")
+	}
+	return nil
+}
+
+// userDigestItem is an occurrence listed in a personal digest.
+type userDigestItem struct {
+	NoticeOccurrence
+	// Overdue is set for a deadline that passed without the user acknowledging the notice.
+	Overdue bool
+}
+
+// sendUserDigest sends the user the notices of the day that are not over yet, and the deadlines
+// of the last userDigestOverdueDays the user didn't acknowledge, from all their channels.
+// Nothing is sent if there are none.
+func (p *Plugin) sendUserDigest(userId string, now, day time.Time) error {
+	next := day.AddDate(0, 0, 1)
+	occurrences, err := p.listUserOccurrences(userId, day.AddDate(0, 0, -userDigestOverdueDays), next.Add(-time.Minute))
+	if err != nil {
+		return err
+	}
+
+	var items []userDigestItem
+	for _, occurrence := range occurrences {
+		switch {
+		case !occurrence.End.Before(now):
+			items = append(items, userDigestItem{NoticeOccurrence: occurrence})
+		case occurrence.Start.Equal(occurrence.End):
+			acked, err := p.hasAcknowledged(occurrence.Notice.Id, userId)
+			if err != nil {
+				return err
+			}
+			if !acked {
+				items = append(items, userDigestItem{NoticeOccurrence: occurrence, Overdue: true})
+			}
+		}
+	}
+	if len(items) == 0 {
+		return nil
+	}
+	return p.sendDirectMessage(userId, p.formatUserDigest(items, day))
+}
+
+// formatUserDigest renders the items of a personal digest grouped by team and channel, in the
+// timezone of day.
+func (p *Plugin) formatUserDigest(items []userDigestItem, day time.Time) string {
+	type channelItems struct {
+		name  string
+		items []userDigestItem
+	}
+	type teamItems struct {
+		name     string
+		channels map[string]*channelItems
+	}
+
+	teams := map[string]*teamItems{}
+	for _, item := range items {
+		team, ok := teams[item.Notice.TeamId]
+		if !ok {
+			team = &teamItems{name: "Direct messages", channels: map[string]*channelItems{}}
+			if item.Notice.TeamId != "" {
+				if t, appErr := p.API.GetTeam(item.Notice.TeamId); appErr == nil {
+					team.name = t.DisplayName
+				}
+			}
+			teams[item.Notice.TeamId] = team
+		}
+		channel, ok := team.channels[item.Notice.ChannelId]
+		if !ok {
+			channel = &channelItems{}
+			if c, appErr := p.API.GetChannel(item.Notice.ChannelId); appErr == nil {
+				channel.name = "~" + c.Name
+			}
+			team.channels[item.Notice.ChannelId] = channel
+		}
+		channel.items = append(channel.items, item)
+	}
+
+	sortedTeams := make([]*teamItems, 0, len(teams))
+	for _, team := range teams {
+		sortedTeams = append(sortedTeams, team)
+	}
+	sort.Slice(sortedTeams, func(i, j int) bool { return sortedTeams[i].name < sortedTeams[j].name })
+
+	loc := day.Location()
+	var b strings.Builder
+	fmt.Fprintf(&b, "#### Your notices of %s\n", day.Format("Mon "+listingDayLayout))
+	for _, team := range sortedTeams {
+		fmt.Fprintf(&b, "\n##### %s\n", team.name)
+
+		channels := make([]*channelItems, 0, len(team.channels))
+		for _, channel := range team.channels {
+			channels = append(channels, channel)
+		}
+		sort.Slice(channels, func(i, j int) bool { return channels[i].name < channels[j].name })
+
+		for _, channel := range channels {
+			fmt.Fprintf(&b, "**%s**\n", channel.name)
+			for _, item := range channel.items {
+				start, end := item.Start.In(loc), item.End.In(loc)
+				when := formatListingTime(start, end)
+				switch {
+				case item.Overdue:
+					when = ":warning: **Overdue** since " + end.Format("Mon 01-02 15:04")
+				case start.Before(day):
+					when = "Until " + end.Format("01-02 15:04")
+				}
+
+				preview := previewMessage(item.Notice.Message)
+				if item.Notice.PostId != "" {
+					preview = fmt.Sprintf("[%s](%s/_redirect/pl/%s)", preview, p.siteURL(), item.Notice.PostId)
+				}
+				fmt.Fprintf(&b, "- %s %s\n", when, preview)
+			}
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/mattermost/mattermost-server/v5/plugin/plugintest/mock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDigestDay(t *testing.T) {
+	assert := assert.New(t)
+
+	seoul := loadLocation("Asia/Seoul")
+	for name, tc := range map[string]struct {
+		now     time.Time
+		lastDay string
+		due     bool
+	}{
+		"before":          {time.Date(2021, 11, 5, 8, 29, 0, 0, seoul), "", false},
+		"on time":         {time.Date(2021, 11, 5, 8, 30, 0, 0, seoul), "2021-11-04", true},
+		"late":            {time.Date(2021, 11, 5, 10, 0, 0, 0, seoul), "", true},
+		"too late":        {time.Date(2021, 11, 5, 11, 0, 0, 0, seoul), "", false},
+		"already posted":  {time.Date(2021, 11, 5, 9, 0, 0, 0, seoul), "2021-11-05", false},
+		"on the weekend":  {time.Date(2021, 11, 6, 9, 0, 0, 0, seoul), "", false},
+		"back to working": {time.Date(2021, 11, 8, 9, 0, 0, 0, seoul), "2021-11-05", true},
+	} {
+		day, due := digestDay("08:30", tc.now, tc.lastDay)
+		assert.Equal(tc.due, due, name)
+		if due {
+			assert.Equal(time.Date(tc.now.Year(), tc.now.Month(), tc.now.Day(), 0, 0, 0, 0, seoul), day, name)
+		}
+	}
+}
+
+func TestChannelDigest(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	api := newKVAPI()
+	api.On("GetUser", "user1").Return(&model.User{Id: "user1"}, nil)
+	api.On("GetChannelMember", "channel1", "user1").Return(&model.ChannelMember{}, nil)
+	api.On("HasPermissionToChannel", "user1", "channel1", model.PERMISSION_CREATE_POST).Return(true)
+	api.On("GetChannel", "channel1").Return(&model.Channel{Id: "channel1", Name: "town-square"}, nil)
+	api.On("GetConfig").Return(&model.Config{})
+	var replies []string
+	api.On("SendEphemeralPost", "user1", mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+		replies = append(replies, args.Get(1).(*model.Post).Message)
+	})
+	var posts []*model.Post
+	api.On("CreatePost", mock.Anything).Return(&model.Post{}, nil).Run(func(args mock.Arguments) {
+		posts = append(posts, args.Get(0).(*model.Post))
+	})
+
+	p := &Plugin{botUserID: "bot"}
+	p.SetAPI(api)
+	p.store = NewStore(p)
+
+	execute := func(command string) string {
+		replies = nil
+		_, appErr := p.ExecuteCommand(nil, &model.CommandArgs{UserId: "user1", TeamId: "team1", ChannelId: "channel1", Command: command})
+		require.Nil(appErr)
+		require.Len(replies, 1)
+		return replies[0]
+	}
+
+	assert.Contains(execute("/mbotc digest"), "has no daily digest")
+	assert.Contains(execute("/mbotc digest on --at 8pm"), "Can't read the time `8pm`")
+	assert.Contains(execute("/mbotc digest on --timezone Mars/Olympus"), "Unknown timezone")
+	assert.Contains(execute("/mbotc digest on --at 08:30 --timezone Asia/Seoul"), "at 08:30 (Asia/Seoul)")
+	assert.Contains(execute("/mbotc digest"), "at 08:30 (Asia/Seoul)")
+
+	seoul := loadLocation("Asia/Seoul")
+	for _, notice := range []*Notice{
+		{TeamId: "team1", ChannelId: "channel1", Message: "Fire drill", StartTime: "2021-11-05 14:00", EndTime: "2021-11-05 14:00"},
+		{TeamId: "team1", ChannelId: "channel2", Message: "Elsewhere", StartTime: "2021-11-05 14:00", EndTime: "2021-11-05 14:00"},
+	} {
+		require.NoError(notice.localize(seoul))
+		require.NoError(p.store.CreateNotice(notice))
+	}
+	// The digest was turned on now, which may be after its time today.
+	digest, err := p.store.GetChannelDigest("channel1")
+	require.NoError(err)
+	digest.LastDay = ""
+	require.NoError(p.store.SaveChannelDigest(digest))
+
+	p.postDigests(time.Date(2021, 11, 5, 8, 0, 0, 0, seoul))
+	assert.Empty(posts)
+
+	p.postDigests(time.Date(2021, 11, 5, 8, 31, 0, 0, seoul))
+	p.postDigests(time.Date(2021, 11, 5, 8, 32, 0, 0, seoul))
+	require.Len(posts, 1)
+	assert.Equal("channel1", posts[0].ChannelId)
+	assert.Contains(posts[0].Message, "#### Notices of Fri 2021-11-05 in this channel")
+	assert.Contains(posts[0].Message, "Fire drill")
+	assert.NotContains(posts[0].Message, "Elsewhere")
+
+	// Days without notices are skipped.
+	p.postDigests(time.Date(2021, 11, 8, 8, 31, 0, 0, seoul))
+	assert.Len(posts, 1)
+
+	assert.Contains(execute("/mbotc digest off"), "turned off")
+	digests, err := p.store.ListChannelDigests()
+	require.NoError(err)
+	assert.Empty(digests)
+}
+
+func TestUserDigest(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	api := newKVAPI()
+	api.On("GetUser", "user1").Return(&model.User{Id: "user1", Timezone: map[string]string{
+		"useAutomaticTimezone": "false",
+		"manualTimezone":       "Asia/Seoul",
+	}}, nil)
+	api.On("GetChannelMember", "channel1", "user1").Return(&model.ChannelMember{}, nil)
+	api.On("GetChannelMember", "channel2", "user1").Return(&model.ChannelMember{}, nil)
+	api.On("GetChannelMember", "private", "user1").Return(nil, &model.AppError{Message: "not found"})
+	api.On("GetChannel", "channel1").Return(&model.Channel{Id: "channel1", Name: "town-square"}, nil)
+	api.On("GetChannel", "channel2").Return(&model.Channel{Id: "channel2", Name: "reports"}, nil)
+	api.On("GetTeam", "team1").Return(&model.Team{Id: "team1", DisplayName: "Beta"}, nil)
+	api.On("GetTeam", "team2").Return(&model.Team{Id: "team2", DisplayName: "Alpha"}, nil)
+	api.On("GetConfig").Return(&model.Config{ServiceSettings: model.ServiceSettings{SiteURL: model.NewString("https://mm.example.com")}})
+	api.On("GetDirectChannel", "user1", "bot").Return(&model.Channel{Id: "dm"}, nil)
+	api.On("SendEphemeralPost", "user1", mock.Anything).Return(nil)
+	var posts []*model.Post
+	api.On("CreatePost", mock.Anything).Return(&model.Post{}, nil).Run(func(args mock.Arguments) {
+		posts = append(posts, args.Get(0).(*model.Post))
+	})
+
+	p := &Plugin{botUserID: "bot"}
+	p.SetAPI(api)
+	p.store = NewStore(p)
+
+	seoul := loadLocation("Asia/Seoul")
+	notices := []*Notice{
+		{TeamId: "team1", ChannelId: "channel1", PostId: "post1", Message: "Weekly meeting", StartTime: "2021-11-05 10:00", EndTime: "2021-11-05 11:00"},
+		{TeamId: "team2", ChannelId: "channel2", Message: "Submit the report", StartTime: "2021-11-04 18:00", EndTime: "2021-11-04 18:00"},
+		{TeamId: "team2", ChannelId: "channel2", Message: "Acknowledged deadline", StartTime: "2021-11-04 18:00", EndTime: "2021-11-04 18:00"},
+		{TeamId: "team1", ChannelId: "channel1", Message: "Past event", StartTime: "2021-11-04 10:00", EndTime: "2021-11-04 11:00"},
+		{TeamId: "team1", ChannelId: "private", Message: "Secret", StartTime: "2021-11-05 10:00", EndTime: "2021-11-05 10:00"},
+	}
+	for _, notice := range notices {
+		require.NoError(notice.localize(seoul))
+		require.NoError(p.store.CreateNotice(notice))
+	}
+	_, err := p.store.AcknowledgeNotice(notices[2].Id, "user1")
+	require.NoError(err)
+
+	_, appErr := p.ExecuteCommand(nil, &model.CommandArgs{UserId: "user1", ChannelId: "channel1", Command: "/mbotc digest me on --at 08:30"})
+	require.Nil(appErr)
+	digest, err := p.store.GetUserDigest("user1")
+	require.NoError(err)
+	assert.Equal("08:30", digest.At)
+	// The digest was turned on now, which may be after its time today.
+	digest.LastDay = ""
+	require.NoError(p.store.SaveUserDigest(digest))
+
+	p.postDigests(time.Date(2021, 11, 5, 8, 31, 0, 0, seoul))
+	p.postDigests(time.Date(2021, 11, 5, 8, 32, 0, 0, seoul))
+	require.Len(posts, 1)
+	assert.Equal("dm", posts[0].ChannelId)
+	assert.Equal("#### Your notices of Fri 2021-11-05\n"+
+		"\n##### Alpha\n"+
+		"**~reports**\n"+
+		"- :warning: **Overdue** since Thu 11-04 18:00 Submit the report\n"+
+		"\n##### Beta\n"+
+		"**~town-square**\n"+
+		"- 10:00–11:00 [Weekly meeting](https://mm.example.com/_redirect/pl/post1)\n",
+		posts[0].Message)
+}
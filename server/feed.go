@@ -0,0 +1,278 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gorilla/mux"
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/mattermost/mattermost-server/v5/plugin"
+	"github.com/pkg/errors"
+
+	"github.com/mattermost/mattermost-plugin-starter-template/server/ical"
+)
+
+const (
+	calendarProductId = "-//MBotC//Mattermost Plugin//EN"
+
+	// maxEventSummaryLength is the number of characters of the notice kept in event summaries.
+	maxEventSummaryLength = 80
+)
+
+// handleChannelCalendar serves the notices of a channel as an iCalendar feed. The owner of the
+// feed token must be a member of the channel.
+func (p *Plugin) handleChannelCalendar(w http.ResponseWriter, r *http.Request) {
+	log := p.loggerFromContext(r.Context())
+	channelId := mux.Vars(r)["id"]
+
+	userId, ok := p.authenticateFeedRequest(w, r)
+	if !ok {
+		return
+	}
+	if _, appErr := p.API.GetChannelMember(channelId, userId); appErr != nil {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	channel, appErr := p.API.GetChannel(channelId)
+	if appErr != nil {
+		log.Error("Failed to get channel", "channel_id", channelId, "err", appErr.Error())
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	notices, err := p.store.ListNoticesByChannel(channelId)
+	if err != nil {
+		log.Error("Failed to list channel notices", "channel_id", channelId, "err", err.Error())
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	name := channel.DisplayName
+	if name == "" {
+		name = channel.Name
+	}
+	p.writeCalendar(w, r, "MBotC ~"+name, notices)
+}
+
+// handleUserCalendar serves the notices of every channel the user is a member of as an
+// iCalendar feed. Users can only read their own feed.
+func (p *Plugin) handleUserCalendar(w http.ResponseWriter, r *http.Request) {
+	log := p.loggerFromContext(r.Context())
+
+	userId, ok := p.authenticateFeedRequest(w, r)
+	if !ok {
+		return
+	}
+	if userId != mux.Vars(r)["id"] {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	notices, err := p.listUserChannelNotices(userId)
+	if err != nil {
+		log.Error("Failed to list user notices", "err", err.Error())
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	p.writeCalendar(w, r, "MBotC", notices)
+}
+
+// authenticateFeedRequest returns the owner of the feed token of the request. Calendar apps
+// don't have a Mattermost session, so the token is passed in the URL.
+func (p *Plugin) authenticateFeedRequest(w http.ResponseWriter, r *http.Request) (string, bool) {
+	userId, err := p.store.GetFeedTokenUser(r.URL.Query().Get("token"))
+	if err != nil {
+		p.loggerFromContext(r.Context()).Error("Failed to check feed token", "err", err.Error())
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return "", false
+	}
+	if userId == "" {
+		http.Error(w, "Not authorized", http.StatusUnauthorized)
+		return "", false
+	}
+	return userId, true
+}
+
+// listUserChannelNotices returns the notices of every channel the user is a member of.
+func (p *Plugin) listUserChannelNotices(userId string) ([]*Notice, error) {
+	teams, appErr := p.API.GetTeamsForUser(userId)
+	if appErr != nil {
+		return nil, errors.Wrap(appErr, "failed to get teams")
+	}
+
+	seen := map[string]bool{}
+	var notices []*Notice
+	for _, team := range teams {
+		channels, appErr := p.API.GetChannelsForTeamForUser(team.Id, userId, false)
+		if appErr != nil {
+			return nil, errors.Wrapf(appErr, "failed to get channels of team %s", team.Id)
+		}
+
+		for _, channel := range channels {
+			// Direct and group messages are listed for every team.
+			if seen[channel.Id] {
+				continue
+			}
+			seen[channel.Id] = true
+
+			channelNotices, err := p.store.ListNoticesByChannel(channel.Id)
+			if err != nil {
+				return nil, err
+			}
+			notices = append(notices, channelNotices...)
+		}
+	}
+	return notices, nil
+}
+
+func (p *Plugin) writeCalendar(w http.ResponseWriter, r *http.Request, name string, notices []*Notice) {
+	calendar := &ical.Calendar{ProductId: calendarProductId, Name: name}
+	for _, notice := range notices {
+		event, err := p.noticeEvent(notice)
+		if err != nil {
+			p.loggerFromContext(r.Context()).Warn("Skipped notice in calendar feed", "notice_id", notice.Id, "err", err.Error())
+			continue
+		}
+		calendar.Events = append(calendar.Events, event)
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	if err := calendar.Encode(w); err != nil {
+		p.loggerFromContext(r.Context()).Warn("Failed to write calendar feed", "err", err.Error())
+	}
+}
+
+// noticeEvent converts a notice to a calendar event with an alarm for each reminder.
+func (p *Plugin) noticeEvent(notice *Notice) (*ical.Event, error) {
+	start, end, err := notice.period()
+	if err != nil {
+		return nil, err
+	}
+	leadTimes, err := parseLeadTimes(p.reminderSpec(notice))
+	if err != nil {
+		return nil, err
+	}
+
+	siteURL := p.siteURL()
+	summary := noticeSummary(notice.Message)
+	event := &ical.Event{
+		UID:          notice.Id + "@mbotc",
+		Created:      model.GetTimeForMillis(notice.CreateAt),
+		LastModified: model.GetTimeForMillis(notice.UpdateAt),
+		Start:        start,
+		End:          end,
+		Summary:      summary,
+		Description:  notice.Message,
+	}
+	if notice.PostId != "" {
+		event.URL = siteURL + "/_redirect/pl/" + notice.PostId
+	}
+	for _, fileId := range notice.FileIds {
+		event.Attachments = append(event.Attachments, siteURL+"/api/v4/files/"+fileId)
+	}
+	for _, leadTime := range leadTimes {
+		event.Alarms = append(event.Alarms, ical.Alarm{Before: leadTime, Description: summary})
+	}
+
+	if notice.Recurrence != nil {
+		event.RRule = icalRecurrenceRule(notice.Recurrence, start)
+		hour, min, _ := start.Clock()
+		for _, exception := range notice.Recurrence.Exceptions {
+			day, err := time.ParseInLocation(recurrenceDateLayout, exception, start.Location())
+			if err != nil {
+				continue
+			}
+			event.ExDates = append(event.ExDates, day.Add(time.Duration(hour)*time.Hour+time.Duration(min)*time.Minute))
+		}
+	}
+
+	return event, nil
+}
+
+// icalRecurrenceRule formats the rule for an event starting at start. RFC 5545 requires UNTIL to
+// be a UTC date-time when the event starts at a date-time.
+func icalRecurrenceRule(rule *RecurrenceRule, start time.Time) string {
+	withoutUntil := *rule
+	withoutUntil.Until = ""
+	value := withoutUntil.String()
+
+	if rule.Until != "" {
+		if day, err := time.ParseInLocation(recurrenceDateLayout, rule.Until, start.Location()); err == nil {
+			value += ";UNTIL=" + day.AddDate(0, 0, 1).Add(-time.Second).UTC().Format("20060102T150405Z")
+		}
+	}
+	return value
+}
+
+// noticeSummary returns the first line of the message, cut to maxEventSummaryLength characters.
+func noticeSummary(message string) string {
+	summary := strings.TrimSpace(strings.SplitN(strings.TrimSpace(message), "\n", 2)[0])
+	if utf8.RuneCountInString(summary) > maxEventSummaryLength {
+		summary = string([]rune(summary)[:maxEventSummaryLength]) + "…"
+	}
+	if summary == "" {
+		summary = "MBotC notice"
+	}
+	return summary
+}
+
+func (p *Plugin) siteURL() string {
+	if config := p.API.GetConfig(); config != nil && config.ServiceSettings.SiteURL != nil {
+		return strings.TrimSuffix(*config.ServiceSettings.SiteURL, "/")
+	}
+	return ""
+}
+
+func (p *Plugin) calendarURL(kind, id, token string) string {
+	return fmt.Sprintf("%s/plugins/%s/calendar/%s/%s.ics?token=%s", p.siteURL(), manifest.Id, kind, id, token)
+}
+
+func executeFeed(p *Plugin, c *plugin.Context, header *model.CommandArgs, args ...string) *model.CommandResponse {
+	token, err := p.store.GetFeedToken(header.UserId)
+	if err == nil && token == "" {
+		token, err = p.store.ResetFeedToken(header.UserId)
+	}
+	if err != nil {
+		p.API.LogError("Failed to get feed token", "user_id", header.UserId, "err", err.Error())
+		p.postCommandResponse(header, "Failed to get your calendar feed. Please try again later.")
+		return &model.CommandResponse{}
+	}
+
+	p.postCommandResponse(header, feedMessage(p, header, token))
+	return &model.CommandResponse{}
+}
+
+func executeFeedReset(p *Plugin, c *plugin.Context, header *model.CommandArgs, args ...string) *model.CommandResponse {
+	token, err := p.store.ResetFeedToken(header.UserId)
+	if err != nil {
+		p.API.LogError("Failed to reset feed token", "user_id", header.UserId, "err", err.Error())
+		p.postCommandResponse(header, "Failed to reset your calendar feed. Please try again later.")
+		return &model.CommandResponse{}
+	}
+
+	p.postCommandResponse(header, "Your previous calendar feed links no longer work.\n"+feedMessage(p, header, token))
+	return &model.CommandResponse{}
+}
+
+func executeFeedRevoke(p *Plugin, c *plugin.Context, header *model.CommandArgs, args ...string) *model.CommandResponse {
+	if err := p.store.RevokeFeedToken(header.UserId); err != nil {
+		p.API.LogError("Failed to revoke feed token", "user_id", header.UserId, "err", err.Error())
+		p.postCommandResponse(header, "Failed to revoke your calendar feed. Please try again later.")
+		return &model.CommandResponse{}
+	}
+
+	p.postCommandResponse(header, "Your calendar feed links no longer work. Run `/mbotc feed` to get new ones.")
+	return &model.CommandResponse{}
+}
+
+func feedMessage(p *Plugin, header *model.CommandArgs, token string) string {
+	return "#### Your MBotC calendar feeds\n" +
+		"Subscribe to these links in your calendar app. They are private: anyone with a link can read the notices, so run `/mbotc feed reset` if one leaks, or `/mbotc feed revoke` to turn them off.\n" +
+		"- All your channels: " + p.calendarURL("user", header.UserId, token) + "\n" +
+		"- This channel: " + p.calendarURL("channel", header.ChannelId, token) + "\n"
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/mattermost/mattermost-server/v5/plugin/plugintest/mock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCalendarFeed(t *testing.T) {
+	require := require.New(t)
+
+	api := newKVAPI()
+	siteURL := "https://chat.example.com"
+	api.On("GetConfig").Return(&model.Config{ServiceSettings: model.ServiceSettings{SiteURL: &siteURL}})
+	api.On("GetChannelMember", "channel1", "user1").Return(&model.ChannelMember{}, nil)
+	api.On("GetChannelMember", mock.Anything, mock.Anything).Return(nil, &model.AppError{Message: "not found"})
+	api.On("GetChannel", "channel1").Return(&model.Channel{Id: "channel1", DisplayName: "Town Square"}, nil)
+
+	p := &Plugin{}
+	p.SetAPI(api)
+	p.store = NewStore(p)
+	p.setConfiguration(&configuration{ReminderLeadTimes: "1h"})
+	p.router = p.initRouter()
+
+	recurrence, err := ParseRecurrenceRule("FREQ=WEEKLY;UNTIL=20211231", "2021-11-12")
+	require.NoError(err)
+	require.NoError(p.store.CreateNotice(&Notice{
+		ChannelId:  "channel1",
+		PostId:     "post1",
+		Message:    "Weekly review\nBring your numbers",
+		StartTime:  "2021-11-05 09:00",
+		EndTime:    "2021-11-05 10:00",
+		FileIds:    []string{"file1"},
+		Recurrence: recurrence,
+	}))
+
+	token, err := p.store.ResetFeedToken("user1")
+	require.NoError(err)
+
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		p.ServeHTTP(nil, w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w
+	}
+
+	t.Run("channel feed", func(t *testing.T) {
+		assert := assert.New(t)
+
+		w := get("/calendar/channel/channel1.ics?token=" + token)
+		require.Equal(http.StatusOK, w.Code)
+		assert.Equal("text/calendar; charset=utf-8", w.Header().Get("Content-Type"))
+
+		body := strings.ReplaceAll(w.Body.String(), "\r\n ", "")
+		assert.Contains(body, "X-WR-CALNAME:MBotC ~Town Square\r\n")
+		assert.Contains(body, "SUMMARY:Weekly review\r\n")
+		assert.Contains(body, "DESCRIPTION:Weekly review\\nBring your numbers\r\n")
+		assert.Contains(body, "RRULE:FREQ=WEEKLY;UNTIL=")
+		assert.Contains(body, "EXDATE")
+		assert.Contains(body, "URL:https://chat.example.com/_redirect/pl/post1\r\n")
+		assert.Contains(body, "ATTACH:https://chat.example.com/api/v4/files/file1\r\n")
+		assert.Contains(body, "TRIGGER:-PT1H\r\n")
+	})
+
+	t.Run("access", func(t *testing.T) {
+		assert := assert.New(t)
+
+		assert.Equal(http.StatusUnauthorized, get("/calendar/channel/channel1.ics").Code)
+		assert.Equal(http.StatusUnauthorized, get("/calendar/channel/channel1.ics?token="+model.NewId()).Code)
+		assert.Equal(http.StatusForbidden, get("/calendar/channel/channel2.ics?token="+token).Code)
+		assert.Equal(http.StatusForbidden, get("/calendar/user/user2.ics?token="+token).Code)
+
+		newToken, err := p.store.ResetFeedToken("user1")
+		require.NoError(err)
+		assert.Equal(http.StatusUnauthorized, get("/calendar/channel/channel1.ics?token="+token).Code)
+		assert.Equal(http.StatusOK, get("/calendar/channel/channel1.ics?token="+newToken).Code)
+
+		require.NoError(p.store.RevokeFeedToken("user1"))
+		assert.Equal(http.StatusUnauthorized, get("/calendar/channel/channel1.ics?token="+newToken).Code)
+	})
+}
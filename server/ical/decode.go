@@ -0,0 +1,274 @@
+package ical
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const dateLayout = "20060102"
+
+// property is a content line split into its name, parameters and value.
+type property struct {
+	name   string
+	params map[string]string
+	value  string
+}
+
+// Decode reads the events of an iCalendar stream. Floating times and times in unknown time
+// zones are read in loc. Components other than VEVENT and its VALARMs are ignored.
+func Decode(r io.Reader, loc *time.Location) (*Calendar, error) {
+	lines, err := unfoldLines(r)
+	if err != nil {
+		return nil, err
+	}
+
+	calendar := &Calendar{}
+	var event *Event
+	var alarm *Alarm
+	var duration time.Duration
+	depth := 0
+	for i, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		prop, err := parseProperty(line)
+		if err != nil {
+			return nil, errors.Wrapf(err, "line %d", i+1)
+		}
+
+		switch {
+		case prop.name == "BEGIN":
+			depth++
+			switch {
+			case prop.value == "VEVENT" && event == nil:
+				event, duration = &Event{}, -1
+			case prop.value == "VALARM" && event != nil:
+				alarm = &Alarm{}
+			}
+		case prop.name == "END":
+			depth--
+			switch {
+			case prop.value == "VALARM" && alarm != nil:
+				event.Alarms = append(event.Alarms, *alarm)
+				alarm = nil
+			case prop.value == "VEVENT" && event != nil:
+				if event.Start.IsZero() {
+					return nil, errors.Errorf("event %q has no start", event.UID)
+				}
+				if event.End.IsZero() {
+					event.End = event.Start
+					if duration >= 0 {
+						event.End = event.Start.Add(duration)
+					}
+				}
+				calendar.Events = append(calendar.Events, event)
+				event = nil
+			}
+		case alarm != nil:
+			if prop.name == "TRIGGER" && prop.params["VALUE"] != "DATE-TIME" && prop.params["RELATED"] != "END" {
+				before, err := parseDuration(prop.value)
+				if err != nil {
+					return nil, errors.Wrapf(err, "line %d", i+1)
+				}
+				alarm.Before = -before
+			} else if prop.name == "DESCRIPTION" {
+				alarm.Description = unescapeText(prop.value)
+			}
+		case event != nil:
+			if err := event.setProperty(prop, loc, &duration); err != nil {
+				return nil, errors.Wrapf(err, "line %d", i+1)
+			}
+		case prop.name == "PRODID" && depth == 1:
+			calendar.ProductId = prop.value
+		case prop.name == "X-WR-CALNAME" && depth == 1:
+			calendar.Name = unescapeText(prop.value)
+		}
+	}
+
+	if event != nil || depth != 0 {
+		return nil, errors.New("unexpected end of calendar")
+	}
+	return calendar, nil
+}
+
+func (e *Event) setProperty(prop property, loc *time.Location, duration *time.Duration) error {
+	var err error
+	switch prop.name {
+	case "UID":
+		e.UID = prop.value
+	case "SUMMARY":
+		e.Summary = unescapeText(prop.value)
+	case "DESCRIPTION":
+		e.Description = unescapeText(prop.value)
+	case "URL":
+		e.URL = prop.value
+	case "ATTACH":
+		if prop.params["VALUE"] != "BINARY" {
+			e.Attachments = append(e.Attachments, prop.value)
+		}
+	case "RRULE":
+		e.RRule = prop.value
+	case "DTSTART":
+		e.Start, err = parseDateTime(prop, loc)
+	case "DTEND":
+		e.End, err = parseDateTime(prop, loc)
+	case "DURATION":
+		*duration, err = parseDuration(prop.value)
+	case "EXDATE":
+		for _, value := range strings.Split(prop.value, ",") {
+			var exDate time.Time
+			exDate, err = parseDateTime(property{params: prop.params, value: value}, loc)
+			if err != nil {
+				break
+			}
+			e.ExDates = append(e.ExDates, exDate)
+		}
+	case "CREATED":
+		e.Created, err = parseDateTime(prop, loc)
+	case "LAST-MODIFIED":
+		e.LastModified, err = parseDateTime(prop, loc)
+	}
+	return err
+}
+
+// unfoldLines reads the content lines, joining the continuation lines of folded ones.
+func unfoldLines(r io.Reader) ([]string, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	var lines []string
+	for scanner.Scan() {
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		if len(lines) > 0 && (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed to read calendar")
+	}
+	return lines, nil
+}
+
+// parseProperty splits a content line. Parameter values may be quoted and contain ':' or ';'.
+func parseProperty(line string) (property, error) {
+	prop := property{params: map[string]string{}}
+
+	inQuotes := false
+	start := 0
+	var name string
+	for i, c := range line {
+		switch {
+		case c == '"':
+			inQuotes = !inQuotes
+		case inQuotes:
+		case c == ';' || c == ':':
+			part := line[start:i]
+			if name == "" {
+				name = part
+			} else if eq := strings.Index(part, "="); eq >= 0 {
+				prop.params[strings.ToUpper(part[:eq])] = strings.Trim(part[eq+1:], `"`)
+			}
+			start = i + 1
+			if c == ':' {
+				prop.name = strings.ToUpper(name)
+				prop.value = line[i+1:]
+				return prop, nil
+			}
+		}
+	}
+	return prop, errors.Errorf("invalid content line %q", line)
+}
+
+// parseDateTime reads a DATE or DATE-TIME value in UTC, in its TZID or in loc.
+func parseDateTime(prop property, loc *time.Location) (time.Time, error) {
+	value := strings.TrimSpace(prop.value)
+	if tzid := prop.params["TZID"]; tzid != "" {
+		if zone, err := time.LoadLocation(strings.TrimPrefix(tzid, "/")); err == nil {
+			loc = zone
+		}
+	}
+
+	var t time.Time
+	var err error
+	switch {
+	case prop.params["VALUE"] == "DATE" || len(value) == len(dateLayout):
+		t, err = time.ParseInLocation(dateLayout, value, loc)
+	case strings.HasSuffix(value, "Z"):
+		t, err = time.Parse(utcDateTimeLayout, value)
+	default:
+		t, err = time.ParseInLocation(dateTimeLayout, value, loc)
+	}
+	if err != nil {
+		return t, errors.Errorf("invalid date-time %q", value)
+	}
+	return t, nil
+}
+
+// parseDuration reads a duration such as "-PT15M" or "P1DT2H".
+func parseDuration(value string) (time.Duration, error) {
+	text := strings.ToUpper(strings.TrimSpace(value))
+	sign := time.Duration(1)
+	switch {
+	case strings.HasPrefix(text, "-"):
+		sign, text = -1, text[1:]
+	case strings.HasPrefix(text, "+"):
+		text = text[1:]
+	}
+	if !strings.HasPrefix(text, "P") || len(text) < 3 {
+		return 0, errors.Errorf("invalid duration %q", value)
+	}
+
+	var d time.Duration
+	inTime := false
+	number := ""
+	for _, c := range text[1:] {
+		if c >= '0' && c <= '9' {
+			number += string(c)
+			continue
+		}
+		if c == 'T' {
+			inTime = true
+			continue
+		}
+
+		n, err := strconv.Atoi(number)
+		if err != nil {
+			return 0, errors.Errorf("invalid duration %q", value)
+		}
+		number = ""
+
+		var unit time.Duration
+		switch {
+		case c == 'W' && !inTime:
+			unit = 7 * 24 * time.Hour
+		case c == 'D' && !inTime:
+			unit = 24 * time.Hour
+		case c == 'H' && inTime:
+			unit = time.Hour
+		case c == 'M' && inTime:
+			unit = time.Minute
+		case c == 'S' && inTime:
+			unit = time.Second
+		default:
+			return 0, errors.Errorf("invalid duration %q", value)
+		}
+		d += time.Duration(n) * unit
+	}
+	if number != "" {
+		return 0, errors.Errorf("invalid duration %q", value)
+	}
+	return sign * d, nil
+}
+
+var textUnescaper = strings.NewReplacer(`\\`, `\`, `\;`, ";", `\,`, ",", `\n`, "\n", `\N`, "\n")
+
+func unescapeText(text string) string {
+	return textUnescaper.Replace(text)
+}
@@ -0,0 +1,189 @@
+// Package ical reads and writes iCalendar (RFC 5545) calendars of events.
+package ical
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	dateTimeLayout    = "20060102T150405"
+	utcDateTimeLayout = "20060102T150405Z"
+
+	// maxLineLength is the maximum length of a content line in octets, without the line break.
+	maxLineLength = 75
+)
+
+// Calendar is a VCALENDAR of events.
+type Calendar struct {
+	ProductId string
+	Name      string
+	Events    []*Event
+}
+
+// Event is a VEVENT. Start and End are written in their location when it is an IANA time zone,
+// which the calendar then defines in a VTIMEZONE, and in UTC otherwise.
+type Event struct {
+	UID          string
+	Created      time.Time
+	LastModified time.Time
+	Start        time.Time
+	End          time.Time
+	Summary      string
+	Description  string
+	URL          string
+	// RRule is the value of the RRULE property, e.g. "FREQ=WEEKLY;BYDAY=MO".
+	RRule string
+	// ExDates are the start times of the occurrences excluded from RRule.
+	ExDates     []time.Time
+	Attachments []string
+	Alarms      []Alarm
+}
+
+// Alarm is a VALARM displayed Before the start of its event.
+type Alarm struct {
+	Before      time.Duration
+	Description string
+}
+
+// Encode writes the calendar to w.
+func (c *Calendar) Encode(w io.Writer) error {
+	var buf bytes.Buffer
+	line := func(name, value string) {
+		writeLine(&buf, name+":"+value)
+	}
+
+	line("BEGIN", "VCALENDAR")
+	line("VERSION", "2.0")
+	line("PRODID", c.ProductId)
+	line("CALSCALE", "GREGORIAN")
+	line("METHOD", "PUBLISH")
+	if c.Name != "" {
+		line("X-WR-CALNAME", escapeText(c.Name))
+	}
+	for _, span := range eventTimeZones(c.Events) {
+		writeTimeZone(&buf, span)
+	}
+
+	for _, e := range c.Events {
+		line("BEGIN", "VEVENT")
+		line("UID", e.UID)
+		line("DTSTAMP", formatUTC(e.LastModified))
+		if !e.Created.IsZero() {
+			line("CREATED", formatUTC(e.Created))
+		}
+		if !e.LastModified.IsZero() {
+			line("LAST-MODIFIED", formatUTC(e.LastModified))
+		}
+		writeLine(&buf, "DTSTART"+formatDateTime(e.Start))
+		writeLine(&buf, "DTEND"+formatDateTime(e.End))
+		if e.RRule != "" {
+			line("RRULE", e.RRule)
+		}
+		for _, exDate := range e.ExDates {
+			writeLine(&buf, "EXDATE"+formatDateTime(exDate))
+		}
+		line("SUMMARY", escapeText(e.Summary))
+		if e.Description != "" {
+			line("DESCRIPTION", escapeText(e.Description))
+		}
+		if e.URL != "" {
+			line("URL", e.URL)
+		}
+		for _, attachment := range e.Attachments {
+			line("ATTACH", attachment)
+		}
+		for _, alarm := range e.Alarms {
+			line("BEGIN", "VALARM")
+			line("ACTION", "DISPLAY")
+			line("TRIGGER", "-"+formatDuration(alarm.Before))
+			line("DESCRIPTION", escapeText(alarm.Description))
+			line("END", "VALARM")
+		}
+		line("END", "VEVENT")
+	}
+
+	line("END", "VCALENDAR")
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// writeLine writes a content line, folded to lines of at most maxLineLength octets without
+// splitting UTF-8 sequences.
+func writeLine(buf *bytes.Buffer, line string) {
+	limit := maxLineLength
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+		buf.WriteString(line[:cut])
+		buf.WriteString("\r\n ")
+		line = line[cut:]
+		// Continuation lines start with a space, which counts towards the limit.
+		limit = maxLineLength - 1
+	}
+	buf.WriteString(line)
+	buf.WriteString("\r\n")
+}
+
+var textEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`)
+
+func escapeText(text string) string {
+	return textEscaper.Replace(text)
+}
+
+func formatUTC(t time.Time) string {
+	if t.IsZero() {
+		t = time.Now()
+	}
+	return t.UTC().Format(utcDateTimeLayout)
+}
+
+// hasTimeZone tells whether t is in an IANA time zone, rather than in UTC or the local time of
+// the server.
+func hasTimeZone(t time.Time) bool {
+	switch t.Location().String() {
+	case "UTC", "Local", "":
+		return false
+	default:
+		return true
+	}
+}
+
+// formatDateTime formats the parameters and value of a date-time property, without its name.
+func formatDateTime(t time.Time) string {
+	if !hasTimeZone(t) {
+		return ":" + t.UTC().Format(utcDateTimeLayout)
+	}
+	return ";TZID=" + t.Location().String() + ":" + t.Format(dateTimeLayout)
+}
+
+// formatDuration formats a positive duration, e.g. "P1D" or "PT1H30M".
+func formatDuration(d time.Duration) string {
+	if d < 0 {
+		d = -d
+	}
+	days := d / (24 * time.Hour)
+	d -= days * 24 * time.Hour
+
+	text := "P"
+	if days > 0 {
+		text += fmt.Sprintf("%dD", days)
+	}
+	if d > 0 || days == 0 {
+		text += "T"
+		if hours := d / time.Hour; hours > 0 {
+			text += fmt.Sprintf("%dH", hours)
+		}
+		if minutes := (d % time.Hour) / time.Minute; minutes > 0 || d < time.Hour {
+			text += fmt.Sprintf("%dM", minutes)
+		}
+	}
+	return text
+}
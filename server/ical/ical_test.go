@@ -0,0 +1,149 @@
+package ical
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncode(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	seoul, err := time.LoadLocation("Asia/Seoul")
+	require.NoError(err)
+
+	calendar := &Calendar{
+		ProductId: "-//test//EN",
+		Name:      "Team",
+		Events: []*Event{{
+			UID:         "1@test",
+			Start:       time.Date(2021, 11, 5, 9, 0, 0, 0, seoul),
+			End:         time.Date(2021, 11, 5, 10, 0, 0, 0, time.UTC),
+			Summary:     "Stand-up; daily, short",
+			Description: strings.Repeat("회의 ", 30) + "\nsee you",
+			RRule:       "FREQ=DAILY;COUNT=3",
+			ExDates:     []time.Time{time.Date(2021, 11, 6, 9, 0, 0, 0, seoul)},
+			Alarms:      []Alarm{{Before: 90 * time.Minute, Description: "soon"}, {Before: 24 * time.Hour}},
+		}},
+	}
+
+	var buf bytes.Buffer
+	require.NoError(calendar.Encode(&buf))
+	text := buf.String()
+
+	assert.True(strings.HasPrefix(text, "BEGIN:VCALENDAR\r\nVERSION:2.0\r\n"))
+	assert.True(strings.HasSuffix(text, "END:VEVENT\r\nEND:VCALENDAR\r\n"))
+	assert.Contains(text, "BEGIN:VTIMEZONE\r\nTZID:Asia/Seoul\r\n"+
+		"BEGIN:STANDARD\r\nDTSTART:20210101T000000\r\nTZOFFSETFROM:+0900\r\nTZOFFSETTO:+0900\r\nTZNAME:KST\r\nEND:STANDARD\r\n"+
+		"END:VTIMEZONE\r\nBEGIN:VEVENT\r\n")
+	assert.Equal(1, strings.Count(text, "BEGIN:VTIMEZONE"))
+	assert.Contains(text, "DTSTART;TZID=Asia/Seoul:20211105T090000\r\n")
+	assert.Contains(text, "DTEND:20211105T100000Z\r\n")
+	assert.Contains(text, "EXDATE;TZID=Asia/Seoul:20211106T090000\r\n")
+	assert.Contains(text, "SUMMARY:Stand-up\\; daily\\, short\r\n")
+	assert.Contains(text, "TRIGGER:-PT1H30M\r\n")
+	assert.Contains(text, "TRIGGER:-P1D\r\n")
+
+	for _, line := range strings.Split(text, "\r\n") {
+		assert.LessOrEqual(len(line), maxLineLength, line)
+	}
+	unfolded := strings.ReplaceAll(text, "\r\n ", "")
+	assert.Contains(unfolded, "DESCRIPTION:"+strings.Repeat("회의 ", 30)+"\\nsee you\r\n")
+
+	decoded, err := Decode(strings.NewReader(text), time.UTC)
+	require.NoError(err)
+	require.Len(decoded.Events, 1)
+	assert.True(decoded.Events[0].Start.Equal(calendar.Events[0].Start))
+}
+
+func TestWriteTimeZone(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	newYork, err := time.LoadLocation("America/New_York")
+	require.NoError(err)
+
+	var buf bytes.Buffer
+	start := time.Date(2021, 11, 5, 9, 0, 0, 0, newYork)
+	writeTimeZone(&buf, &timeZoneSpan{loc: newYork, from: start, to: start})
+	text := buf.String()
+
+	assert.True(strings.HasPrefix(text, "BEGIN:VTIMEZONE\r\nTZID:America/New_York\r\n"+
+		"BEGIN:STANDARD\r\nDTSTART:20210101T000000\r\nTZOFFSETFROM:-0500\r\nTZOFFSETTO:-0500\r\nTZNAME:EST\r\nEND:STANDARD\r\n"+
+		"BEGIN:DAYLIGHT\r\nDTSTART:20210314T020000\r\nTZOFFSETFROM:-0500\r\nTZOFFSETTO:-0400\r\nTZNAME:EDT\r\nEND:DAYLIGHT\r\n"+
+		"BEGIN:STANDARD\r\nDTSTART:20211107T020000\r\nTZOFFSETFROM:-0400\r\nTZOFFSETTO:-0500\r\nTZNAME:EST\r\nEND:STANDARD\r\n"))
+	assert.True(strings.HasSuffix(text, "END:VTIMEZONE\r\n"))
+	// The transitions of the years the recurring events may still occur are included.
+	assert.Contains(text, "DTSTART:20261101T020000\r\n")
+	assert.NotContains(text, "DTSTART:2027")
+
+	assert.Equal("-0330", formatOffset(-(3*3600 + 30*60)))
+	assert.Equal("+0545", formatOffset(5*3600+45*60))
+}
+
+func TestFormatDuration(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal("PT0M", formatDuration(0))
+	assert.Equal("PT30M", formatDuration(30*time.Minute))
+	assert.Equal("PT2H", formatDuration(2*time.Hour))
+	assert.Equal("P2DT1H", formatDuration(49*time.Hour))
+}
+
+func TestDecode(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	seoul, err := time.LoadLocation("Asia/Seoul")
+	require.NoError(err)
+
+	text := "BEGIN:VCALENDAR\r\n" +
+		"PRODID:-//test//EN\r\n" +
+		"BEGIN:VTIMEZONE\r\nTZID:Asia/Seoul\r\nBEGIN:STANDARD\r\nDTSTART:19700101T000000\r\nEND:STANDARD\r\nEND:VTIMEZONE\r\n" +
+		"BEGIN:VEVENT\r\n" +
+		"UID:1@test\r\n" +
+		"DTSTART;TZID=\"Asia/Seoul\":20211105T090000\r\n" +
+		"DURATION:PT1H30M\r\n" +
+		"SUMMARY:Stand-up\\; daily\\, sh\r\n ort\r\n" +
+		"DESCRIPTION:line one\\nline two\r\n" +
+		"RRULE:FREQ=WEEKLY;BYDAY=FR\r\n" +
+		"EXDATE;TZID=Asia/Seoul:20211112T090000,20211119T090000\r\n" +
+		"ATTACH;FMTTYPE=text/plain:https://example.com/a.txt\r\n" +
+		"BEGIN:VALARM\r\nACTION:DISPLAY\r\nTRIGGER:-PT15M\r\nDESCRIPTION:soon\r\nEND:VALARM\r\n" +
+		"END:VEVENT\r\n" +
+		"BEGIN:VEVENT\n" +
+		"DTSTART;VALUE=DATE:20211224\n" +
+		"DTEND:20211224T100000Z\n" +
+		"SUMMARY:Holiday\n" +
+		"END:VEVENT\n" +
+		"END:VCALENDAR\r\n"
+
+	calendar, err := Decode(strings.NewReader(text), time.UTC)
+	require.NoError(err)
+	assert.Equal("-//test//EN", calendar.ProductId)
+	require.Len(calendar.Events, 2)
+
+	event := calendar.Events[0]
+	assert.Equal("Stand-up; daily, short", event.Summary)
+	assert.Equal("line one\nline two", event.Description)
+	assert.True(event.Start.Equal(time.Date(2021, 11, 5, 9, 0, 0, 0, seoul)))
+	assert.Equal(90*time.Minute, event.End.Sub(event.Start))
+	assert.Equal("FREQ=WEEKLY;BYDAY=FR", event.RRule)
+	assert.Len(event.ExDates, 2)
+	assert.Equal([]string{"https://example.com/a.txt"}, event.Attachments)
+	assert.Equal([]Alarm{{Before: 15 * time.Minute, Description: "soon"}}, event.Alarms)
+
+	event = calendar.Events[1]
+	assert.Equal(time.Date(2021, 12, 24, 0, 0, 0, 0, time.UTC), event.Start)
+	assert.Equal(time.Date(2021, 12, 24, 10, 0, 0, 0, time.UTC), event.End)
+
+	_, err = Decode(strings.NewReader("BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nSUMMARY:x\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n"), time.UTC)
+	assert.Error(err, "an event needs a start")
+	_, err = Decode(strings.NewReader("BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\n"), time.UTC)
+	assert.Error(err)
+}
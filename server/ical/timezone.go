@@ -0,0 +1,141 @@
+package ical
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+)
+
+// timeZoneYears is how many years after the last event the transitions of its time zone are
+// written, so that clients can place the occurrences of recurring events without an end.
+const timeZoneYears = 5
+
+// timeZoneSpan is the period of the events of a time zone.
+type timeZoneSpan struct {
+	loc      *time.Location
+	from, to time.Time
+}
+
+// eventTimeZones returns the IANA time zones used by the events, in the order they are first
+// used, with the period their transitions are needed for.
+func eventTimeZones(events []*Event) []*timeZoneSpan {
+	spans := map[string]*timeZoneSpan{}
+	var ordered []*timeZoneSpan
+	add := func(t time.Time) {
+		if !hasTimeZone(t) {
+			return
+		}
+		name := t.Location().String()
+		span, ok := spans[name]
+		if !ok {
+			span = &timeZoneSpan{loc: t.Location(), from: t, to: t}
+			spans[name] = span
+			ordered = append(ordered, span)
+		}
+		if t.Before(span.from) {
+			span.from = t
+		}
+		if t.After(span.to) {
+			span.to = t
+		}
+	}
+	for _, e := range events {
+		add(e.Start)
+		add(e.End)
+		for _, exDate := range e.ExDates {
+			add(exDate)
+		}
+	}
+	return ordered
+}
+
+// writeTimeZone writes the VTIMEZONE of the span: an observance for the offset at its start,
+// then one for each transition until timeZoneYears after its end.
+func writeTimeZone(buf *bytes.Buffer, span *timeZoneSpan) {
+	loc := span.loc
+	from := time.Date(span.from.Year(), time.January, 1, 0, 0, 0, 0, loc)
+	to := time.Date(span.to.Year()+timeZoneYears+1, time.January, 1, 0, 0, 0, 0, loc)
+
+	writeLine(buf, "BEGIN:VTIMEZONE")
+	writeLine(buf, "TZID:"+loc.String())
+	_, offset := from.Zone()
+	writeObservance(buf, from, offset)
+	for _, transition := range zoneTransitions(loc, from, to) {
+		writeObservance(buf, transition, offset)
+		_, offset = transition.Zone()
+	}
+	writeLine(buf, "END:VTIMEZONE")
+}
+
+// writeObservance writes the STANDARD or DAYLIGHT observance starting at onset, when the offset
+// changes from offsetFrom.
+func writeObservance(buf *bytes.Buffer, onset time.Time, offsetFrom int) {
+	name, offset := onset.Zone()
+	kind := "STANDARD"
+	if isDaylight(onset) {
+		kind = "DAYLIGHT"
+	}
+	writeLine(buf, "BEGIN:"+kind)
+	// The onset is written in the local time before it.
+	writeLine(buf, "DTSTART:"+onset.In(time.FixedZone("", offsetFrom)).Format(dateTimeLayout))
+	writeLine(buf, "TZOFFSETFROM:"+formatOffset(offsetFrom))
+	writeLine(buf, "TZOFFSETTO:"+formatOffset(offset))
+	writeLine(buf, "TZNAME:"+name)
+	writeLine(buf, "END:"+kind)
+}
+
+// zoneTransitions returns the instants between from and to when the offset or the name of the
+// zone changes.
+func zoneTransitions(loc *time.Location, from, to time.Time) []time.Time {
+	var transitions []time.Time
+	name, offset := from.In(loc).Zone()
+	for t := from; t.Before(to); {
+		next := t.Add(24 * time.Hour)
+		if nextName, nextOffset := next.In(loc).Zone(); nextName == name && nextOffset == offset {
+			t = next
+			continue
+		}
+		// Find the first second of the new offset.
+		lo, hi := t, next
+		for hi.Sub(lo) > time.Second {
+			mid := lo.Add(hi.Sub(lo) / 2).Truncate(time.Second)
+			if midName, midOffset := mid.In(loc).Zone(); midName == name && midOffset == offset {
+				lo = mid
+			} else {
+				hi = mid
+			}
+		}
+		hi = hi.In(loc)
+		transitions = append(transitions, hi)
+		name, offset = hi.Zone()
+		t = hi
+	}
+	return transitions
+}
+
+// isDaylight tells whether t is in daylight saving time, that is ahead of the lower of the
+// offsets of its zone in January and July.
+func isDaylight(t time.Time) bool {
+	_, january := time.Date(t.Year(), time.January, 1, 0, 0, 0, 0, t.Location()).Zone()
+	_, july := time.Date(t.Year(), time.July, 1, 0, 0, 0, 0, t.Location()).Zone()
+	standard := january
+	if july < standard {
+		standard = july
+	}
+	_, offset := t.Zone()
+	return offset > standard
+}
+
+// formatOffset formats a UTC offset in seconds, e.g. "+0900" or "-0330".
+func formatOffset(offset int) string {
+	sign := "+"
+	if offset < 0 {
+		sign = "-"
+		offset = -offset
+	}
+	text := fmt.Sprintf("%s%02d%02d", sign, offset/3600, offset%3600/60)
+	if seconds := offset % 60; seconds != 0 {
+		text += fmt.Sprintf("%02d", seconds)
+	}
+	return text
+}
@@ -0,0 +1,360 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/mattermost/mattermost-server/v5/plugin"
+	"github.com/pkg/errors"
+
+	"github.com/mattermost/mattermost-plugin-starter-template/server/ical"
+)
+
+const (
+	// importExpiry is how long an import preview can be confirmed.
+	importExpiry = time.Hour
+
+	maxImportFileSize   = 5 * 1024 * 1024
+	maxImportedNotices  = 100
+	importSearchedPosts = 60
+)
+
+// NoticeImport is a set of notices read from an .ics file, waiting for the confirmation of the
+// user who imported it.
+type NoticeImport struct {
+	Id        string   `json:"id"`
+	UserId    string   `json:"user_id"`
+	ChannelId string   `json:"channel_id"`
+	FileName  string   `json:"file_name"`
+	Notices   []Notice `json:"notices"`
+	CreateAt  int64    `json:"create_at"`
+}
+
+func executeImport(p *Plugin, c *plugin.Context, header *model.CommandArgs, args ...string) *model.CommandResponse {
+	fileId := ""
+	if len(args) > 0 {
+		fileId = args[0]
+	}
+
+	info, message := p.findImportFile(header.UserId, header.ChannelId, fileId)
+	if info == nil {
+		p.postCommandResponse(header, message)
+		return &model.CommandResponse{}
+	}
+
+	data, appErr := p.API.GetFile(info.Id)
+	if appErr != nil {
+		p.API.LogError("Failed to read import file", "file_id", info.Id, "err", appErr.Error())
+		p.postCommandResponse(header, "Failed to read "+info.Name+". Please try again later.")
+		return &model.CommandResponse{}
+	}
+
+	loc := p.userLocation(header.UserId)
+	calendar, err := ical.Decode(bytes.NewReader(data), loc)
+	if err != nil {
+		p.postCommandResponse(header, fmt.Sprintf("%s is not a valid iCalendar file: %s", info.Name, err.Error()))
+		return &model.CommandResponse{}
+	}
+
+	noticeImport := &NoticeImport{UserId: header.UserId, ChannelId: header.ChannelId, FileName: info.Name}
+	var skipped []string
+	for _, event := range calendar.Events {
+		notice, err := importedNotice(event, header.UserId, header.ChannelId, loc)
+		if err == nil {
+			if errs := p.validateImportedNotice(&notice, time.Now()); errs != nil {
+				err = errs
+			}
+		}
+		if err != nil {
+			skipped = append(skipped, fmt.Sprintf("%s: %s", noticeSummary(event.Summary), err.Error()))
+			continue
+		}
+		noticeImport.Notices = append(noticeImport.Notices, notice)
+	}
+	if len(noticeImport.Notices) > maxImportedNotices {
+		p.postCommandResponse(header, fmt.Sprintf("%s has %d events, but at most %d can be imported at once.", info.Name, len(noticeImport.Notices), maxImportedNotices))
+		return &model.CommandResponse{}
+	}
+
+	post := &model.Post{
+		UserId:    p.botUserID,
+		ChannelId: header.ChannelId,
+		Message:   formatImportPreview(noticeImport, skipped, loc),
+	}
+	if len(noticeImport.Notices) > 0 {
+		if err := p.store.SaveNoticeImport(noticeImport, importExpiry); err != nil {
+			p.API.LogError("Failed to save notice import", "user_id", header.UserId, "err", err.Error())
+			p.postCommandResponse(header, "Failed to prepare the import. Please try again later.")
+			return &model.CommandResponse{}
+		}
+		post.AddProp("attachments", []*model.SlackAttachment{{
+			Text:    fmt.Sprintf("Post %d notices in this channel?", len(noticeImport.Notices)),
+			Actions: importActions(noticeImport),
+		}})
+	}
+	_ = p.API.SendEphemeralPost(header.UserId, post)
+	return &model.CommandResponse{}
+}
+
+// findImportFile returns the .ics file with the id, or the most recent one posted in the
+// channel. The user must be able to read the file. When no file is found, the message tells the
+// user why.
+func (p *Plugin) findImportFile(userId, channelId, fileId string) (info *model.FileInfo, message string) {
+	if fileId == "" {
+		posts, appErr := p.API.GetPostsForChannel(channelId, 0, importSearchedPosts)
+		if appErr != nil {
+			p.API.LogError("Failed to get posts for import", "channel_id", channelId, "err", appErr.Error())
+			return nil, "Failed to find an .ics file. Please try again later."
+		}
+		for _, postId := range posts.Order {
+			for _, id := range posts.Posts[postId].FileIds {
+				if info, appErr = p.API.GetFileInfo(id); appErr == nil && strings.EqualFold(info.Extension, "ics") {
+					return checkImportFile(info)
+				}
+			}
+		}
+		return nil, "No .ics file was found in the recent posts of this channel. Upload one, or run `/mbotc import <file-id>`."
+	}
+
+	notFound := fmt.Sprintf("File %s was not found.", fileId)
+	info, appErr := p.API.GetFileInfo(fileId)
+	if appErr != nil {
+		return nil, notFound
+	}
+	if info.PostId != "" {
+		post, appErr := p.API.GetPost(info.PostId)
+		if appErr != nil {
+			return nil, notFound
+		}
+		if _, appErr = p.API.GetChannelMember(post.ChannelId, userId); appErr != nil {
+			return nil, notFound
+		}
+	} else if info.CreatorId != userId {
+		return nil, notFound
+	}
+	return checkImportFile(info)
+}
+
+func checkImportFile(info *model.FileInfo) (*model.FileInfo, string) {
+	if !strings.EqualFold(info.Extension, "ics") {
+		return nil, info.Name + " is not an .ics file."
+	}
+	if info.Size > maxImportFileSize {
+		return nil, info.Name + " is too large to import."
+	}
+	return info, ""
+}
+
+// importedNotice converts an event to a notice of the user in the channel. Alarms become
+// reminders. Events in an IANA timezone keep it, the others get the timezone of the user, loc.
+func importedNotice(event *ical.Event, userId, channelId string, loc *time.Location) (Notice, error) {
+	notice := Notice{
+		UserId:    userId,
+		ChannelId: channelId,
+		Message:   strings.TrimSpace(event.Summary),
+	}
+	if description := strings.TrimSpace(event.Description); description != "" && description != notice.Message {
+		notice.Message = strings.TrimSpace(notice.Message + "\n\n" + description)
+	}
+	if notice.Message == "" {
+		return notice, errors.New("no summary or description")
+	}
+	switch event.Start.Location().String() {
+	case "UTC", "Local":
+	default:
+		loc = event.Start.Location()
+	}
+	notice.StartTime = event.Start.Format(storedTimeLayout)
+	notice.EndTime = event.End.Format(storedTimeLayout)
+	if err := notice.localize(loc); err != nil {
+		return notice, err
+	}
+
+	var leadTimes []string
+	for _, alarm := range event.Alarms {
+		if alarm.Before >= 0 {
+			leadTimes = append(leadTimes, formatLeadTimeSpec(alarm.Before.Truncate(time.Minute)))
+		}
+	}
+	notice.Reminders = strings.Join(leadTimes, ",")
+
+	if event.RRule != "" {
+		var exceptions []string
+		for _, exDate := range event.ExDates {
+			exceptions = append(exceptions, exDate.In(loc).Format(recurrenceDateLayout))
+		}
+		recurrence, err := ParseRecurrenceRule(localizeRecurrenceUntil(event.RRule, loc), strings.Join(exceptions, ","))
+		if err != nil {
+			return notice, err
+		}
+		notice.Recurrence = recurrence
+	}
+	return notice, nil
+}
+
+// validateImportedNotice checks an imported notice like the notices users enter. Recurring events
+// may have started in the past.
+func (p *Plugin) validateImportedNotice(notice *Notice, now time.Time) ValidationErrors {
+	return p.validateNotice(notice, noticeValidation{
+		Location:       notice.location(),
+		Now:            now,
+		AllowPastStart: notice.Recurrence != nil,
+	})
+}
+
+// localizeRecurrenceUntil rewrites a UTC UNTIL date-time as the date in loc, since
+// RecurrenceRule.Until is a day.
+func localizeRecurrenceUntil(rule string, loc *time.Location) string {
+	parts := strings.Split(rule, ";")
+	for i, part := range parts {
+		value := strings.TrimPrefix(strings.ToUpper(part), "UNTIL=")
+		if value == strings.ToUpper(part) || !strings.HasSuffix(value, "Z") {
+			continue
+		}
+		if until, err := time.Parse("20060102T150405Z", value); err == nil {
+			parts[i] = "UNTIL=" + until.In(loc).Format("20060102")
+		}
+	}
+	return strings.Join(parts, ";")
+}
+
+func formatImportPreview(noticeImport *NoticeImport, skipped []string, loc *time.Location) string {
+	text := fmt.Sprintf("#### Import of %s\n", noticeImport.FileName)
+	if len(noticeImport.Notices) == 0 {
+		text += "No event of the file can be imported.\n"
+	} else {
+		text += "| # | Start | End | Repeats | Preview |\n" +
+			"| --- | --- | --- | --- | --- |\n"
+		for i, notice := range noticeImport.Notices {
+			start, end := notice.formatPeriod(loc)
+			text += fmt.Sprintf("| %d | %s | %s | %s | %s |\n", i+1, start, end,
+				describeRecurrence(notice.Recurrence), strings.ReplaceAll(noticeSummary(notice.Message), "|", "\\|"))
+		}
+	}
+
+	if len(skipped) > 0 {
+		text += fmt.Sprintf("\nSkipped %d events:\n", len(skipped))
+		for _, reason := range skipped {
+			text += "- " + reason + "\n"
+		}
+	}
+	return text
+}
+
+func importActions(noticeImport *NoticeImport) []*model.PostAction {
+	context := map[string]interface{}{"import_id": noticeImport.Id}
+	return []*model.PostAction{{
+		Id:    "import",
+		Name:  "Import",
+		Type:  model.POST_ACTION_TYPE_BUTTON,
+		Style: "primary",
+		Integration: &model.PostActionIntegration{
+			URL:     "/plugins/" + manifest.Id + "/actions/import/confirm",
+			Context: context,
+		},
+	}, {
+		Id:   "cancelimport",
+		Name: "Cancel",
+		Type: model.POST_ACTION_TYPE_BUTTON,
+		Integration: &model.PostActionIntegration{
+			URL:     "/plugins/" + manifest.Id + "/actions/import/cancel",
+			Context: context,
+		},
+	}}
+}
+
+// handleImportConfirmAction publishes the notices of an import, like the notices posted to /fe,
+// and replaces the preview with the result.
+func (p *Plugin) handleImportConfirmAction(w http.ResponseWriter, r *http.Request) {
+	userId := r.Header.Get("Mattermost-User-ID")
+	log := p.loggerFromContext(r.Context())
+
+	request := model.PostActionIntegrationRequestFromJson(r.Body)
+	if request == nil {
+		http.Error(w, "Invalid action request", http.StatusBadRequest)
+		return
+	}
+	importId, _ := request.Context["import_id"].(string)
+	log = log.With("import_id", importId)
+
+	noticeImport, err := p.store.GetNoticeImport(importId)
+	if err == nil && noticeImport.UserId != userId {
+		err = ErrNoticeImportNotFound
+	}
+	if err == nil {
+		if errs := p.validateNoticeChannel(userId, noticeImport.ChannelId); errs != nil {
+			writeActionResponse(w, errs[0].Message)
+			return
+		}
+		noticeImport, err = p.store.TakeNoticeImport(importId)
+	}
+	if err != nil {
+		if err != ErrNoticeImportNotFound {
+			log.Error("Failed to get notice import", "err", err.Error())
+		}
+		writeActionResponse(w, "This import was already done, cancelled or has expired.")
+		return
+	}
+
+	published := 0
+	now := time.Now()
+	for i := range noticeImport.Notices {
+		notice := noticeImport.Notices[i]
+		// The preview was validated, but notices may have started since.
+		if errs := p.validateImportedNotice(&notice, now); errs != nil {
+			log.Info("Skipped invalid imported notice", "err", errs.Error())
+			continue
+		}
+		if err := p.publishNotice(&notice); err != nil {
+			log.Error("Failed to publish imported notice", "err", err.Error())
+			continue
+		}
+		published++
+	}
+
+	text := fmt.Sprintf(":white_check_mark: Imported %d of %d notices from %s.", published, len(noticeImport.Notices), noticeImport.FileName)
+	p.updateEphemeralActionPost(w, userId, request, text)
+}
+
+func (p *Plugin) handleImportCancelAction(w http.ResponseWriter, r *http.Request) {
+	userId := r.Header.Get("Mattermost-User-ID")
+
+	request := model.PostActionIntegrationRequestFromJson(r.Body)
+	if request == nil {
+		http.Error(w, "Invalid action request", http.StatusBadRequest)
+		return
+	}
+	importId, _ := request.Context["import_id"].(string)
+
+	noticeImport, err := p.store.GetNoticeImport(importId)
+	if err == nil && noticeImport.UserId == userId {
+		_, err = p.store.TakeNoticeImport(importId)
+	}
+	if err != nil && err != ErrNoticeImportNotFound {
+		p.loggerFromContext(r.Context()).Error("Failed to cancel notice import", "import_id", importId, "err", err.Error())
+	}
+
+	p.updateEphemeralActionPost(w, userId, request, "Import cancelled.")
+}
+
+// updateEphemeralActionPost replaces the ephemeral post of the action with text.
+func (p *Plugin) updateEphemeralActionPost(w http.ResponseWriter, userId string, request *model.PostActionIntegrationRequest, text string) {
+	p.replaceEphemeralActionPost(w, userId, request, &model.Post{
+		UserId:    p.botUserID,
+		ChannelId: request.ChannelId,
+		Message:   text,
+	})
+}
+
+// replaceEphemeralActionPost replaces the ephemeral post of the action with post.
+func (p *Plugin) replaceEphemeralActionPost(w http.ResponseWriter, userId string, request *model.PostActionIntegrationRequest, post *model.Post) {
+	post.Id = request.PostId
+	p.API.UpdateEphemeralPost(userId, post)
+
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write((&model.PostActionIntegrationResponse{}).ToJson())
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/mattermost/mattermost-server/v5/plugin/plugintest/mock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mattermost/mattermost-plugin-starter-template/server/ical"
+)
+
+func TestImportedNotice(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	seoul, err := time.LoadLocation("Asia/Seoul")
+	require.NoError(err)
+
+	// Floating and UTC times are read in the timezone of the importing user.
+	start := time.Date(2021, 11, 5, 0, 0, 0, 0, time.UTC)
+	notice, err := importedNotice(&ical.Event{
+		Summary:     "Weekly review",
+		Description: "Bring your numbers",
+		Start:       start,
+		End:         start.Add(time.Hour),
+		RRule:       "FREQ=WEEKLY;UNTIL=20211231T145900Z",
+		ExDates:     []time.Time{start.AddDate(0, 0, 7)},
+		Alarms:      []ical.Alarm{{Before: time.Hour}, {Before: 24 * time.Hour}},
+	}, "user1", "channel1", seoul)
+	require.NoError(err)
+	assert.Equal("Weekly review\n\nBring your numbers", notice.Message)
+	assert.Equal("2021-11-05T00:00:00Z", notice.StartTime)
+	assert.Equal("2021-11-05T01:00:00Z", notice.EndTime)
+	assert.Equal("Asia/Seoul", notice.TimeZone)
+	assert.Equal("1h,1d", notice.Reminders)
+	require.NotNil(notice.Recurrence)
+	assert.Equal("2021-12-31", notice.Recurrence.Until)
+	assert.Equal([]string{"2021-11-12"}, notice.Recurrence.Exceptions)
+
+	_, err = importedNotice(&ical.Event{Start: start, End: start}, "user1", "channel1", seoul)
+	assert.Error(err)
+	_, err = importedNotice(&ical.Event{Summary: "x", Start: start, End: start, RRule: "FREQ=YEARLY"}, "user1", "channel1", seoul)
+	assert.Error(err)
+}
+
+func TestValidateImportedNotice(t *testing.T) {
+	assert := assert.New(t)
+
+	api := newKVAPI()
+	api.On("GetChannelMember", "channel1", "user1").Return(&model.ChannelMember{}, nil)
+	api.On("HasPermissionToChannel", "user1", "channel1", model.PERMISSION_CREATE_POST).Return(true)
+	api.On("GetChannel", "channel1").Return(&model.Channel{Id: "channel1", TeamId: "team1"}, nil)
+	p := &Plugin{}
+	p.SetAPI(api)
+
+	now := time.Date(2021, 11, 10, 0, 0, 0, 0, time.UTC)
+	notice := Notice{UserId: "user1", ChannelId: "channel1", Message: "Weekly review",
+		StartTime: "2021-11-05T00:00:00Z", EndTime: "2021-11-05T01:00:00Z", TimeZone: "UTC"}
+	errs := p.validateImportedNotice(&notice, now)
+	assert.True(errs.Has(ValidationPastDate), "one-off events in the past aren't imported")
+
+	notice.Recurrence = &RecurrenceRule{Frequency: FrequencyWeekly, Interval: 1}
+	assert.Nil(p.validateImportedNotice(&notice, now), "recurring events may have started in the past")
+
+	notice.Priority = "critical"
+	assert.True(p.validateImportedNotice(&notice, now).Has(ValidationInvalidPriority))
+}
+
+func TestImportActions(t *testing.T) {
+	require := require.New(t)
+
+	api := newKVAPI()
+	api.On("GetChannelMember", "channel1", "user1").Return(&model.ChannelMember{}, nil)
+	api.On("HasPermissionToChannel", "user1", "channel1", model.PERMISSION_CREATE_POST).Return(true)
+	api.On("GetUser", "user1").Return(&model.User{Id: "user1", Username: "alice"}, nil)
+	api.On("GetChannel", "channel1").Return(&model.Channel{Id: "channel1", TeamId: "team1"}, nil)
+	api.On("GetTeam", "team1").Return(&model.Team{Id: "team1"}, nil)
+	api.On("CreatePost", mock.Anything).Return(func(post *model.Post) *model.Post {
+		post.Id = model.NewId()
+		return post
+	}, nil)
+	api.On("UpdateEphemeralPost", "user1", mock.Anything).Return(&model.Post{})
+
+	p := &Plugin{botUserID: "bot"}
+	p.SetAPI(api)
+	p.store = NewStore(p)
+	p.backend = &fakeBackend{}
+	p.setConfiguration(&configuration{ReminderLeadTimes: noRemindersSpec})
+	p.router = p.initRouter()
+
+	tomorrow := time.Now().AddDate(0, 0, 1).Format(noticeTimeLayout)
+	noticeImport := &NoticeImport{UserId: "user1", ChannelId: "channel1", FileName: "team.ics", Notices: []Notice{
+		{UserId: "user1", ChannelId: "channel1", Message: "first", StartTime: tomorrow, EndTime: tomorrow},
+		{UserId: "user1", ChannelId: "channel1", Message: "second", StartTime: tomorrow, EndTime: tomorrow},
+		{UserId: "user1", ChannelId: "channel1", Message: "past", StartTime: "2021-11-06 09:00", EndTime: "2021-11-06 09:00"},
+	}}
+	require.NoError(p.store.SaveNoticeImport(noticeImport, importExpiry))
+
+	confirm := func(userId string) {
+		request := &model.PostActionIntegrationRequest{PostId: "ephemeral1", ChannelId: "channel1", Context: map[string]interface{}{"import_id": noticeImport.Id}}
+		r := httptest.NewRequest(http.MethodPost, "/actions/import/confirm", bytes.NewReader(request.ToJson()))
+		r.Header.Set("Mattermost-User-ID", userId)
+		p.ServeHTTP(nil, httptest.NewRecorder(), r)
+	}
+
+	confirm("user2")
+	_, err := p.store.GetNoticeImport(noticeImport.Id)
+	require.NoError(err, "only the importer can confirm an import")
+
+	confirm("user1")
+	confirm("user1")
+
+	notices, err := p.store.ListNoticesByChannel("channel1")
+	require.NoError(err)
+	assert.Len(t, notices, 2, "a confirmed import is only published once, without its past notices")
+	api.AssertNumberOfCalls(t, "UpdateEphemeralPost", 1)
+	_, err = p.store.GetNoticeImport(noticeImport.Id)
+	assert.Equal(t, ErrNoticeImportNotFound, err)
+}
@@ -0,0 +1,546 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/mattermost/mattermost-server/v5/plugin"
+	"github.com/pkg/errors"
+)
+
+// Scopes of a listing of notices, chosen with --scope.
+const (
+	scopeChannel = "channel"
+	scopeTeam    = "team"
+	scopeAll     = "all"
+)
+
+// Filters of an interactive listing, chosen with its buttons. They narrow the scope further.
+const (
+	filterNone    = ""
+	filterMine    = "mine"
+	filterChannel = "channel"
+	filterOverdue = "overdue"
+)
+
+// Actions of the buttons of an interactive listing.
+const (
+	listingActionShow   = "show"
+	listingActionView   = "view"
+	listingActionRemind = "remind"
+	listingActionAck    = "ack"
+)
+
+const (
+	// maxListingDays bounds /mbotc range, which reads the notices of every day in the range.
+	maxListingDays = 92
+	// listingPageSize is the number of notices on a page of a listing. Every notice has its own
+	// row of buttons.
+	listingPageSize = 10
+	// maxPreviewRunes is the length of a notice in a listing.
+	maxPreviewRunes = 100
+	// maxRowPreviewRunes is the length of a notice next to its buttons.
+	maxRowPreviewRunes = 40
+
+	listingDayLayout = "2006-01-02"
+)
+
+func executeWeek(p *Plugin, c *plugin.Context, header *model.CommandArgs, args ...string) *model.CommandResponse {
+	return p.executeListing(header, args, 0, "Usage: `/mbotc week [--scope channel|team|all]`",
+		func(today time.Time, _ []string) (time.Time, time.Time, string) {
+			return today, today.AddDate(0, 0, 7), ""
+		})
+}
+
+func executeMonth(p *Plugin, c *plugin.Context, header *model.CommandArgs, args ...string) *model.CommandResponse {
+	return p.executeListing(header, args, 0, "Usage: `/mbotc month [--scope channel|team|all]`",
+		func(today time.Time, _ []string) (time.Time, time.Time, string) {
+			return today, today.AddDate(0, 1, 0), ""
+		})
+}
+
+func executeRange(p *Plugin, c *plugin.Context, header *model.CommandArgs, args ...string) *model.CommandResponse {
+	return p.executeListing(header, args, 2, "Usage: `/mbotc range <from> <to> [--scope channel|team|all]`, e.g. `/mbotc range 2021-11-01 2021-11-30`",
+		func(today time.Time, days []string) (time.Time, time.Time, string) {
+			from, err := parseListingDay(days[0], today)
+			if err != nil {
+				return time.Time{}, time.Time{}, fmt.Sprintf("Can't read the day `%s`.", days[0])
+			}
+			to, err := parseListingDay(days[1], today)
+			if err != nil {
+				return time.Time{}, time.Time{}, fmt.Sprintf("Can't read the day `%s`.", days[1])
+			}
+			to = to.AddDate(0, 0, 1)
+			if !to.After(from) {
+				return time.Time{}, time.Time{}, "The range ends before it starts."
+			}
+			if to.After(from.AddDate(0, 0, maxListingDays)) {
+				return time.Time{}, time.Time{}, fmt.Sprintf("The range can't be longer than %d days.", maxListingDays)
+			}
+			return from, to, ""
+		})
+}
+
+func executeToday(p *Plugin, c *plugin.Context, header *model.CommandArgs, args ...string) *model.CommandResponse {
+	return p.executeListing(header, args, 0, "Usage: `/mbotc today [--scope channel|team|all]`",
+		func(today time.Time, _ []string) (time.Time, time.Time, string) {
+			return today, today.AddDate(0, 0, 1), ""
+		})
+}
+
+// listingPeriod returns the days to list, from inclusive and to exclusive, given the start of
+// today in the timezone of the user and the positional arguments of the command, or why they
+// are invalid.
+type listingPeriod func(today time.Time, args []string) (from, to time.Time, problem string)
+
+// executeListing shows the user the notices of a period in their channels, grouped by day, as
+// an interactive listing.
+func (p *Plugin) executeListing(header *model.CommandArgs, args []string, positional int, usage string, period listingPeriod) *model.CommandResponse {
+	flags, days, err := parseCommandFlags(args, "scope")
+	if err != nil || len(days) != positional {
+		p.postCommandResponse(header, usage)
+		return &model.CommandResponse{}
+	}
+	scope := flags["scope"]
+	switch scope {
+	case "":
+		scope = scopeAll
+	case scopeChannel, scopeTeam, scopeAll:
+	default:
+		p.postCommandResponse(header, usage)
+		return &model.CommandResponse{}
+	}
+
+	loc := p.userLocation(header.UserId)
+	now := time.Now().In(loc)
+	from, to, problem := period(time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc), days)
+	if problem != "" {
+		p.postCommandResponse(header, problem+"\n"+usage)
+		return &model.CommandResponse{}
+	}
+
+	query := listingQuery{From: from, To: to, Scope: scope, TeamId: header.TeamId}
+	post, err := p.listingPost(header.UserId, header.ChannelId, query, "")
+	if err != nil {
+		p.API.LogError("Failed to list notices", "user_id", header.UserId, "from", from.String(), "to", to.String(), "err", err.Error())
+		p.postCommandResponse(header, "Failed to get the notices. Please try again later.")
+		return &model.CommandResponse{}
+	}
+	_ = p.API.SendEphemeralPost(header.UserId, post)
+	return &model.CommandResponse{}
+}
+
+// listingQuery is what a page of an interactive listing shows. It is kept in the context of
+// the buttons of the listing, which render it again with another page or filter.
+type listingQuery struct {
+	From, To time.Time
+	Scope    string
+	// TeamId is the team the listing was asked in, for the team scope.
+	TeamId string
+	Filter string
+	Page   int
+}
+
+// describe tells which notices are listed, in the header of the listing.
+func (q listingQuery) describe() string {
+	what := map[string]string{scopeChannel: "in this channel", scopeTeam: "in this team", scopeAll: "in all your channels"}[q.Scope]
+	switch q.Filter {
+	case filterMine:
+		what += ", posted by you"
+	case filterChannel:
+		what = "in this channel"
+	case filterOverdue:
+		what += ", already over"
+	}
+	return what
+}
+
+func (q listingQuery) context(action string) map[string]interface{} {
+	return map[string]interface{}{
+		"action":  action,
+		"from":    q.From.Format(time.RFC3339),
+		"to":      q.To.Format(time.RFC3339),
+		"scope":   q.Scope,
+		"team_id": q.TeamId,
+		"filter":  q.Filter,
+		"page":    strconv.Itoa(q.Page),
+	}
+}
+
+// listingQueryFromContext reads the query of a listing from the context of one of its buttons.
+func listingQueryFromContext(context map[string]interface{}) (listingQuery, error) {
+	value := func(key string) string {
+		s, _ := context[key].(string)
+		return s
+	}
+
+	query := listingQuery{Scope: value("scope"), TeamId: value("team_id"), Filter: value("filter")}
+	var err error
+	if query.From, err = time.Parse(time.RFC3339, value("from")); err != nil {
+		return query, errors.Wrap(err, "invalid start of listing")
+	}
+	if query.To, err = time.Parse(time.RFC3339, value("to")); err != nil {
+		return query, errors.Wrap(err, "invalid end of listing")
+	}
+	if query.Page, err = strconv.Atoi(value("page")); err != nil {
+		return query, errors.Wrap(err, "invalid page of listing")
+	}
+	switch query.Scope {
+	case scopeChannel, scopeTeam, scopeAll:
+	default:
+		return query, errors.Errorf("invalid scope %q", query.Scope)
+	}
+	switch query.Filter {
+	case filterNone, filterMine, filterChannel, filterOverdue:
+	default:
+		return query, errors.Errorf("invalid filter %q", query.Filter)
+	}
+	return query, nil
+}
+
+// parseListingDay reads a day such as 2021-11-05 or "next fri", relative to today.
+func parseListingDay(value string, today time.Time) (time.Time, error) {
+	day, err := time.ParseInLocation(listingDayLayout, value, today.Location())
+	if err != nil {
+		if day, err = parseNoticeTime(value, today.Location()); err != nil {
+			return time.Time{}, err
+		}
+	}
+	return time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, today.Location()), nil
+}
+
+// listingPost renders a page of the listing as an ephemeral post in the channel, for the user.
+// The status, if any, is the result of the last action on the listing.
+func (p *Plugin) listingPost(userId, channelId string, query listingQuery, status string) (*model.Post, error) {
+	loc := p.userLocation(userId)
+	from, to := query.From.In(loc), query.To.In(loc)
+	occurrences, err := p.listUserOccurrences(userId, from, to.Add(-time.Minute))
+	if err != nil {
+		return nil, err
+	}
+	occurrences = filterOccurrences(occurrences, query, userId, channelId, time.Now())
+
+	pages := (len(occurrences) + listingPageSize - 1) / listingPageSize
+	if query.Page >= pages {
+		query.Page = pages - 1
+	}
+	if query.Page < 0 {
+		query.Page = 0
+	}
+	page := occurrences[query.Page*listingPageSize:]
+	if len(page) > listingPageSize {
+		page = page[:listingPageSize]
+	}
+
+	text := p.formatListing(page, from, to, query.describe(), loc)
+	if status != "" {
+		text = status + "\n\n" + text
+	}
+	post := &model.Post{
+		UserId:    p.botUserID,
+		ChannelId: channelId,
+		Message:   text,
+	}
+
+	var attachments []*model.SlackAttachment
+	for i, occurrence := range page {
+		acked, err := p.hasAcknowledged(occurrence.Notice.Id, userId)
+		if err != nil {
+			return nil, err
+		}
+		start := occurrence.Start.In(loc)
+		attachments = append(attachments, &model.SlackAttachment{
+			Text:    fmt.Sprintf("**%s** %s", start.Format("Mon 15:04"), truncateRunes(previewMessage(occurrence.Notice.Message), maxRowPreviewRunes)),
+			Actions: listingRowActions(query, i, occurrence, acked),
+		})
+	}
+
+	navigation := &model.SlackAttachment{
+		Color:   "#1352ab",
+		Text:    seeMoreLink(from),
+		Actions: listingNavigationActions(query, pages),
+	}
+	if pages > 1 {
+		navigation.Footer = fmt.Sprintf("Page %d of %d, %d notices", query.Page+1, pages, len(occurrences))
+	}
+	post.AddProp("attachments", append(attachments, navigation))
+	return post, nil
+}
+
+// filterOccurrences keeps the occurrences of the scope and the filter of the query. The
+// channel is the one the listing is shown in.
+func filterOccurrences(occurrences []NoticeOccurrence, query listingQuery, userId, channelId string, now time.Time) []NoticeOccurrence {
+	var filtered []NoticeOccurrence
+	for _, occurrence := range occurrences {
+		notice := occurrence.Notice
+		switch {
+		case query.Scope == scopeChannel && notice.ChannelId != channelId,
+			query.Scope == scopeTeam && notice.TeamId != query.TeamId,
+			query.Filter == filterMine && notice.UserId != userId,
+			query.Filter == filterChannel && notice.ChannelId != channelId,
+			query.Filter == filterOverdue && !occurrence.End.Before(now):
+			continue
+		}
+		filtered = append(filtered, occurrence)
+	}
+	return filtered
+}
+
+// formatListing renders the occurrences, sorted by start, as a table per day in loc. what
+// describes which notices are listed.
+func (p *Plugin) formatListing(occurrences []NoticeOccurrence, from, to time.Time, what string, loc *time.Location) string {
+	text := fmt.Sprintf("#### Notices from %s to %s %s\n",
+		from.Format("Mon "+listingDayLayout), to.AddDate(0, 0, -1).Format("Mon "+listingDayLayout), what)
+	if to.Equal(from.AddDate(0, 0, 1)) {
+		text = fmt.Sprintf("#### Notices of %s %s\n", from.Format("Mon "+listingDayLayout), what)
+	}
+	if len(occurrences) == 0 {
+		return text + "Nothing ...\n"
+	}
+
+	channelNames := map[string]string{}
+	channelName := func(channelId string) string {
+		name, ok := channelNames[channelId]
+		if !ok {
+			if channel, appErr := p.API.GetChannel(channelId); appErr == nil {
+				name = "~" + channel.Name
+			}
+			channelNames[channelId] = name
+		}
+		return name
+	}
+
+	day := ""
+	for _, occurrence := range occurrences {
+		start, end := occurrence.Start.In(loc), occurrence.End.In(loc)
+		if start.Format(listingDayLayout) != day {
+			day = start.Format(listingDayLayout)
+			text += "\n##### " + start.Format("Mon, "+listingDayLayout) + "\n" +
+				"| Time :clock3: | Preview :loudspeaker: | Channel |\n" +
+				"| --- | --- | --- |\n"
+		}
+
+		preview := escapeTableCell(previewMessage(occurrence.Notice.Message))
+		if occurrence.Notice.PostId != "" {
+			preview = fmt.Sprintf("[%s](%s/_redirect/pl/%s)", preview, p.siteURL(), occurrence.Notice.PostId)
+		}
+		text += "| " + formatListingTime(start, end) + " | " + preview + " | " + channelName(occurrence.Notice.ChannelId) + " |\n"
+	}
+	return text
+}
+
+// listingRowActions returns the buttons of the i-th notice on a page of the listing.
+func listingRowActions(query listingQuery, i int, occurrence NoticeOccurrence, acked bool) []*model.PostAction {
+	button := func(id, name, action string) *model.PostAction {
+		context := query.context(action)
+		context["notice_id"] = occurrence.Notice.Id
+		context["start"] = occurrence.Start.Format(time.RFC3339)
+		return listingButton(fmt.Sprintf("%s%d", id, i), name, context)
+	}
+
+	ack := button("ack", "Acknowledge", listingActionAck)
+	if acked {
+		ack.Name = "Acknowledged"
+		ack.Disabled = true
+	}
+	return []*model.PostAction{
+		button("view", "View", listingActionView),
+		button("remind", "Remind me", listingActionRemind),
+		ack,
+	}
+}
+
+// listingNavigationActions returns the page and filter buttons of the listing.
+func listingNavigationActions(query listingQuery, pages int) []*model.PostAction {
+	var actions []*model.PostAction
+	if query.Page > 0 {
+		previous := query
+		previous.Page--
+		actions = append(actions, listingButton("previous", "Prev", previous.context(listingActionShow)))
+	}
+	if query.Page < pages-1 {
+		next := query
+		next.Page++
+		actions = append(actions, listingButton("next", "Next", next.context(listingActionShow)))
+	}
+
+	for _, filter := range []struct{ id, name string }{
+		{filterNone, "All"},
+		{filterMine, "Mine"},
+		{filterChannel, "This channel"},
+		{filterOverdue, "Overdue"},
+	} {
+		filtered := query
+		filtered.Filter, filtered.Page = filter.id, 0
+		action := listingButton("filter"+filter.id, filter.name, filtered.context(listingActionShow))
+		if filter.id == query.Filter {
+			action.Style = "primary"
+		}
+		actions = append(actions, action)
+	}
+	return actions
+}
+
+// listingButton returns a button handled by handleListingAction. Ids of buttons are unique in
+// the post.
+func listingButton(id, name string, context map[string]interface{}) *model.PostAction {
+	return &model.PostAction{
+		Id:   id,
+		Name: name,
+		Type: model.POST_ACTION_TYPE_BUTTON,
+		Integration: &model.PostActionIntegration{
+			URL:     "/plugins/" + manifest.Id + "/actions/listing",
+			Context: context,
+		},
+	}
+}
+
+// handleListingAction handles the buttons of an interactive listing. The ephemeral post of the
+// listing is updated in place.
+func (p *Plugin) handleListingAction(w http.ResponseWriter, r *http.Request) {
+	userId := r.Header.Get("Mattermost-User-ID")
+	log := p.loggerFromContext(r.Context()).With("user_id", userId)
+
+	request := model.PostActionIntegrationRequestFromJson(r.Body)
+	if request == nil {
+		http.Error(w, "Invalid action request", http.StatusBadRequest)
+		return
+	}
+	query, err := listingQueryFromContext(request.Context)
+	if err != nil {
+		log.Warn("Rejected listing action", "err", err.Error())
+		writeActionResponse(w, "This list is out of date. Please run the command again.")
+		return
+	}
+
+	status := ""
+	action, _ := request.Context["action"].(string)
+	if action != listingActionShow {
+		noticeId, _ := request.Context["notice_id"].(string)
+		log = log.With("notice_id", noticeId, "action", action)
+		notice := p.getReadableNotice(noticeId, userId)
+		start, startErr := time.Parse(time.RFC3339, fmt.Sprint(request.Context["start"]))
+		switch {
+		case notice == nil:
+			status = "This notice doesn't exist anymore."
+		case startErr != nil:
+			log.Warn("Rejected listing action", "err", startErr.Error())
+			status = "This list is out of date. Please run the command again."
+		case action == listingActionView:
+			p.replaceEphemeralActionPost(w, userId, request, p.noticeDetailPost(userId, request.ChannelId, query, notice, start))
+			return
+		case action == listingActionRemind:
+			status, err = p.remindUser(userId, notice, start)
+		case action == listingActionAck:
+			status, err = p.acknowledgeNoticeAs(userId, notice)
+		}
+		if err != nil {
+			log.Error("Failed to handle listing action", "err", err.Error())
+			status = "Something went wrong. Please try again later."
+		}
+	}
+
+	post, err := p.listingPost(userId, request.ChannelId, query, status)
+	if err != nil {
+		log.Error("Failed to list notices", "err", err.Error())
+		writeActionResponse(w, "Failed to get the notices. Please try again later.")
+		return
+	}
+	p.replaceEphemeralActionPost(w, userId, request, post)
+}
+
+// getReadableNotice returns the notice if it is not cancelled and the user is a member of its
+// channel.
+func (p *Plugin) getReadableNotice(noticeId, userId string) *Notice {
+	notice, err := p.store.GetNotice(noticeId)
+	if err != nil || notice.DeleteAt != 0 {
+		return nil
+	}
+	if _, appErr := p.API.GetChannelMember(notice.ChannelId, userId); appErr != nil {
+		return nil
+	}
+	return notice
+}
+
+// noticeDetailPost shows the whole occurrence of the notice starting at start, with a button
+// back to the listing.
+func (p *Plugin) noticeDetailPost(userId, channelId string, query listingQuery, notice *Notice, start time.Time) *model.Post {
+	loc := p.userLocation(userId)
+	startTime, endTime, _ := notice.period()
+	end := start.Add(endTime.Sub(startTime))
+
+	text := "#### Notice"
+	if channel, appErr := p.API.GetChannel(notice.ChannelId); appErr == nil {
+		text += " in ~" + channel.Name
+	}
+	text += "\n**When**: " + formatNoticeTime(start, loc)
+	if !end.Equal(start) {
+		text += " – " + formatNoticeTime(end, loc)
+	}
+	if user, appErr := p.API.GetUser(notice.UserId); appErr == nil {
+		text += "\n**By**: @" + user.Username
+	}
+	if notice.Recurrence != nil {
+		text += "\n**Repeats**: " + describeRecurrence(notice.Recurrence)
+	}
+	text += "\n\n" + notice.Message
+	if notice.PostId != "" {
+		text += fmt.Sprintf("\n\n[Open the notice](%s/_redirect/pl/%s)", p.siteURL(), notice.PostId)
+	}
+
+	acked, _ := p.hasAcknowledged(notice.Id, userId)
+	actions := listingRowActions(query, 0, NoticeOccurrence{Occurrence: Occurrence{Start: start, End: end}, Notice: notice}, acked)[1:]
+	actions = append(actions, listingButton("back", "Back to the list", query.context(listingActionShow)))
+
+	post := &model.Post{
+		UserId:    p.botUserID,
+		ChannelId: channelId,
+		Message:   text,
+	}
+	post.AddProp("attachments", []*model.SlackAttachment{{
+		Color:   "#1352ab",
+		Actions: actions,
+	}})
+	return post
+}
+
+// seeMoreLink links to the notices of the day on the MBotC website.
+func seeMoreLink(day time.Time) string {
+	return "[See More](https://www.mbotc.com/main/detail/" + day.Format("20060102") + ")"
+}
+
+// formatListingTime renders when an occurrence happens, on the day it starts.
+func formatListingTime(start, end time.Time) string {
+	switch {
+	case end.Equal(start):
+		return start.Format("15:04")
+	case end.Format(listingDayLayout) == start.Format(listingDayLayout):
+		return start.Format("15:04") + "–" + end.Format("15:04")
+	default:
+		return start.Format("15:04") + " → " + end.Format("01-02 15:04")
+	}
+}
+
+// previewMessage puts the message on a line, cut to maxPreviewRunes characters.
+func previewMessage(message string) string {
+	return truncateRunes(strings.Join(strings.Fields(message), " "), maxPreviewRunes)
+}
+
+// truncateRunes cuts text to max characters, rather than bytes, so that Korean text is not
+// broken in the middle of a character.
+func truncateRunes(text string, max int) string {
+	if utf8.RuneCountInString(text) <= max {
+		return text
+	}
+	return string([]rune(text)[:max]) + " ..."
+}
+
+// escapeTableCell keeps text from ending a markdown table cell.
+func escapeTableCell(text string) string {
+	return strings.ReplaceAll(text, "|", "\\|")
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/mattermost/mattermost-server/v5/plugin/plugintest/mock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPreviewMessage(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal("line one line two", previewMessage("line one\n\nline  two"))
+
+	korean := strings.Repeat("공지", 60)
+	preview := previewMessage(korean)
+	assert.Equal(strings.Repeat("공지", 50)+" ...", preview)
+	assert.True(strings.HasPrefix(korean, strings.TrimSuffix(preview, " ...")))
+
+	assert.Equal(`a \| b`, escapeTableCell("a | b"))
+}
+
+func TestFormatListingTime(t *testing.T) {
+	assert := assert.New(t)
+
+	start := time.Date(2021, 11, 5, 9, 0, 0, 0, time.UTC)
+	assert.Equal("09:00", formatListingTime(start, start))
+	assert.Equal("09:00–18:00", formatListingTime(start, start.Add(9*time.Hour)))
+	assert.Equal("09:00 → 11-06 18:00", formatListingTime(start, start.Add(33*time.Hour)))
+}
+
+func TestExecuteRange(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	api := newKVAPI()
+	api.On("GetUser", "user1").Return(&model.User{Id: "user1", Timezone: map[string]string{
+		"useAutomaticTimezone": "false",
+		"manualTimezone":       "Asia/Seoul",
+	}}, nil)
+	api.On("GetChannelMember", "channel1", "user1").Return(&model.ChannelMember{}, nil)
+	api.On("GetChannelMember", "channel2", "user1").Return(&model.ChannelMember{}, nil)
+	api.On("GetChannelMember", "private", "user1").Return(nil, &model.AppError{Message: "not found"})
+	api.On("GetChannel", "channel1").Return(&model.Channel{Id: "channel1", Name: "town-square"}, nil)
+	api.On("GetChannel", "channel2").Return(&model.Channel{Id: "channel2", Name: "other-team"}, nil)
+	api.On("GetConfig").Return(&model.Config{ServiceSettings: model.ServiceSettings{SiteURL: model.NewString("https://mm.example.com")}})
+	var replies []string
+	api.On("SendEphemeralPost", "user1", mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+		replies = append(replies, args.Get(1).(*model.Post).Message)
+	})
+
+	p := &Plugin{botUserID: "bot"}
+	p.SetAPI(api)
+	p.store = NewStore(p)
+
+	seoul := loadLocation("Asia/Seoul")
+	for _, notice := range []*Notice{
+		{TeamId: "team1", ChannelId: "channel1", PostId: "post1", Message: "회의 | 3층", StartTime: "2021-11-05 09:00", EndTime: "2021-11-05 10:00"},
+		{TeamId: "team1", ChannelId: "channel1", Message: "Lunch", StartTime: "2021-11-05 12:00", EndTime: "2021-11-05 12:00"},
+		{TeamId: "team2", ChannelId: "channel2", Message: "Release", StartTime: "2021-11-08 18:00", EndTime: "2021-11-08 18:00"},
+		{TeamId: "team1", ChannelId: "private", Message: "Secret", StartTime: "2021-11-06 09:00", EndTime: "2021-11-06 09:00"},
+		{TeamId: "team1", ChannelId: "channel1", Message: "Later", StartTime: "2021-12-01 09:00", EndTime: "2021-12-01 09:00"},
+	} {
+		require.NoError(notice.localize(seoul))
+		require.NoError(p.store.CreateNotice(notice))
+	}
+
+	execute := func(command string) string {
+		replies = nil
+		_, appErr := p.ExecuteCommand(nil, &model.CommandArgs{UserId: "user1", TeamId: "team1", ChannelId: "channel1", Command: command})
+		require.Nil(appErr)
+		require.Len(replies, 1)
+		return replies[0]
+	}
+
+	assert.Equal("#### Notices from Mon 2021-11-01 to Sun 2021-11-07 in all your channels\n"+
+		"\n##### Fri, 2021-11-05\n"+
+		"| Time :clock3: | Preview :loudspeaker: | Channel |\n"+
+		"| --- | --- | --- |\n"+
+		"| 09:00–10:00 | [회의 \\| 3층](https://mm.example.com/_redirect/pl/post1) | ~town-square |\n"+
+		"| 12:00 | Lunch | ~town-square |\n",
+		execute("/mbotc range 2021-11-01 2021-11-07"))
+
+	text := execute("/mbotc range 2021-11-01 2021-11-30")
+	assert.Contains(text, "Release")
+	assert.Contains(text, "##### Mon, 2021-11-08")
+	assert.NotContains(text, "Secret")
+	assert.NotContains(text, "Later")
+
+	text = execute("/mbotc range 2021-11-01 2021-11-30 --scope team")
+	assert.Contains(text, "in this team")
+	assert.NotContains(text, "Release")
+	assert.Contains(text, "Lunch")
+
+	assert.Contains(execute("/mbotc range 2021-11-09 2021-11-10 --scope=channel"), "Nothing ...")
+	assert.Contains(execute("/mbotc range 2021-11-30 2021-11-01"), "The range ends before it starts.")
+	assert.Contains(execute("/mbotc range 2021-01-01 2021-12-31"), "can't be longer than 92 days")
+	assert.Contains(execute("/mbotc range someday 2021-11-01"), "Can't read the day `someday`.")
+	assert.Contains(execute("/mbotc range 2021-11-01"), "Usage: `/mbotc range")
+	assert.Contains(execute("/mbotc week --scope everything"), "Usage: `/mbotc week")
+}
+
+func TestListingAction(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	api := newKVAPI()
+	api.On("GetUser", "user1").Return(&model.User{Id: "user1", Username: "alice"}, nil)
+	api.On("GetChannelMember", "channel1", "user1").Return(&model.ChannelMember{}, nil)
+	api.On("GetChannel", "channel1").Return(&model.Channel{Id: "channel1", Name: "town-square"}, nil)
+	api.On("GetConfig").Return(&model.Config{})
+	var updated *model.Post
+	api.On("UpdateEphemeralPost", "user1", mock.Anything).Return(&model.Post{}).Run(func(args mock.Arguments) {
+		updated = args.Get(1).(*model.Post)
+	})
+
+	p := &Plugin{botUserID: "bot"}
+	p.SetAPI(api)
+	p.store = NewStore(p)
+	p.router = p.initRouter()
+
+	var notices []*Notice
+	for i := 0; i < listingPageSize+2; i++ {
+		notice := &Notice{UserId: "user2", TeamId: "team1", ChannelId: "channel1", Message: fmt.Sprintf("Notice %d", i),
+			StartTime: fmt.Sprintf("2021-11-05T%02d:00:00Z", i), EndTime: fmt.Sprintf("2021-11-05T%02d:00:00Z", i)}
+		if i == 0 {
+			notice.UserId = "user1"
+		}
+		require.NoError(p.store.CreateNotice(notice))
+		notices = append(notices, notice)
+	}
+
+	click := func(context map[string]interface{}) {
+		updated = nil
+		request := &model.PostActionIntegrationRequest{PostId: "ephemeral1", ChannelId: "channel1", Context: context}
+		r := httptest.NewRequest(http.MethodPost, "/actions/listing", bytes.NewReader(request.ToJson()))
+		r.Header.Set("Mattermost-User-ID", "user1")
+		p.ServeHTTP(nil, httptest.NewRecorder(), r)
+		require.NotNil(updated)
+		assert.Equal("ephemeral1", updated.Id)
+	}
+	buttons := func() map[string]*model.PostAction {
+		actions := map[string]*model.PostAction{}
+		for _, attachment := range updated.Attachments() {
+			for _, action := range attachment.Actions {
+				actions[action.Id] = action
+			}
+		}
+		return actions
+	}
+
+	query := listingQuery{
+		From:  time.Date(2021, 11, 5, 0, 0, 0, 0, time.UTC),
+		To:    time.Date(2021, 11, 6, 0, 0, 0, 0, time.UTC),
+		Scope: scopeAll,
+	}
+	click(query.context(listingActionShow))
+	assert.Contains(updated.Message, "#### Notices of Fri 2021-11-05 in all your channels")
+	assert.Contains(updated.Message, "Notice 9")
+	assert.NotContains(updated.Message, "Notice 10")
+	assert.Len(updated.Attachments(), listingPageSize+1)
+
+	click(buttons()["next"].Integration.Context)
+	assert.Contains(updated.Message, "Notice 11")
+	assert.NotContains(updated.Message, "Notice 9")
+	assert.Contains(buttons(), "previous")
+	assert.NotContains(buttons(), "next")
+
+	click(buttons()["filtermine"].Integration.Context)
+	assert.Contains(updated.Message, "posted by you")
+	assert.Contains(updated.Message, "Notice 0")
+	assert.NotContains(updated.Message, "Notice 1 ")
+	assert.Equal("primary", buttons()["filtermine"].Style)
+
+	click(buttons()["ack0"].Integration.Context)
+	assert.Contains(updated.Message, "You acknowledged the notice.")
+	assert.True(buttons()["ack0"].Disabled)
+	acks, err := p.store.ListNoticeAcks(notices[0].Id)
+	require.NoError(err)
+	assert.Equal([]string{"user1"}, acks)
+
+	click(buttons()["view0"].Integration.Context)
+	assert.Contains(updated.Message, "**By**: @alice")
+	assert.Contains(buttons(), "back")
+
+	request := &model.PostActionIntegrationRequest{PostId: "ephemeral1", Context: map[string]interface{}{"action": listingActionShow, "page": "x"}}
+	r := httptest.NewRequest(http.MethodPost, "/actions/listing", bytes.NewReader(request.ToJson()))
+	r.Header.Set("Mattermost-User-ID", "user1")
+	w := httptest.NewRecorder()
+	p.ServeHTTP(nil, w, r)
+	response := model.PostActionIntegrationResponseFromJson(w.Body)
+	require.NotNil(response)
+	assert.Contains(response.EphemeralText, "out of date")
+}
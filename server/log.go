@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+
+	"github.com/mattermost/mattermost-server/v5/plugin"
+)
+
+type loggerContextKey struct{}
+
+// logger writes to the server log through the plugin API, adding the same key value pairs to
+// every message. It is used to tag the logs of a request with the request, user and channel.
+type logger struct {
+	api    plugin.API
+	fields []interface{}
+}
+
+func newLogger(api plugin.API, keyValuePairs ...interface{}) logger {
+	return logger{api: api, fields: keyValuePairs}
+}
+
+// With returns a logger adding keyValuePairs to the fields of l.
+func (l logger) With(keyValuePairs ...interface{}) logger {
+	fields := make([]interface{}, 0, len(l.fields)+len(keyValuePairs))
+	fields = append(fields, l.fields...)
+	fields = append(fields, keyValuePairs...)
+	return logger{api: l.api, fields: fields}
+}
+
+func (l logger) Debug(msg string, keyValuePairs ...interface{}) {
+	l.api.LogDebug(msg, l.With(keyValuePairs...).fields...)
+}
+
+func (l logger) Info(msg string, keyValuePairs ...interface{}) {
+	l.api.LogInfo(msg, l.With(keyValuePairs...).fields...)
+}
+
+func (l logger) Warn(msg string, keyValuePairs ...interface{}) {
+	l.api.LogWarn(msg, l.With(keyValuePairs...).fields...)
+}
+
+func (l logger) Error(msg string, keyValuePairs ...interface{}) {
+	l.api.LogError(msg, l.With(keyValuePairs...).fields...)
+}
+
+func contextWithLogger(ctx context.Context, l logger) context.Context {
+	return context.WithValue(ctx, loggerContextKey{}, l)
+}
+
+// loggerFromContext returns the request logger stored in ctx, or a logger without fields.
+func (p *Plugin) loggerFromContext(ctx context.Context) logger {
+	if l, ok := ctx.Value(loggerContextKey{}).(logger); ok {
+		return l
+	}
+	return newLogger(p.API)
+}
@@ -0,0 +1,7 @@
+package main
+
+import (
+	root "github.com/mattermost/mattermost-plugin-starter-template"
+)
+
+var manifest = root.Manifest
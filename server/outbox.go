@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost-plugin-api/cluster"
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/pkg/errors"
+)
+
+const (
+	outboxJobKey   = "outbox_job"
+	outboxMutexKey = "outbox_mutex"
+
+	outboxInterval    = 15 * time.Second
+	outboxBaseBackoff = 30 * time.Second
+	outboxMaxBackoff  = time.Hour
+	outboxMaxAttempts = 10
+)
+
+type OutboxOperation string
+
+const (
+	OutboxCreate OutboxOperation = "create"
+	OutboxUpdate OutboxOperation = "update"
+	OutboxDelete OutboxOperation = "delete"
+)
+
+// OutboxItem is a backend call waiting to be delivered. Items stay in the KV store until the
+// backend accepts them, so delivery survives plugin restarts and moves with the cluster job.
+type OutboxItem struct {
+	Id            string          `json:"id"`
+	Operation     OutboxOperation `json:"operation"`
+	Notice        Notice          `json:"notice"`
+	Attempts      int             `json:"attempts"`
+	NextAttemptAt int64           `json:"next_attempt_at"`
+	LastError     string          `json:"last_error"`
+	CreateAt      int64           `json:"create_at"`
+
+	// Failed is set once the item is given up on. Failed items are only retried by an admin.
+	Failed bool `json:"failed"`
+}
+
+// startOutbox schedules the cluster-wide job delivering the outbox.
+func (p *Plugin) startOutbox() error {
+	mutex, err := cluster.NewMutex(p.API, outboxMutexKey)
+	if err != nil {
+		return errors.Wrap(err, "failed to create outbox mutex")
+	}
+	p.outboxMutex = mutex
+
+	job, err := cluster.Schedule(p.API, outboxJobKey, cluster.MakeWaitForInterval(outboxInterval), p.flushOutbox)
+	if err != nil {
+		return errors.Wrap(err, "failed to schedule outbox job")
+	}
+	p.outboxJob = job
+
+	return nil
+}
+
+// stopOutbox stops the outbox job on this node.
+func (p *Plugin) stopOutbox() error {
+	if p.outboxJob == nil {
+		return nil
+	}
+	return p.outboxJob.Close()
+}
+
+// enqueueBackendOperation stores a backend call for the notice in the outbox and tries to
+// deliver it right away.
+func (p *Plugin) enqueueBackendOperation(operation OutboxOperation, notice *Notice) error {
+	item := &OutboxItem{
+		Operation: operation,
+		Notice:    *notice,
+	}
+	if err := p.store.EnqueueOutboxItem(item); err != nil {
+		return err
+	}
+
+	go p.flushOutbox()
+	return nil
+}
+
+// flushOutbox delivers every due outbox item in the order they were enqueued. Items of a
+// notice are never delivered before an earlier, still pending item of the same notice.
+func (p *Plugin) flushOutbox() {
+	if p.outboxMutex != nil {
+		p.outboxMutex.Lock()
+		defer p.outboxMutex.Unlock()
+	}
+
+	items, err := p.store.ListOutboxItems()
+	if err != nil {
+		p.API.LogError("Failed to list outbox items", "err", err.Error())
+		return
+	}
+
+	now := model.GetMillis()
+	blocked := map[string]bool{}
+	for _, item := range items {
+		if blocked[item.Notice.Id] || item.Failed || item.NextAttemptAt > now {
+			blocked[item.Notice.Id] = true
+			continue
+		}
+
+		if !p.deliverOutboxItem(item) {
+			blocked[item.Notice.Id] = true
+		}
+	}
+}
+
+// deliverOutboxItem sends a single item to the backend and reports whether it was delivered.
+func (p *Plugin) deliverOutboxItem(item *OutboxItem) bool {
+	err := p.callBackend(item)
+	if err == nil {
+		if err = p.store.DeleteOutboxItem(item.Id); err != nil {
+			p.API.LogError("Failed to delete delivered outbox item", "outbox_id", item.Id, "err", err.Error())
+		}
+		return true
+	}
+
+	item.Attempts++
+	item.LastError = err.Error()
+	if !isRetryableBackendError(err) || item.Attempts >= outboxMaxAttempts {
+		item.Failed = true
+		p.API.LogError("Giving up on outbox item", "outbox_id", item.Id, "notice_id", item.Notice.Id, "operation", string(item.Operation), "attempts", item.Attempts, "err", err.Error())
+	} else {
+		item.NextAttemptAt = model.GetMillis() + outboxBackoff(item.Attempts).Milliseconds()
+		p.API.LogWarn("Failed to deliver outbox item, will retry", "outbox_id", item.Id, "notice_id", item.Notice.Id, "operation", string(item.Operation), "attempts", item.Attempts, "err", err.Error())
+	}
+
+	if err := p.store.UpdateOutboxItem(item); err != nil {
+		p.API.LogError("Failed to update outbox item", "outbox_id", item.Id, "err", err.Error())
+	}
+	return false
+}
+
+func (p *Plugin) callBackend(item *OutboxItem) error {
+	ctx := context.Background()
+	switch item.Operation {
+	case OutboxCreate:
+		return p.backend.CreateNotice(ctx, &item.Notice)
+	case OutboxUpdate:
+		return p.backend.UpdateNotice(ctx, &item.Notice)
+	case OutboxDelete:
+		err := p.backend.DeleteNotice(ctx, &item.Notice)
+		if errors.Is(err, ErrBackendNotFound) {
+			return nil
+		}
+		return err
+	default:
+		return errors.Errorf("unknown outbox operation %q", item.Operation)
+	}
+}
+
+// isRetryableBackendError reports whether a failed backend call may succeed later without the
+// request being changed. Rejected credentials are retried, as an admin may fix the API token.
+func isRetryableBackendError(err error) bool {
+	return errors.Is(err, ErrBackendUnavailable) || errors.Is(err, ErrBackendUnauthorized)
+}
+
+// outboxBackoff returns the delay before the next attempt, doubling with every attempt.
+func outboxBackoff(attempts int) time.Duration {
+	backoff := outboxBaseBackoff
+	for i := 1; i < attempts; i++ {
+		backoff *= 2
+		if backoff >= outboxMaxBackoff {
+			return outboxMaxBackoff
+		}
+	}
+	return backoff
+}
+
+// retryOutboxItem resets an item so the next flush delivers it again.
+func (p *Plugin) retryOutboxItem(id string) error {
+	item, err := p.store.GetOutboxItem(id)
+	if err != nil {
+		return err
+	}
+
+	item.Failed = false
+	item.Attempts = 0
+	item.NextAttemptAt = 0
+	if err := p.store.UpdateOutboxItem(item); err != nil {
+		return err
+	}
+
+	go p.flushOutbox()
+	return nil
+}
+
+// formatOutboxItems renders the outbox as a markdown table for the admin command.
+func formatOutboxItems(items []*OutboxItem) string {
+	if len(items) == 0 {
+		return "The outbox is empty. Every notice has been delivered to the backend."
+	}
+
+	text := "#### MBotC backend outbox\n" +
+		"| ID | Operation | Notice | Status | Attempts | Last Error |\n" +
+		"| --- | --- | --- | --- | --- | --- |\n"
+	for _, item := range items {
+		status := "pending"
+		if item.Failed {
+			status = "**failed**"
+		} else if item.NextAttemptAt > 0 {
+			status = "retry at " + model.GetTimeForMillis(item.NextAttemptAt).Format(noticeTimeLayout)
+		}
+		lastError := strings.NewReplacer("|", "\\|", "\n", " ").Replace(item.LastError)
+		text += fmt.Sprintf("| %s | %s | %s | %s | %d | %s |\n", item.Id, item.Operation, item.Notice.Id, status, item.Attempts, lastError)
+	}
+	return text
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeBackend records the notices sent to it and fails with err when set.
+type fakeBackend struct {
+	lock    sync.Mutex
+	err     error
+	created []Notice
+	updated []Notice
+	deleted []Notice
+	today   []DailyNotice
+}
+
+func (b *fakeBackend) CreateNotice(ctx context.Context, notice *Notice) error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.err != nil {
+		return b.err
+	}
+	b.created = append(b.created, *notice)
+	return nil
+}
+
+func (b *fakeBackend) UpdateNotice(ctx context.Context, notice *Notice) error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.err != nil {
+		return b.err
+	}
+	b.updated = append(b.updated, *notice)
+	return nil
+}
+
+func (b *fakeBackend) DeleteNotice(ctx context.Context, notice *Notice) error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.err != nil {
+		return b.err
+	}
+	b.deleted = append(b.deleted, *notice)
+	return nil
+}
+
+func (b *fakeBackend) ListToday(ctx context.Context, userId string) ([]DailyNotice, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.today, b.err
+}
+
+func (b *fakeBackend) ListRange(ctx context.Context, userId string, from, to time.Time) ([]DailyNotice, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.today, b.err
+}
+
+func newTestOutboxPlugin() (*Plugin, *fakeBackend) {
+	p := &Plugin{}
+	p.SetAPI(newKVAPI())
+	p.store = NewStore(p)
+	backend := &fakeBackend{}
+	p.backend = backend
+	return p, backend
+}
+
+func TestFlushOutbox(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	p, backend := newTestOutboxPlugin()
+
+	backend.err = &BackendError{StatusCode: 503, Message: "down"}
+	require.NoError(p.store.EnqueueOutboxItem(&OutboxItem{Operation: OutboxCreate, Notice: Notice{Id: "n1"}}))
+	require.NoError(p.store.EnqueueOutboxItem(&OutboxItem{Operation: OutboxUpdate, Notice: Notice{Id: "n1"}}))
+	p.flushOutbox()
+
+	items, err := p.store.ListOutboxItems()
+	require.NoError(err)
+	require.Len(items, 2)
+	assert.Equal(1, items[0].Attempts)
+	assert.False(items[0].Failed)
+	assert.Greater(items[0].NextAttemptAt, int64(0))
+	// The update waits for the create of the same notice.
+	assert.Equal(0, items[1].Attempts)
+
+	backend.err = nil
+	items[0].NextAttemptAt = 0
+	require.NoError(p.store.UpdateOutboxItem(items[0]))
+	p.flushOutbox()
+
+	items, err = p.store.ListOutboxItems()
+	require.NoError(err)
+	assert.Empty(items)
+	assert.Len(backend.created, 1)
+	assert.Len(backend.updated, 1)
+}
+
+func TestFlushOutboxGivesUpOnRejectedRequests(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	p, backend := newTestOutboxPlugin()
+
+	backend.err = &BackendError{StatusCode: 400, Message: "invalid notice"}
+	require.NoError(p.store.EnqueueOutboxItem(&OutboxItem{Operation: OutboxCreate, Notice: Notice{Id: "n1"}}))
+	p.flushOutbox()
+
+	items, err := p.store.ListOutboxItems()
+	require.NoError(err)
+	require.Len(items, 1)
+	assert.True(items[0].Failed)
+	assert.Contains(items[0].LastError, "invalid notice")
+}
+
+func TestOutboxBackoff(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(outboxBaseBackoff, outboxBackoff(1))
+	assert.Equal(2*outboxBaseBackoff, outboxBackoff(2))
+	assert.Equal(outboxMaxBackoff, outboxBackoff(20))
+}
@@ -3,18 +3,19 @@ package main
 import (
 	"bytes"
 	"encoding/json"
-	"fmt"
 	"io"
 	"io/ioutil"
 	"mime/multipart"
 	"net/http"
 	"path/filepath"
 	"regexp"
+	"strings"
 	"sync"
 
+	"github.com/gorilla/mux"
+	"github.com/mattermost/mattermost-plugin-api/cluster"
 	"github.com/mattermost/mattermost-server/v5/model"
 	"github.com/mattermost/mattermost-server/v5/plugin"
-
 	"github.com/pkg/errors"
 )
 
@@ -40,6 +41,33 @@ type Plugin struct {
 
 	// KV store
 	store Store
+
+	// backend is the client of the MBotC backend.
+	backend BackendClient
+
+	// outboxJob delivers the backend outbox, on one cluster node at a time.
+	outboxJob *cluster.Job
+
+	// outboxMutex serializes outbox deliveries across the cluster.
+	outboxMutex *cluster.Mutex
+
+	// reminderJob sends due reminders, on one cluster node at a time.
+	reminderJob *cluster.Job
+
+	// digestJob posts due digests, on one cluster node at a time.
+	digestJob *cluster.Job
+
+	// broadcastJob sends priority notices to channel members, on one cluster node at a time.
+	broadcastJob *cluster.Job
+
+	// audienceLock synchronizes access to audiences.
+	audienceLock sync.Mutex
+
+	// audiences caches the audience of channels for the counts on notice posts, by channel id.
+	audiences map[string]cachedAudience
+
+	// router serves the plugin HTTP routes.
+	router *mux.Router
 }
 
 // OnActivate is invoked when the plugin is activated. If an error is returned, the plugin
@@ -77,7 +105,22 @@ func (p *Plugin) OnActivate() error {
 		return errors.Wrap(appErr, "couldn't set profile image")
 	}
 
+	p.router = p.initRouter()
 	p.store = NewStore(p)
+	p.backend = NewBackendClient(p)
+
+	if err := p.startOutbox(); err != nil {
+		return err
+	}
+	if err := p.startReminders(); err != nil {
+		return err
+	}
+	if err := p.startDigests(); err != nil {
+		return err
+	}
+	if err := p.startBroadcasts(); err != nil {
+		return err
+	}
 
 	// getCommand() of command.go
 	command, err := p.getCommand()
@@ -93,14 +136,47 @@ func (p *Plugin) OnActivate() error {
 	return nil
 }
 
+// OnDeactivate is invoked when the plugin is deactivated.
+func (p *Plugin) OnDeactivate() error {
+	if err := p.stopReminders(); err != nil {
+		p.API.LogWarn("Failed to stop reminder job", "err", err.Error())
+	}
+	if err := p.stopDigests(); err != nil {
+		p.API.LogWarn("Failed to stop digest job", "err", err.Error())
+	}
+	if err := p.stopBroadcasts(); err != nil {
+		p.API.LogWarn("Failed to stop broadcast job", "err", err.Error())
+	}
+	return p.stopOutbox()
+}
+
 type Notice struct {
-	UserId    string   `json:"user_id"`
-	Message   string   `json:"message"`
-	StartTime string   `json:"start_time"`
-	EndTime   string   `json:"end_time"`
-	FileIds   []string `json:"file_ids"`
-	ChannelId string   `json:"channel_id"`
-	PostId    string   `json:"post_id"`
+	Id      string `json:"id"`
+	UserId  string `json:"user_id"`
+	Message string `json:"message"`
+	// StartTime and EndTime are ISO 8601 times in UTC, see Notice.localize. Before that, they
+	// hold the times as entered by the user.
+	StartTime string `json:"start_time"`
+	EndTime   string `json:"end_time"`
+	// TimeZone is the IANA timezone the times were entered in, empty for the server timezone.
+	TimeZone string   `json:"time_zone,omitempty"`
+	FileIds  []string `json:"file_ids"`
+	// Reminders lists the lead times of the reminders, e.g. "1d,1h". Empty means the configured
+	// default and "none" disables reminders.
+	Reminders string `json:"reminders"`
+	// Recurrence repeats the notice. StartTime and EndTime are the first occurrence.
+	Recurrence *RecurrenceRule `json:"recurrence,omitempty"`
+	// Priority is low, normal, high or urgent. Empty means normal.
+	Priority  string `json:"priority,omitempty"`
+	TeamId    string `json:"team_id"`
+	ChannelId string `json:"channel_id"`
+	PostId    string `json:"post_id"`
+	CreateAt  int64  `json:"create_at"`
+	UpdateAt  int64  `json:"update_at"`
+
+	// DeleteAt is set when the notice is cancelled. Cancelled notices are kept, but not listed.
+	DeleteAt    int64  `json:"delete_at"`
+	CancelledBy string `json:"cancelled_by,omitempty"`
 }
 
 type DialogForm struct {
@@ -118,12 +194,20 @@ type Sub struct {
 	StartTime string `json:"start_time"`
 	EndTime   string `json:"end_time"`
 	Content   string `json:"content"`
+	Reminders string `json:"reminders"`
+	Repeat    string `json:"repeat"`
+	SkipDates string `json:"skip_dates"`
+	Priority  string `json:"priority"`
 }
 
-func ConvertRequest(p *Plugin, r *http.Request) Notice {
+// ConvertRequest reads a notice from the multipart form posted by the MBotC frontend. The
+// attached files are uploaded separately by UploadRequestFiles, once the request is authorized.
+func ConvertRequest(p *Plugin, r *http.Request) (Notice, error) {
 	var notice Notice
 
-	r.ParseMultipartForm(32 << 20) // maxMemory 32MB
+	if err := r.ParseMultipartForm(32 << 20); err != nil { // maxMemory 32MB
+		return notice, errors.Wrap(err, "failed to parse multipart form")
+	}
 	notice.UserId = r.PostFormValue("user_id")
 	notice.Message = r.PostFormValue("message")
 	notice.StartTime = r.PostFormValue("start_time")
@@ -132,32 +216,62 @@ func ConvertRequest(p *Plugin, r *http.Request) Notice {
 		notice.EndTime = notice.StartTime
 	}
 	notice.ChannelId = r.PostFormValue("channel_id")
+	notice.Reminders = r.PostFormValue("reminders")
+	notice.Priority = normalizePriority(r.PostFormValue("priority"))
+
+	recurrence, err := parseRecurrenceFields(r.PostFormValue("repeat"), r.PostFormValue("skip_dates"))
+	if err != nil {
+		return notice, err
+	}
+	notice.Recurrence = recurrence
 
+	return notice, nil
+}
+
+// UploadRequestFiles uploads the files of a request parsed by ConvertRequest to the notice channel.
+func UploadRequestFiles(p *Plugin, r *http.Request, notice *Notice) error {
 	fileheaders := r.MultipartForm.File["file"]
 	for _, fileheader := range fileheaders {
 		file, err := fileheader.Open()
 		if err != nil {
-			fmt.Println("fileheader.Open() : ", err)
+			return errors.Wrapf(err, "failed to open file %s", fileheader.Filename)
 		}
 		bytefile, err := ConvertFileToByte(file)
+		file.Close()
 		if err != nil {
-			fmt.Println("ConvertRequest Error : ", err)
+			return errors.Wrapf(err, "failed to read file %s", fileheader.Filename)
 		}
-		notice.FileIds = append(notice.FileIds, UploadFileToMMChannel(p, bytefile, notice.ChannelId, fileheader.Filename))
+		fileId, err := UploadFileToMMChannel(p, bytefile, notice.ChannelId, fileheader.Filename)
+		if err != nil {
+			return err
+		}
+		notice.FileIds = append(notice.FileIds, fileId)
 	}
 
-	return notice
+	return nil
 }
 
-func ConvertDialogForm(p *Plugin, r *http.Request) (Notice, error) {
-	var notice Notice
-	var dialogForm DialogForm
+// requestFiles lists the files of a request parsed by ConvertRequest.
+func requestFiles(r *http.Request) []noticeFile {
+	var files []noticeFile
+	for _, fileheader := range r.MultipartForm.File["file"] {
+		files = append(files, noticeFile{Name: fileheader.Filename, Size: fileheader.Size})
+	}
+	return files
+}
 
-	err := json.NewDecoder(r.Body).Decode(&dialogForm)
-	if err != nil {
-		fmt.Println("ConvertDialogForm Error : ", err)
-		panic(err)
+// DecodeDialogForm reads a dialog submission.
+func DecodeDialogForm(r *http.Request) (DialogForm, error) {
+	var dialogForm DialogForm
+	if err := json.NewDecoder(r.Body).Decode(&dialogForm); err != nil {
+		return dialogForm, errors.Wrap(err, "failed to decode dialog submission")
 	}
+	return dialogForm, nil
+}
+
+// ConvertDialogForm reads a notice from a submission of the create or edit dialog.
+func ConvertDialogForm(dialogForm DialogForm) (Notice, error) {
+	var notice Notice
 
 	notice.UserId = dialogForm.UserId
 	notice.Message = dialogForm.Submission.Content
@@ -168,31 +282,23 @@ func ConvertDialogForm(p *Plugin, r *http.Request) (Notice, error) {
 	} else {
 		notice.EndTime = dialogForm.Submission.EndTime
 	}
+	notice.Reminders = strings.TrimSpace(dialogForm.Submission.Reminders)
+	notice.Priority = normalizePriority(dialogForm.Submission.Priority)
+	notice.TeamId = dialogForm.TeamId
 	notice.ChannelId = dialogForm.ChannelId
-	re := regexp.MustCompile(`^\d{4}-(0[1-9]|1[012])-(0[1-9]|[12][0-9]|3[01])\s([01][0-9]|2[0-3]):([012345][0-9])$`)
-	if !re.MatchString(notice.StartTime) || !re.MatchString(notice.EndTime) {
-		return notice, errors.New("Validation Failed")
-	}
-	return notice, nil
-}
 
-func SendErrorMessage(p *Plugin, notice Notice) {
-	if notice.StartTime == notice.EndTime {
-		notice.EndTime = ""
+	recurrence, err := parseRecurrenceFields(dialogForm.Submission.Repeat, dialogForm.Submission.SkipDates)
+	if err != nil {
+		return notice, err
 	}
+	notice.Recurrence = recurrence
 
-	post := &model.Post{
-		UserId:    p.botUserID,
-		ChannelId: notice.ChannelId,
-		Message: "Oops! Failed to Create Notice.\n" +
-			"Your Input: \n" +
-			"\nDate: " + notice.StartTime +
-			"\nEnd date: " + notice.EndTime +
-			"\nContent: " + notice.Message,
-	}
-	_ = p.API.SendEphemeralPost(notice.UserId, post)
+	return notice, nil
 }
 
+// noticeTimeRegexp matches a time typed as noticeTimeLayout rather than in words.
+var noticeTimeRegexp = regexp.MustCompile(`^\d{4}-(0[1-9]|1[012])-(0[1-9]|[12][0-9]|3[01])\s([01][0-9]|2[0-3]):([012345][0-9])$`)
+
 func ConvertFileToByte(file multipart.File) ([]byte, error) {
 	buf := bytes.NewBuffer(nil)
 	if _, err := io.Copy(buf, file); err != nil {
@@ -201,67 +307,221 @@ func ConvertFileToByte(file multipart.File) ([]byte, error) {
 	return buf.Bytes(), nil
 }
 
-func UploadFileToMMChannel(p *Plugin, file []byte, channelId string, fileName string) string {
-	res, err := p.API.UploadFile(file, channelId, fileName)
-	if err != nil {
-		fmt.Println("UploadFile Error : ", err)
+func UploadFileToMMChannel(p *Plugin, file []byte, channelId string, fileName string) (string, error) {
+	res, appErr := p.API.UploadFile(file, channelId, fileName)
+	if appErr != nil {
+		return "", errors.Wrapf(appErr, "failed to upload file %s", fileName)
 	}
-	return res.Id
+	return res.Id, nil
 }
 
-// ServeHTTP demonstrates a plugin that handles HTTP requests by greeting the world.
-func (p *Plugin) ServeHTTP(c *plugin.Context, w http.ResponseWriter, r *http.Request) {
-	var notice Notice
-	// 1. Convert request body to Notice
-	switch r.URL.Path {
-	case "/fe":
-		notice = ConvertRequest(p, r)
-	case "/mm":
-		var err error
-		notice, err = ConvertDialogForm(p, r)
-		if err != nil {
-			fmt.Print(err)
-			SendErrorMessage(p, notice)
-			return
-		}
-	default:
-		http.Error(w, "Bad Request", http.StatusBadRequest)
-		return
-	}
+// publishNotice announces the notice in its channel, records it in the store and queues it for
+// the backend. notice.Id and notice.PostId are set on success.
+func (p *Plugin) publishNotice(notice *Notice) error {
+	// The post actions refer to the notice id, so it is needed before the notice is stored.
+	notice.Id = model.NewId()
 
-	// 2. Create post (Mattermost)
+	// 1. Create post (Mattermost)
 	post := &model.Post{
 		UserId:    p.botUserID,
 		ChannelId: notice.ChannelId,
 		FileIds:   notice.FileIds,
 	}
-	attachment, err := asSlackAttachment(p, notice)
+	policy := p.getConfiguration().priorityPolicy(notice.priority().value)
+	post.Message = p.priorityMention(policy, notice.UserId, notice.ChannelId)
+	post.IsPinned = policy.Pin
+	attachment, err := asSlackAttachment(p, *notice)
 	if err != nil {
-		fmt.Print("asSlackAttachment error : ", err)
+		return err
 	}
 	post.AddProp("attachments", attachment)
 
 	resPost, appErr := p.API.CreatePost(post)
 	if appErr != nil {
-		http.Error(w, appErr.Error(), http.StatusInternalServerError)
-		return
+		return errors.Wrap(appErr, "failed to create post")
 	}
 	notice.PostId = resPost.Id
 
+	// 2. Record the notice in the KV store
+	if notice.TeamId == "" {
+		if channel, appErr := p.API.GetChannel(notice.ChannelId); appErr == nil {
+			notice.TeamId = channel.TeamId
+		}
+	}
+	if err := p.store.CreateNotice(notice); err != nil {
+		return errors.Wrap(err, "failed to store notice")
+	}
+	if err := p.scheduleReminders(notice); err != nil {
+		p.API.LogError("Failed to schedule reminders", "notice_id", notice.Id, "err", err.Error())
+	}
+	if policy.DirectMessage {
+		if err := p.queuePriorityDirectMessages(notice); err != nil {
+			p.API.LogError("Failed to queue priority notice for channel members", "notice_id", notice.Id, "err", err.Error())
+		}
+	}
+
 	// 3. Send Request to BackEnd if successfully create Post(mattermost)
-	siteURL := *p.API.GetConfig().ServiceSettings.SiteURL
+	if err := p.enqueueBackendOperation(OutboxCreate, notice); err != nil {
+		// The notice is visible and stored, so only the backend sync is lost.
+		p.API.LogError("Failed to enqueue notice for backend", "notice_id", notice.Id, "err", err.Error())
+	}
+	return nil
+}
 
-	requestUrl := siteURL + ":8080/api/v1/notification"
-	noticeJSON, err := json.Marshal(notice)
-	if err != nil {
-		fmt.Println(err)
+// editNotice applies the date and content of edited to the stored notice, then updates its
+// post and the backend, and replies in the post thread with what changed.
+func (p *Plugin) editNotice(notice *Notice, edited Notice, editorId string) error {
+	changes := describeNoticeChanges(*notice, edited)
+	if len(changes) == 0 {
+		return nil
+	}
+
+	notice.Message = edited.Message
+	notice.StartTime = edited.StartTime
+	notice.EndTime = edited.EndTime
+	notice.TimeZone = edited.TimeZone
+	notice.Reminders = edited.Reminders
+	notice.Recurrence = edited.Recurrence
+
+	// Raising the priority escalates the delivery like posting the notice with it did.
+	var policy priorityPolicy
+	if edited.priorityRank() > notice.priorityRank() {
+		policy = p.getConfiguration().priorityPolicy(edited.priority().value)
+	}
+	notice.Priority = edited.Priority
+
+	if err := p.updateNoticePost(notice); err != nil {
+		return err
+	}
+	if err := p.store.UpdateNotice(notice); err != nil {
+		return errors.Wrap(err, "failed to store notice")
+	}
+	if err := p.scheduleReminders(notice); err != nil {
+		p.API.LogError("Failed to schedule reminders", "notice_id", notice.Id, "err", err.Error())
+	}
+	if err := p.enqueueBackendOperation(OutboxUpdate, notice); err != nil {
+		p.API.LogError("Failed to enqueue notice update for backend", "notice_id", notice.Id, "err", err.Error())
+	}
+	if policy.Pin {
+		if err := p.pinNoticePost(notice); err != nil {
+			p.API.LogWarn("Failed to pin notice post", "notice_id", notice.Id, "err", err.Error())
+		}
+	}
+	if policy.DirectMessage {
+		if err := p.queuePriorityDirectMessages(notice); err != nil {
+			p.API.LogError("Failed to queue priority notice for channel members", "notice_id", notice.Id, "err", err.Error())
+		}
+	}
+
+	editor := editorId
+	if user, appErr := p.API.GetUser(editorId); appErr == nil {
+		editor = "@" + user.Username
+	}
+	reply := &model.Post{
+		UserId:    p.botUserID,
+		ChannelId: notice.ChannelId,
+		RootId:    notice.PostId,
+		Message:   ":pencil2: Notice updated by " + editor + "\n" + strings.Join(changes, "\n"),
+	}
+	if mention := p.priorityMention(policy, editorId, notice.ChannelId); mention != "" {
+		reply.Message = mention + " " + reply.Message
+	}
+	if _, appErr := p.API.CreatePost(reply); appErr != nil {
+		p.API.LogWarn("Failed to reply to updated notice", "notice_id", notice.Id, "err", appErr.Error())
+	}
+	return nil
+}
+
+// cancelNotice soft-deletes the notice, then deletes or re-renders its post depending on the
+// configuration, stops its reminders and removes it from the backend.
+func (p *Plugin) cancelNotice(notice *Notice, cancellerId string) error {
+	notice.DeleteAt = model.GetMillis()
+	notice.CancelledBy = cancellerId
+
+	if p.getConfiguration().DeleteCancelledPosts {
+		if appErr := p.API.DeletePost(notice.PostId); appErr != nil {
+			return errors.Wrapf(appErr, "failed to delete post %s", notice.PostId)
+		}
+	} else if err := p.updateNoticePost(notice); err != nil {
+		return err
 	}
 
-	resp, err := http.Post(requestUrl, "application/json", bytes.NewBuffer(noticeJSON))
+	if err := p.store.UpdateNotice(notice); err != nil {
+		return errors.Wrap(err, "failed to store notice")
+	}
+	if err := p.store.SetNoticeReminders(notice.Id, nil); err != nil {
+		p.API.LogError("Failed to remove reminders", "notice_id", notice.Id, "err", err.Error())
+	}
+	if err := p.enqueueBackendOperation(OutboxDelete, notice); err != nil {
+		p.API.LogError("Failed to enqueue notice deletion for backend", "notice_id", notice.Id, "err", err.Error())
+	}
+	return nil
+}
+
+// canManageNotice reports whether the user may cancel the notice: its author, or an admin of
+// its channel.
+func (p *Plugin) canManageNotice(userId string, notice *Notice) bool {
+	return userId == notice.UserId || p.API.HasPermissionToChannel(userId, notice.ChannelId, model.PERMISSION_MANAGE_CHANNEL_ROLES)
+}
+
+// updateNoticePost renders the notice again in its post.
+func (p *Plugin) updateNoticePost(notice *Notice) error {
+	post, appErr := p.API.GetPost(notice.PostId)
+	if appErr != nil {
+		return errors.Wrapf(appErr, "failed to get post %s", notice.PostId)
+	}
+
+	attachment, err := asSlackAttachment(p, *notice)
 	if err != nil {
-		panic(err)
+		return err
+	}
+	post.AddProp("attachments", attachment)
+
+	if _, appErr := p.API.UpdatePost(post); appErr != nil {
+		return errors.Wrapf(appErr, "failed to update post %s", notice.PostId)
+	}
+	return nil
+}
+
+// describeNoticeChanges lists the user visible differences between two versions of a notice
+// as markdown list items.
+func describeNoticeChanges(old, updated Notice) []string {
+	var changes []string
+	oldStart, oldEnd := old.formatPeriod(updated.location())
+	updatedStart, updatedEnd := updated.formatPeriod(updated.location())
+	if old.StartTime != updated.StartTime {
+		changes = append(changes, "- Date: "+oldStart+" → "+updatedStart)
+	}
+	if old.EndTime != updated.EndTime {
+		changes = append(changes, "- End date: "+oldEnd+" → "+updatedEnd)
+	}
+	if old.Reminders != updated.Reminders {
+		changes = append(changes, "- Reminders: "+describeReminders(old.Reminders)+" → "+describeReminders(updated.Reminders))
+	}
+	if old.priority() != updated.priority() {
+		changes = append(changes, "- Priority: "+old.priority().name+" → "+updated.priority().name)
+	}
+	if describeRecurrence(old.Recurrence) != describeRecurrence(updated.Recurrence) {
+		changes = append(changes, "- Repeats: "+describeRecurrence(old.Recurrence)+" → "+describeRecurrence(updated.Recurrence))
+	}
+	if old.Message != updated.Message {
+		changes = append(changes, "- Content:\n> "+strings.ReplaceAll(updated.Message, "\n", "\n> "))
 	}
-	defer resp.Body.Close()
+	return changes
+}
+
+func describeRecurrence(recurrence *RecurrenceRule) string {
+	if recurrence == nil {
+		return "never"
+	}
+	return recurrence.describe()
+}
+
+func describeReminders(spec string) string {
+	if spec == "" {
+		return "default"
+	}
+	return spec
 }
 
 // See https://developers.mattermost.com/extend/plugins/server/reference/
@@ -269,56 +529,129 @@ func asSlackAttachment(p *Plugin, notice Notice) ([]*model.SlackAttachment, erro
 	var text = notice.Message
 	var fields []*model.SlackAttachmentField
 
-	teamName, channelName := SearchTeamNameAndChannelName(p, notice.ChannelId)
+	teamName, channelName, err := SearchTeamNameAndChannelName(p, notice.ChannelId)
+	if err != nil {
+		return nil, err
+	}
 
 	var postBy = teamName + " / " + channelName
 
+	// The post is read by the whole channel, so times are shown in the author's timezone.
+	startTime, endTime := notice.formatPeriod(notice.location())
 	if notice.StartTime == notice.EndTime {
 		fields = append(fields, &model.SlackAttachmentField{
 			Title: ":calendar: Deadline",
-			Value: notice.StartTime,
+			Value: startTime,
 			Short: false,
 		})
 	} else {
 		fields = append(fields, &model.SlackAttachmentField{
 			Title: ":calendar: Start Time",
-			Value: notice.StartTime,
+			Value: startTime,
 			Short: true,
 		})
 		fields = append(fields, &model.SlackAttachmentField{
 			Title: ":calendar: End Time",
-			Value: notice.EndTime,
+			Value: endTime,
 			Short: true,
 		})
 	}
 
-	user, _ := p.API.GetUser(notice.UserId)
+	if notice.Recurrence != nil {
+		fields = append(fields, &model.SlackAttachmentField{
+			Title: ":repeat: Repeats",
+			Value: notice.Recurrence.describe(),
+			Short: false,
+		})
+	}
+
+	user, appErr := p.API.GetUser(notice.UserId)
+	if appErr != nil {
+		return nil, errors.Wrapf(appErr, "failed to get author %s", notice.UserId)
+	}
 	fields = append(fields, &model.SlackAttachmentField{
 		Title: ":lower_left_fountain_pen: Author",
 		Value: user.Username,
 		Short: false,
 	})
 
+	ackField, err := p.acknowledgementField(notice)
+	if err != nil {
+		return nil, err
+	}
+	if ackField != nil {
+		fields = append(fields, ackField)
+	}
+
+	rsvpField, err := p.rsvpField(notice)
+	if err != nil {
+		return nil, err
+	}
+	if rsvpField != nil {
+		fields = append(fields, rsvpField)
+	}
+
+	if notice.DeleteAt != 0 {
+		return []*model.SlackAttachment{
+			{
+				AuthorName: postBy,
+				Title:      ":no_entry_sign: Cancelled",
+				Color:      "#8b8b8b",
+				Text:       text,
+				Fields:     fields,
+			},
+		}, nil
+	}
+
 	// 작성자 이름, 기간시작(yyyy-mm-dd hh:mm), 기간끝, 컨텐츠, 팀, 채널
 	return []*model.SlackAttachment{
 		{
 			AuthorName: postBy,
-			Color:      "#1352ab",
+			Title:      priorityTitle(notice),
+			Color:      notice.priority().color,
 			Text:       text,
 			Fields:     fields,
+			Actions:    noticeActions(notice),
 		},
 	}, nil
 }
 
-func SearchTeamNameAndChannelName(p *Plugin, channelId string) (teamName string, channelName string) {
-	channel, err := p.API.GetChannel(channelId)
-	if err != nil {
-		fmt.Print("GetChannel Error", err)
+// noticeActions returns the buttons of a notice post, handled by the /actions routes.
+func noticeActions(notice Notice) []*model.PostAction {
+	var actions []*model.PostAction
+	if notice.isEvent() {
+		actions = rsvpActions(notice)
 	}
-	team, err := p.API.GetTeam(channel.TeamId)
-	if err != nil {
-		fmt.Print("GetTeam Error", err)
+	return append(actions, &model.PostAction{
+		Id:    "acknowledge",
+		Name:  "Acknowledge",
+		Type:  model.POST_ACTION_TYPE_BUTTON,
+		Style: "primary",
+		Integration: &model.PostActionIntegration{
+			URL:     "/plugins/" + manifest.Id + "/actions/acknowledge",
+			Context: map[string]interface{}{"notice_id": notice.Id},
+		},
+	}, &model.PostAction{
+		Id:    "cancel",
+		Name:  "Cancel notice",
+		Type:  model.POST_ACTION_TYPE_BUTTON,
+		Style: "danger",
+		Integration: &model.PostActionIntegration{
+			URL:     "/plugins/" + manifest.Id + "/actions/cancel",
+			Context: map[string]interface{}{"notice_id": notice.Id},
+		},
+	})
+}
+
+func SearchTeamNameAndChannelName(p *Plugin, channelId string) (teamName string, channelName string, err error) {
+	channel, appErr := p.API.GetChannel(channelId)
+	if appErr != nil {
+		return "", "", errors.Wrapf(appErr, "failed to get channel %s", channelId)
+	}
+	team, appErr := p.API.GetTeam(channel.TeamId)
+	if appErr != nil {
+		return "", "", errors.Wrapf(appErr, "failed to get team %s", channel.TeamId)
 	}
 
-	return team.DisplayName, channel.DisplayName
+	return team.DisplayName, channel.DisplayName, nil
 }
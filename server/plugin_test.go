@@ -4,14 +4,18 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
+	"github.com/mattermost/mattermost-server/v5/plugin/plugintest"
+	"github.com/mattermost/mattermost-server/v5/plugin/plugintest/mock"
 	"github.com/stretchr/testify/assert"
 )
 
 func TestServeHTTP(t *testing.T) {
 	assert := assert.New(t)
 	plugin := Plugin{}
+	plugin.router = plugin.initRouter()
 	w := httptest.NewRecorder()
 	r := httptest.NewRequest(http.MethodGet, "/", nil)
 
@@ -24,5 +28,59 @@ func TestServeHTTP(t *testing.T) {
 	assert.Nil(err)
 	bodyString := string(bodyBytes)
 
-	assert.Equal("Hello, world!", bodyString)
+	assert.Equal(http.StatusNotFound, result.StatusCode)
+	assert.Equal("404 page not found\n", bodyString)
+}
+
+func TestServeHTTPInvalidDialogSubmission(t *testing.T) {
+	assert := assert.New(t)
+	api := &plugintest.API{}
+	api.On("LogWarn", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return()
+	defer api.AssertExpectations(t)
+
+	plugin := Plugin{}
+	plugin.SetAPI(api)
+	plugin.router = plugin.initRouter()
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/mm", strings.NewReader("not json"))
+	r.Header.Set("Mattermost-User-ID", "user1")
+
+	plugin.ServeHTTP(nil, w, r)
+
+	assert.Equal(http.StatusBadRequest, w.Result().StatusCode)
+}
+
+func TestServeHTTPRecoversFromPanic(t *testing.T) {
+	assert := assert.New(t)
+	api := &plugintest.API{}
+	api.On("LogError", "Recovered from a panic", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return()
+	defer api.AssertExpectations(t)
+
+	plugin := Plugin{}
+	plugin.SetAPI(api)
+	plugin.router = plugin.initRouter()
+	plugin.router.HandleFunc("/panic", func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/panic", nil)
+
+	plugin.ServeHTTP(nil, w, r)
+
+	assert.Equal(http.StatusInternalServerError, w.Result().StatusCode)
+}
+
+func TestDescribeNoticeChanges(t *testing.T) {
+	assert := assert.New(t)
+	old := Notice{StartTime: "2021-11-05T00:00:00Z", EndTime: "2021-11-05T00:00:00Z", TimeZone: "Asia/Seoul", Message: "hello"}
+
+	assert.Empty(describeNoticeChanges(old, old))
+
+	updated := old
+	updated.EndTime = "2021-11-06T09:00:00Z"
+	updated.Message = "hello\nworld"
+	assert.Equal([]string{
+		"- End date: 2021-11-05 09:00 KST → 2021-11-06 18:00 KST",
+		"- Content:\n> hello\n> world",
+	}, describeNoticeChanges(old, updated))
 }
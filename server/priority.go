@@ -0,0 +1,288 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost-plugin-api/cluster"
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/pkg/errors"
+)
+
+const (
+	priorityLow    = "low"
+	priorityNormal = "normal"
+	priorityHigh   = "high"
+	priorityUrgent = "urgent"
+
+	// Mentions of the priority policies.
+	mentionNone    = "none"
+	mentionHere    = "here"
+	mentionChannel = "channel"
+
+	broadcastJobKey = "broadcast_job"
+	// broadcastInterval paces the direct messages of priority notices: every run sends one page
+	// of members of each queued notice.
+	broadcastInterval = 10 * time.Second
+
+	// broadcastMaxAttempts is how many times in a row a page of direct messages is tried before
+	// the broadcast is given up on. The delay between attempts grows as for the outbox.
+	broadcastMaxAttempts = 10
+
+	// defaultPriorityDirectMessageMaxMembers bounds the channels whose members get priority
+	// notices as direct messages, when the configuration doesn't.
+	defaultPriorityDirectMessageMaxMembers = 500
+)
+
+// Broadcast is a priority notice queued to be sent to the members of its channel as direct
+// messages. The members are listed when the notice is queued, so that members joining or
+// leaving while it is sent don't shift the pages.
+type Broadcast struct {
+	NoticeId string `json:"notice_id"`
+	// UserIds are the sorted ids of the members to send the notice to.
+	UserIds []string `json:"user_ids"`
+	// Next is the index in UserIds of the next member to send the notice to.
+	Next          int   `json:"next"`
+	Attempts      int   `json:"attempts"`
+	NextAttemptAt int64 `json:"next_attempt_at"`
+}
+
+// noticePriority is how the posts of a priority look.
+type noticePriority struct {
+	value, name, color, emoji string
+}
+
+// noticePriorities are the priorities of notices, from the lowest.
+var noticePriorities = []noticePriority{
+	{priorityLow, "Low", "#8b9bb4", ":small_blue_diamond:"},
+	{priorityNormal, "Normal", "#1352ab", ":loudspeaker:"},
+	{priorityHigh, "High", "#f2a001", ":warning:"},
+	{priorityUrgent, "Urgent", "#d24b4e", ":rotating_light:"},
+}
+
+// priorityPolicy is how the delivery of notices of a priority is escalated, see configuration.
+type priorityPolicy struct {
+	// Mention is mentionHere or mentionChannel to notify the channel of the notice post.
+	Mention string
+	// DirectMessage sends the notice to every member of the channel.
+	DirectMessage bool
+	// Pin pins the notice post in the channel.
+	Pin bool
+}
+
+func (policy priorityPolicy) mentions() bool {
+	return policy.Mention == mentionHere || policy.Mention == mentionChannel
+}
+
+// priorityMention returns the channel mention the policy adds to a post of the user, or an empty
+// string if there is none. Users who may not mention the channel themselves can't through the bot.
+func (p *Plugin) priorityMention(policy priorityPolicy, userId, channelId string) string {
+	if !policy.mentions() {
+		return ""
+	}
+	if !p.API.HasPermissionToChannel(userId, channelId, model.PERMISSION_USE_CHANNEL_MENTIONS) {
+		p.API.LogInfo("Dropped the channel mention of a priority notice", "user_id", userId, "channel_id", channelId)
+		return ""
+	}
+	return "@" + policy.Mention
+}
+
+// normalizePriority reads a priority as entered by a user. Unknown priorities are kept, for the
+// validation to report them.
+func normalizePriority(priority string) string {
+	return strings.ToLower(strings.TrimSpace(priority))
+}
+
+func isNoticePriority(priority string) bool {
+	for _, p := range noticePriorities {
+		if p.value == priority {
+			return true
+		}
+	}
+	return false
+}
+
+// priority returns the priority of the notice. Notices posted before priorities existed are normal.
+func (n *Notice) priority() noticePriority {
+	return noticePriorities[n.priorityRank()]
+}
+
+// priorityRank orders the priorities, from 0 for low. An empty priority ranks as normal.
+func (n *Notice) priorityRank() int {
+	for i, p := range noticePriorities {
+		if p.value == n.Priority {
+			return i
+		}
+	}
+	return 1
+}
+
+// priorityTitle is the title of the post of the notice. Normal notices have none.
+func priorityTitle(notice Notice) string {
+	priority := notice.priority()
+	if priority.value == priorityNormal {
+		return ""
+	}
+	return fmt.Sprintf("%s %s priority", priority.emoji, priority.name)
+}
+
+// priorityOptions are the options of the priority field of the create dialog.
+func priorityOptions() []*model.PostActionOptions {
+	var options []*model.PostActionOptions
+	for _, p := range noticePriorities {
+		options = append(options, &model.PostActionOptions{Text: p.emoji + " " + p.name, Value: p.value})
+	}
+	return options
+}
+
+// queuePriorityDirectMessages queues the notice to be sent to every member of its channel but
+// its author by the broadcast job. Channels larger than the configured cap are skipped.
+func (p *Plugin) queuePriorityDirectMessages(notice *Notice) error {
+	stats, appErr := p.API.GetChannelStats(notice.ChannelId)
+	if appErr != nil {
+		return errors.Wrapf(appErr, "failed to get stats of channel %s", notice.ChannelId)
+	}
+	if maxMembers := p.getConfiguration().priorityDirectMessageMaxMembers(); stats.MemberCount > int64(maxMembers) {
+		p.API.LogWarn("Skipped direct messages of a priority notice in a large channel",
+			"notice_id", notice.Id, "channel_id", notice.ChannelId, "member_count", stats.MemberCount, "max_members", maxMembers)
+		return nil
+	}
+
+	audience, err := p.listNoticeAudience(notice.ChannelId)
+	if err != nil {
+		return err
+	}
+	broadcast := Broadcast{NoticeId: notice.Id}
+	for _, user := range audience {
+		if user.Id != notice.UserId {
+			broadcast.UserIds = append(broadcast.UserIds, user.Id)
+		}
+	}
+	sort.Strings(broadcast.UserIds)
+	if len(broadcast.UserIds) == 0 {
+		return nil
+	}
+	return p.store.QueueBroadcast(broadcast)
+}
+
+// startBroadcasts schedules the cluster-wide job sending priority notices to channel members.
+func (p *Plugin) startBroadcasts() error {
+	job, err := cluster.Schedule(p.API, broadcastJobKey, cluster.MakeWaitForInterval(broadcastInterval), p.sendQueuedBroadcasts)
+	if err != nil {
+		return errors.Wrap(err, "failed to schedule broadcast job")
+	}
+	p.broadcastJob = job
+	return nil
+}
+
+// stopBroadcasts stops the broadcast job on this node.
+func (p *Plugin) stopBroadcasts() error {
+	if p.broadcastJob == nil {
+		return nil
+	}
+	return p.broadcastJob.Close()
+}
+
+// sendQueuedBroadcasts sends the next page of members of every queued broadcast. Failed pages
+// are retried with a growing delay. It runs on one cluster node at a time.
+func (p *Plugin) sendQueuedBroadcasts() {
+	queue, err := p.store.ListBroadcasts()
+	if err != nil {
+		p.API.LogError("Failed to list broadcasts", "err", err.Error())
+		return
+	}
+
+	now := model.GetMillis()
+	for _, broadcast := range queue {
+		if broadcast.NextAttemptAt > now {
+			continue
+		}
+
+		done, err := p.sendBroadcastPage(&broadcast)
+		if err != nil {
+			broadcast.Attempts++
+			if broadcast.Attempts >= broadcastMaxAttempts {
+				p.API.LogError("Giving up on priority notice direct messages", "notice_id", broadcast.NoticeId, "sent", broadcast.Next, "attempts", broadcast.Attempts, "err", err.Error())
+				done = true
+			} else {
+				broadcast.NextAttemptAt = now + outboxBackoff(broadcast.Attempts).Milliseconds()
+				p.API.LogWarn("Failed to send priority notice to channel members, will retry", "notice_id", broadcast.NoticeId, "sent", broadcast.Next, "attempts", broadcast.Attempts, "err", err.Error())
+			}
+		}
+		if done {
+			err = p.store.RemoveBroadcast(broadcast.NoticeId)
+		} else {
+			err = p.store.UpdateBroadcast(broadcast)
+		}
+		if err != nil {
+			p.API.LogError("Failed to save broadcast", "notice_id", broadcast.NoticeId, "err", err.Error())
+		}
+	}
+}
+
+// sendBroadcastPage sends the notice to the next page of members of the broadcast, advancing it
+// past every member sent to, and reports whether all of them were. Cancelled notices aren't sent
+// anymore, nor are members who left the channel.
+func (p *Plugin) sendBroadcastPage(broadcast *Broadcast) (bool, error) {
+	notice, err := p.store.GetNotice(broadcast.NoticeId)
+	if err == ErrNoticeNotFound {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if notice.DeleteAt != 0 {
+		return true, nil
+	}
+
+	channel, appErr := p.API.GetChannel(notice.ChannelId)
+	if appErr != nil {
+		return false, errors.Wrapf(appErr, "failed to get channel %s", notice.ChannelId)
+	}
+
+	message := p.priorityDirectMessage(notice, channel)
+	for sent := 0; sent < audiencePageSize && broadcast.Next < len(broadcast.UserIds); sent++ {
+		userId := broadcast.UserIds[broadcast.Next]
+		if _, appErr := p.API.GetChannelMember(notice.ChannelId, userId); appErr != nil && appErr.StatusCode != http.StatusNotFound {
+			return false, errors.Wrapf(appErr, "failed to get member %s of channel %s", userId, notice.ChannelId)
+		} else if appErr == nil {
+			if err := p.sendDirectMessage(userId, message); err != nil {
+				return false, err
+			}
+		}
+		broadcast.Next++
+	}
+
+	broadcast.Attempts = 0
+	broadcast.NextAttemptAt = 0
+	return broadcast.Next >= len(broadcast.UserIds), nil
+}
+
+// priorityDirectMessage is the direct message sending a priority notice to a channel member.
+func (p *Plugin) priorityDirectMessage(notice *Notice, channel *model.Channel) string {
+	priority := notice.priority()
+	message := fmt.Sprintf("%s **%s notice** in ~%s\n> %s", priority.emoji, priority.name, channel.Name, previewMessage(notice.Message))
+	if notice.PostId != "" {
+		message += fmt.Sprintf("\n\n[Open the notice](%s/_redirect/pl/%s)", p.siteURL(), notice.PostId)
+	}
+	return message
+}
+
+// pinNoticePost pins the post of the notice in its channel.
+func (p *Plugin) pinNoticePost(notice *Notice) error {
+	post, appErr := p.API.GetPost(notice.PostId)
+	if appErr != nil {
+		return errors.Wrapf(appErr, "failed to get post %s", notice.PostId)
+	}
+	if post.IsPinned {
+		return nil
+	}
+	post.IsPinned = true
+	if _, appErr := p.API.UpdatePost(post); appErr != nil {
+		return errors.Wrapf(appErr, "failed to pin post %s", notice.PostId)
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/mattermost/mattermost-server/v5/plugin/plugintest/mock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPriorityDelivery(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	api := newKVAPI()
+	api.On("GetUser", "author").Return(&model.User{Id: "author", Username: "author"}, nil)
+	api.On("GetChannel", "channel1").Return(&model.Channel{Id: "channel1", TeamId: "team1", Name: "town-square"}, nil)
+	api.On("GetTeam", "team1").Return(&model.Team{Id: "team1"}, nil)
+	api.On("GetConfig").Return(&model.Config{})
+	api.On("GetUsersInChannel", "channel1", "username", 0, audiencePageSize).Return([]*model.User{
+		{Id: "alice", Username: "alice"},
+		{Id: "author", Username: "author"},
+		{Id: "bot", Username: "mbotc", IsBot: true},
+		{Id: "bob", Username: "bob"},
+	}, nil)
+	api.On("HasPermissionToChannel", "author", "channel1", model.PERMISSION_USE_CHANNEL_MENTIONS).Return(true)
+	api.On("HasPermissionToChannel", "alice", "channel1", model.PERMISSION_USE_CHANNEL_MENTIONS).Return(false)
+	api.On("GetUser", "alice").Return(&model.User{Id: "alice", Username: "alice"}, nil)
+	api.On("GetDirectChannel", "author", "bot").Return(&model.Channel{Id: "dm_author"}, nil)
+	api.On("GetChannelStats", "channel1").Return(&model.ChannelStats{ChannelId: "channel1", MemberCount: 3}, nil)
+	api.On("GetDirectChannel", "alice", "bot").Return(nil, model.NewAppError("GetDirectChannel", "app.channel.get.app_error", nil, "", http.StatusInternalServerError)).Once()
+	api.On("GetDirectChannel", "alice", "bot").Return(&model.Channel{Id: "dm_alice"}, nil)
+	api.On("GetChannelMember", "channel1", "alice").Return(&model.ChannelMember{ChannelId: "channel1", UserId: "alice"}, nil)
+	api.On("GetChannelMember", "channel1", "bob").Return(nil, model.NewAppError("GetChannelMember", "app.channel.get_member.missing.app_error", nil, "", http.StatusNotFound))
+	var posts []*model.Post
+	api.On("CreatePost", mock.Anything).Return(func(post *model.Post) *model.Post {
+		posts = append(posts, post)
+		post.Id = model.NewId()
+		return post
+	}, nil)
+	var updated *model.Post
+	api.On("GetPost", mock.Anything).Return(func(id string) *model.Post {
+		return &model.Post{Id: id}
+	}, nil)
+	api.On("UpdatePost", mock.Anything).Return(&model.Post{}, nil).Run(func(args mock.Arguments) {
+		updated = args.Get(0).(*model.Post)
+	})
+
+	p := &Plugin{botUserID: "bot"}
+	p.SetAPI(api)
+	p.store = NewStore(p)
+	p.backend = &fakeBackend{}
+	p.setConfiguration(&configuration{
+		ReminderLeadTimes:           noRemindersSpec,
+		HighPriorityPin:             true,
+		UrgentPriorityMention:       mentionChannel,
+		UrgentPriorityDirectMessage: true,
+		UrgentPriorityPin:           true,
+	})
+
+	notice := &Notice{UserId: "author", ChannelId: "channel1", Message: "Server maintenance",
+		StartTime: "2021-11-05T09:00:00Z", EndTime: "2021-11-05T09:00:00Z"}
+	require.NoError(p.publishNotice(notice))
+	require.Len(posts, 1)
+	assert.Empty(posts[0].Message)
+	assert.False(posts[0].IsPinned)
+	attachment := posts[0].Attachments()[0]
+	assert.Equal("#1352ab", attachment.Color)
+	assert.Empty(attachment.Title)
+
+	posts = nil
+	urgent := &Notice{UserId: "author", ChannelId: "channel1", Message: "Evacuate the 3rd floor", Priority: priorityUrgent,
+		StartTime: "2021-11-05T09:00:00Z", EndTime: "2021-11-05T09:00:00Z"}
+	require.NoError(p.publishNotice(urgent))
+	require.Len(posts, 1)
+	assert.Equal("@channel", posts[0].Message)
+	assert.True(posts[0].IsPinned)
+	attachment = posts[0].Attachments()[0]
+	assert.Equal("#d24b4e", attachment.Color)
+	assert.Equal(":rotating_light: Urgent priority", attachment.Title)
+
+	// The direct messages are sent in the background, to the members but the author. Failures
+	// are retried later.
+	posts = nil
+	p.sendQueuedBroadcasts()
+	assert.Empty(posts)
+	queue, err := p.store.ListBroadcasts()
+	require.NoError(err)
+	require.Len(queue, 1)
+	assert.Equal([]string{"alice", "bob"}, queue[0].UserIds)
+	assert.Equal(1, queue[0].Attempts)
+	assert.Greater(queue[0].NextAttemptAt, model.GetMillis())
+	p.sendQueuedBroadcasts()
+	assert.Empty(posts)
+
+	// Members who left the channel since the notice was queued are skipped.
+	queue[0].NextAttemptAt = 0
+	require.NoError(p.store.UpdateBroadcast(queue[0]))
+	p.sendQueuedBroadcasts()
+	require.Len(posts, 1)
+	assert.Equal("dm_alice", posts[0].ChannelId)
+	assert.Contains(posts[0].Message, ":rotating_light: **Urgent notice** in ~town-square")
+	queue, err = p.store.ListBroadcasts()
+	require.NoError(err)
+	assert.Empty(queue)
+
+	// Users who may not mention the channel don't through the bot.
+	posts = nil
+	urgent = &Notice{UserId: "alice", ChannelId: "channel1", Message: "Evacuate the 3rd floor", Priority: priorityUrgent,
+		StartTime: "2021-11-05T09:00:00Z", EndTime: "2021-11-05T09:00:00Z"}
+	require.NoError(p.publishNotice(urgent))
+	require.Len(posts, 1)
+	assert.Empty(posts[0].Message)
+	assert.True(posts[0].IsPinned)
+
+	// Channels over the member cap don't get direct messages.
+	p.setConfiguration(&configuration{ReminderLeadTimes: noRemindersSpec, UrgentPriorityDirectMessage: true, PriorityDirectMessageMaxMembers: 2})
+	queue, err = p.store.ListBroadcasts()
+	require.NoError(err)
+	require.Len(queue, 1)
+	require.NoError(p.store.RemoveBroadcast(queue[0].NoticeId))
+	require.NoError(p.queuePriorityDirectMessages(urgent))
+	queue, err = p.store.ListBroadcasts()
+	require.NoError(err)
+	assert.Empty(queue)
+	p.setConfiguration(&configuration{ReminderLeadTimes: noRemindersSpec, HighPriorityPin: true})
+
+	// Raising the priority of a notice escalates its delivery.
+	posts = nil
+	edited := *notice
+	edited.Priority = priorityHigh
+	require.NoError(p.editNotice(notice, edited, "author"))
+	require.NotNil(updated)
+	assert.True(updated.IsPinned)
+	require.Len(posts, 1)
+	assert.Contains(posts[0].Message, "- Priority: Normal → High")
+	assert.Equal(priorityHigh, notice.Priority)
+}
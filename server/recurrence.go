@@ -0,0 +1,438 @@
+package main
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	FrequencyDaily   = "DAILY"
+	FrequencyWeekly  = "WEEKLY"
+	FrequencyMonthly = "MONTHLY"
+
+	// recurrenceDateLayout is the format of RecurrenceRule.Until and RecurrenceRule.Exceptions.
+	recurrenceDateLayout = "2006-01-02"
+
+	// maxRecurrenceIterations bounds the expansion of a rule, whatever its Count and Until.
+	maxRecurrenceIterations = 10000
+)
+
+var weekdayCodes = map[string]time.Weekday{
+	"SU": time.Sunday,
+	"MO": time.Monday,
+	"TU": time.Tuesday,
+	"WE": time.Wednesday,
+	"TH": time.Thursday,
+	"FR": time.Friday,
+	"SA": time.Saturday,
+}
+
+// RecurrenceRule repeats a notice with the semantics of an RFC 5545 RRULE, limited to the
+// DAILY, WEEKLY and MONTHLY frequencies. Occurrences keep the wall clock time of the first
+// one, so a 09:00 stand-up stays at 09:00 across daylight saving time transitions.
+type RecurrenceRule struct {
+	Frequency string `json:"frequency"`
+	Interval  int    `json:"interval,omitempty"`
+	// ByWeekday lists two letter weekday codes, e.g. "MO", for weekly rules.
+	ByWeekday []string `json:"by_weekday,omitempty"`
+	// Until is the last day an occurrence may start on, inclusive.
+	Until string `json:"until,omitempty"`
+	// Count is the maximum number of occurrences, including skipped ones.
+	Count int `json:"count,omitempty"`
+	// Exceptions lists the days on which an occurrence is skipped.
+	Exceptions []string `json:"exceptions,omitempty"`
+}
+
+// ParseRecurrenceRule parses an RRULE value such as "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,WE" and a
+// comma separated list of days to skip. The shorthands "daily", "weekly" and "monthly" are
+// accepted for the rule. An empty rule means no recurrence.
+func ParseRecurrenceRule(rule, exceptions string) (*RecurrenceRule, error) {
+	rule = strings.ToUpper(strings.TrimPrefix(strings.TrimSpace(rule), "RRULE:"))
+	if rule == "" {
+		if strings.TrimSpace(exceptions) != "" {
+			return nil, errors.New("skipped dates require a recurrence rule")
+		}
+		return nil, nil
+	}
+
+	r := &RecurrenceRule{}
+	switch rule {
+	case FrequencyDaily, FrequencyWeekly, FrequencyMonthly:
+		r.Frequency = rule
+	default:
+		for _, part := range strings.Split(rule, ";") {
+			if err := r.parsePart(part); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	for _, value := range strings.Split(exceptions, ",") {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		day, err := parseRecurrenceDate(value)
+		if err != nil {
+			return nil, errors.Errorf("invalid skipped date %q", value)
+		}
+		r.Exceptions = append(r.Exceptions, day)
+	}
+
+	if err := r.IsValid(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *RecurrenceRule) parsePart(part string) error {
+	name, value := part, ""
+	if i := strings.Index(part, "="); i >= 0 {
+		name, value = part[:i], part[i+1:]
+	}
+
+	var err error
+	switch name {
+	case "FREQ":
+		r.Frequency = value
+	case "INTERVAL":
+		r.Interval, err = strconv.Atoi(value)
+	case "COUNT":
+		r.Count, err = strconv.Atoi(value)
+	case "UNTIL":
+		r.Until, err = parseRecurrenceDate(value)
+	case "BYDAY":
+		r.ByWeekday = strings.Split(value, ",")
+	case "WKST":
+		// Weeks always start on Monday, the RFC 5545 default.
+	default:
+		return errors.Errorf("unsupported recurrence rule part %q", part)
+	}
+	if err != nil {
+		return errors.Errorf("invalid recurrence rule part %q", part)
+	}
+	return nil
+}
+
+// parseRecurrenceDate reads a day as YYYY-MM-DD, YYYYMMDD or an RFC 5545 date-time.
+func parseRecurrenceDate(value string) (string, error) {
+	for _, layout := range []string{recurrenceDateLayout, "20060102"} {
+		if len(value) >= len(layout) {
+			if day, err := time.Parse(layout, value[:len(layout)]); err == nil {
+				return day.Format(recurrenceDateLayout), nil
+			}
+		}
+	}
+	return "", errors.Errorf("invalid date %q", value)
+}
+
+// IsValid checks the rule for unsupported values.
+func (r *RecurrenceRule) IsValid() error {
+	switch r.Frequency {
+	case FrequencyDaily, FrequencyMonthly:
+		if len(r.ByWeekday) > 0 {
+			return errors.New("weekdays are only supported by weekly recurrences")
+		}
+	case FrequencyWeekly:
+		for _, code := range r.ByWeekday {
+			if _, ok := weekdayCodes[code]; !ok {
+				return errors.Errorf("invalid weekday %q", code)
+			}
+		}
+	default:
+		return errors.Errorf("unsupported recurrence frequency %q", r.Frequency)
+	}
+
+	if r.Interval < 0 || r.Count < 0 {
+		return errors.New("recurrence interval and count must not be negative")
+	}
+	if r.Until != "" && r.Count != 0 {
+		return errors.New("a recurrence can't have both an end date and a count")
+	}
+	return nil
+}
+
+// String formats the rule as an RRULE value, without the exceptions.
+func (r *RecurrenceRule) String() string {
+	parts := []string{"FREQ=" + r.Frequency}
+	if r.Interval > 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(r.Interval))
+	}
+	if len(r.ByWeekday) > 0 {
+		parts = append(parts, "BYDAY="+strings.Join(r.ByWeekday, ","))
+	}
+	if r.Until != "" {
+		parts = append(parts, "UNTIL="+strings.ReplaceAll(r.Until, "-", ""))
+	}
+	if r.Count > 0 {
+		parts = append(parts, "COUNT="+strconv.Itoa(r.Count))
+	}
+	return strings.Join(parts, ";")
+}
+
+// Occurrences returns the start times of the occurrences starting between from and to,
+// inclusive, of the rule whose first occurrence starts at first. The times are in the location
+// of first. The expansion starts at the period of from, so that its cost doesn't grow with the
+// age of the rule; an error is returned if the window holds too many periods.
+func (r *RecurrenceRule) Occurrences(first, from, to time.Time) ([]time.Time, error) {
+	interval := r.Interval
+	if interval == 0 {
+		interval = 1
+	}
+
+	var until time.Time
+	if r.Until != "" {
+		if day, err := time.ParseInLocation(recurrenceDateLayout, r.Until, first.Location()); err == nil {
+			until = day.AddDate(0, 0, 1)
+		}
+	}
+	exceptions := map[string]bool{}
+	for _, day := range r.Exceptions {
+		exceptions[day] = true
+	}
+
+	skipped := 0
+	if from.After(first) {
+		// The periods before the one of from only hold occurrences on earlier days.
+		skipped = r.periodsBefore(first, from.In(first.Location())) / interval
+	}
+	count := 0
+	if r.Count > 0 {
+		count = r.countBefore(first, skipped, interval)
+	}
+
+	var occurrences []time.Time
+	for i := skipped; i < skipped+maxRecurrenceIterations; i++ {
+		for _, candidate := range r.period(first, i*interval) {
+			if candidate.Before(first) {
+				continue
+			}
+			if candidate.After(to) || (!until.IsZero() && !candidate.Before(until)) {
+				return occurrences, nil
+			}
+			count++
+			if r.Count > 0 && count > r.Count {
+				return occurrences, nil
+			}
+			if !candidate.Before(from) && !exceptions[candidate.Format(recurrenceDateLayout)] {
+				occurrences = append(occurrences, candidate)
+			}
+		}
+	}
+	return nil, errors.Errorf("recurrence has more than %d periods between %s and %s", maxRecurrenceIterations, from.Format(time.RFC3339), to.Format(time.RFC3339))
+}
+
+// periodsBefore returns the number of days, weeks or months from the one of first to the one
+// of t, ignoring the interval.
+func (r *RecurrenceRule) periodsBefore(first, t time.Time) int {
+	switch r.Frequency {
+	case FrequencyDaily:
+		return daysBetweenDates(first, t)
+	case FrequencyWeekly:
+		return (daysBetweenDates(first, t) + mondayOffset(first.Weekday())) / 7
+	case FrequencyMonthly:
+		return (t.Year()-first.Year())*12 + int(t.Month()) - int(first.Month())
+	default:
+		return 0
+	}
+}
+
+// countBefore returns the number of occurrences, exceptions included, in the periods before the
+// n-th one, as counted against the rule Count.
+func (r *RecurrenceRule) countBefore(first time.Time, n, interval int) int {
+	if n == 0 {
+		return 0
+	}
+	count := 0
+	for _, candidate := range r.period(first, 0) {
+		if !candidate.Before(first) {
+			count++
+		}
+	}
+	if r.Frequency != FrequencyMonthly || first.Day() <= 28 {
+		// The later periods all have as many occurrences.
+		return count + (n-1)*len(r.period(first, interval))
+	}
+	for i := 1; i < n; i++ {
+		count += len(r.period(first, i*interval))
+	}
+	return count
+}
+
+// daysBetweenDates returns the number of calendar days from the date of from to the date of to.
+func daysBetweenDates(from, to time.Time) int {
+	fromDay := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, time.UTC)
+	toDay := time.Date(to.Year(), to.Month(), to.Day(), 0, 0, 0, 0, time.UTC)
+	return int(toDay.Sub(fromDay).Hours() / 24)
+}
+
+// period returns the candidate occurrences of the n-th day, week or month after first.
+func (r *RecurrenceRule) period(first time.Time, n int) []time.Time {
+	year, month, day := first.Date()
+	hour, min, sec := first.Clock()
+	loc := first.Location()
+
+	switch r.Frequency {
+	case FrequencyDaily:
+		return []time.Time{time.Date(year, month, day+n, hour, min, sec, 0, loc)}
+	case FrequencyWeekly:
+		weekdays := []time.Weekday{first.Weekday()}
+		if len(r.ByWeekday) > 0 {
+			weekdays = nil
+			for _, code := range r.ByWeekday {
+				weekdays = append(weekdays, weekdayCodes[code])
+			}
+		}
+		sort.Slice(weekdays, func(i, j int) bool { return mondayOffset(weekdays[i]) < mondayOffset(weekdays[j]) })
+
+		monday := day - mondayOffset(first.Weekday()) + 7*n
+		var candidates []time.Time
+		for _, weekday := range weekdays {
+			candidates = append(candidates, time.Date(year, month, monday+mondayOffset(weekday), hour, min, sec, 0, loc))
+		}
+		return candidates
+	case FrequencyMonthly:
+		// Months without the day of the first occurrence, such as the 31st, are skipped.
+		monthStart := time.Date(year, month+time.Month(n), 1, hour, min, sec, 0, loc)
+		candidate := monthStart.AddDate(0, 0, day-1)
+		if candidate.Month() != monthStart.Month() {
+			return nil
+		}
+		return []time.Time{candidate}
+	default:
+		return nil
+	}
+}
+
+// mondayOffset returns the number of days from Monday to the weekday.
+func mondayOffset(weekday time.Weekday) int {
+	return (int(weekday) + 6) % 7
+}
+
+// describe formats the rule for humans, e.g. "every 2 weeks on MO, WE until 2021-12-31".
+func (r *RecurrenceRule) describe() string {
+	unit := map[string]string{FrequencyDaily: "day", FrequencyWeekly: "week", FrequencyMonthly: "month"}[r.Frequency]
+	text := "every " + unit
+	if r.Interval > 1 {
+		text = "every " + strconv.Itoa(r.Interval) + " " + unit + "s"
+	}
+	if len(r.ByWeekday) > 0 {
+		text += " on " + strings.Join(r.ByWeekday, ", ")
+	}
+	if r.Until != "" {
+		text += " until " + r.Until
+	}
+	if r.Count > 0 {
+		text += ", " + strconv.Itoa(r.Count) + " times"
+	}
+	if len(r.Exceptions) > 0 {
+		text += " except " + strings.Join(r.Exceptions, ", ")
+	}
+	return text
+}
+
+// Occurrence is a single period of a notice.
+type Occurrence struct {
+	Start time.Time
+	End   time.Time
+}
+
+// occurrencesBetween returns the occurrences of the notice overlapping [from, to].
+func (n *Notice) occurrencesBetween(from, to time.Time) ([]Occurrence, error) {
+	start, end, err := n.period()
+	if err != nil {
+		return nil, nil
+	}
+
+	if n.Recurrence == nil {
+		if end.Before(from) || start.After(to) {
+			return nil, nil
+		}
+		return []Occurrence{{Start: start, End: end}}, nil
+	}
+
+	// Occurrences that started before from overlap it until they end.
+	duration := end.Sub(start)
+	starts, err := n.Recurrence.Occurrences(start, from.Add(-duration), to)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to expand recurrence of notice %s", n.Id)
+	}
+	var occurrences []Occurrence
+	for _, occurrenceStart := range starts {
+		occurrences = append(occurrences, Occurrence{Start: occurrenceStart, End: occurrenceStart.Add(duration)})
+	}
+	return occurrences, nil
+}
+
+// hasOccurrenceAt reports whether an occurrence of the notice starts at start.
+func (n *Notice) hasOccurrenceAt(start time.Time) (bool, error) {
+	occurrences, err := n.occurrencesBetween(start, start)
+	if err != nil {
+		return false, err
+	}
+	for _, occurrence := range occurrences {
+		if occurrence.Start.Equal(start) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// NoticeOccurrence is an occurrence together with its notice.
+type NoticeOccurrence struct {
+	Occurrence
+	Notice *Notice
+}
+
+// listUserOccurrences returns the occurrences between from and to of the notices in the
+// channels the user is a member of, ordered by start time.
+func (p *Plugin) listUserOccurrences(userId string, from, to time.Time) ([]NoticeOccurrence, error) {
+	isMember := map[string]bool{}
+	return p.listOccurrences(from, to, func(notice *Notice) bool {
+		member, ok := isMember[notice.ChannelId]
+		if !ok {
+			_, appErr := p.API.GetChannelMember(notice.ChannelId, userId)
+			member = appErr == nil
+			isMember[notice.ChannelId] = member
+		}
+		return member
+	})
+}
+
+// listChannelOccurrences returns the occurrences between from and to of the notices in the
+// channel, ordered by start time.
+func (p *Plugin) listChannelOccurrences(channelId string, from, to time.Time) ([]NoticeOccurrence, error) {
+	return p.listOccurrences(from, to, func(notice *Notice) bool {
+		return notice.ChannelId == channelId
+	})
+}
+
+// listOccurrences returns the occurrences between from and to of the notices to keep, ordered
+// by start time.
+func (p *Plugin) listOccurrences(from, to time.Time, keep func(notice *Notice) bool) ([]NoticeOccurrence, error) {
+	notices, err := p.store.ListNoticesByDateRange(from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	var occurrences []NoticeOccurrence
+	for _, notice := range notices {
+		if !keep(notice) {
+			continue
+		}
+		noticeOccurrences, err := notice.occurrencesBetween(from, to)
+		if err != nil {
+			return nil, err
+		}
+		for _, occurrence := range noticeOccurrences {
+			occurrences = append(occurrences, NoticeOccurrence{Occurrence: occurrence, Notice: notice})
+		}
+	}
+
+	sort.SliceStable(occurrences, func(i, j int) bool { return occurrences[i].Start.Before(occurrences[j].Start) })
+	return occurrences, nil
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func formatTimes(times []time.Time) []string {
+	var formatted []string
+	for _, t := range times {
+		formatted = append(formatted, t.Format(noticeTimeLayout))
+	}
+	return formatted
+}
+
+func TestParseRecurrenceRule(t *testing.T) {
+	assert := assert.New(t)
+
+	rule, err := ParseRecurrenceRule("RRULE:FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,WE;UNTIL=20211231T235959Z", "2021-12-06, 20211208")
+	assert.NoError(err)
+	assert.Equal(&RecurrenceRule{
+		Frequency:  FrequencyWeekly,
+		Interval:   2,
+		ByWeekday:  []string{"MO", "WE"},
+		Until:      "2021-12-31",
+		Exceptions: []string{"2021-12-06", "2021-12-08"},
+	}, rule)
+	assert.Equal("FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,WE;UNTIL=20211231", rule.String())
+
+	rule, err = ParseRecurrenceRule("daily", "")
+	assert.NoError(err)
+	assert.Equal(FrequencyDaily, rule.Frequency)
+
+	rule, err = ParseRecurrenceRule("", "")
+	assert.NoError(err)
+	assert.Nil(rule)
+
+	for _, invalid := range []string{"yearly", "FREQ=DAILY;BYDAY=MO", "FREQ=WEEKLY;BYDAY=XX", "FREQ=DAILY;COUNT=2;UNTIL=20211231", "FREQ=DAILY;BYHOUR=9"} {
+		_, err = ParseRecurrenceRule(invalid, "")
+		assert.Error(err, invalid)
+	}
+	_, err = ParseRecurrenceRule("", "2021-12-06")
+	assert.Error(err)
+}
+
+func TestRecurrenceOccurrences(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	newYork, err := time.LoadLocation("America/New_York")
+	require.NoError(err)
+
+	for name, tc := range map[string]struct {
+		rule     string
+		skip     string
+		first    time.Time
+		to       time.Time
+		expected []string
+	}{
+		"weekly by weekday": {
+			rule:     "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,FR",
+			first:    time.Date(2021, 11, 3, 9, 0, 0, 0, time.UTC),
+			to:       time.Date(2021, 11, 30, 0, 0, 0, 0, time.UTC),
+			expected: []string{"2021-11-05 09:00", "2021-11-15 09:00", "2021-11-19 09:00", "2021-11-29 09:00"},
+		},
+		"monthly skips short months": {
+			rule:     "monthly",
+			first:    time.Date(2021, 1, 31, 9, 0, 0, 0, time.UTC),
+			to:       time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC),
+			expected: []string{"2021-01-31 09:00", "2021-03-31 09:00", "2021-05-31 09:00"},
+		},
+		"count includes skipped days": {
+			rule:     "FREQ=DAILY;COUNT=3",
+			skip:     "2021-11-02",
+			first:    time.Date(2021, 11, 1, 9, 0, 0, 0, time.UTC),
+			to:       time.Date(2021, 12, 1, 0, 0, 0, 0, time.UTC),
+			expected: []string{"2021-11-01 09:00", "2021-11-03 09:00"},
+		},
+		"until is inclusive": {
+			rule:     "FREQ=DAILY;UNTIL=20211103",
+			first:    time.Date(2021, 11, 1, 9, 0, 0, 0, time.UTC),
+			to:       time.Date(2021, 12, 1, 0, 0, 0, 0, time.UTC),
+			expected: []string{"2021-11-01 09:00", "2021-11-02 09:00", "2021-11-03 09:00"},
+		},
+		"daylight saving time": {
+			rule:     "daily",
+			first:    time.Date(2021, 3, 13, 9, 0, 0, 0, newYork),
+			to:       time.Date(2021, 3, 15, 23, 0, 0, 0, newYork),
+			expected: []string{"2021-03-13 09:00", "2021-03-14 09:00", "2021-03-15 09:00"},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			rule, err := ParseRecurrenceRule(tc.rule, tc.skip)
+			require.NoError(err)
+			occurrences, err := rule.Occurrences(tc.first, tc.first, tc.to)
+			require.NoError(err)
+			assert.Equal(tc.expected, formatTimes(occurrences))
+		})
+	}
+}
+
+func TestRecurrenceOccurrencesWindow(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	for name, tc := range map[string]struct {
+		rule     string
+		skip     string
+		first    time.Time
+		from     time.Time
+		to       time.Time
+		expected []string
+	}{
+		"daily decades later": {
+			rule:     "FREQ=DAILY;INTERVAL=3",
+			first:    time.Date(2000, 1, 1, 9, 0, 0, 0, time.UTC),
+			from:     time.Date(2090, 1, 1, 0, 0, 0, 0, time.UTC),
+			to:       time.Date(2090, 1, 7, 0, 0, 0, 0, time.UTC),
+			expected: []string{"2090-01-02 09:00", "2090-01-05 09:00"},
+		},
+		"weekly by weekday": {
+			rule:     "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,FR",
+			first:    time.Date(2021, 11, 3, 9, 0, 0, 0, time.UTC),
+			from:     time.Date(2021, 11, 19, 9, 0, 0, 0, time.UTC),
+			to:       time.Date(2021, 11, 30, 0, 0, 0, 0, time.UTC),
+			expected: []string{"2021-11-19 09:00", "2021-11-29 09:00"},
+		},
+		"count across skipped periods": {
+			rule:     "FREQ=WEEKLY;BYDAY=MO,WE;COUNT=5",
+			skip:     "2021-11-08",
+			first:    time.Date(2021, 11, 3, 9, 0, 0, 0, time.UTC),
+			from:     time.Date(2021, 11, 15, 0, 0, 0, 0, time.UTC),
+			to:       time.Date(2021, 12, 31, 0, 0, 0, 0, time.UTC),
+			expected: []string{"2021-11-15 09:00", "2021-11-17 09:00"},
+		},
+		"count skips short months": {
+			rule:     "FREQ=MONTHLY;COUNT=4",
+			first:    time.Date(2021, 1, 31, 9, 0, 0, 0, time.UTC),
+			from:     time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC),
+			to:       time.Date(2021, 12, 31, 0, 0, 0, 0, time.UTC),
+			expected: []string{"2021-07-31 09:00"},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			rule, err := ParseRecurrenceRule(tc.rule, tc.skip)
+			require.NoError(err)
+			occurrences, err := rule.Occurrences(tc.first, tc.from, tc.to)
+			require.NoError(err)
+			assert.Equal(tc.expected, formatTimes(occurrences))
+		})
+	}
+
+	// Windows too large to expand are an error rather than empty.
+	rule, err := ParseRecurrenceRule("daily", "")
+	require.NoError(err)
+	first := time.Date(2021, 1, 1, 9, 0, 0, 0, time.UTC)
+	_, err = rule.Occurrences(first, first, first.AddDate(100, 0, 0))
+	assert.Error(err)
+}
+
+func TestNoticeOccurrencesBetween(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	recurrence, err := ParseRecurrenceRule("weekly", "")
+	require.NoError(err)
+	notice := &Notice{StartTime: "2021-11-01 09:00", EndTime: "2021-11-01 10:00", Recurrence: recurrence}
+
+	from := time.Date(2021, 11, 8, 9, 30, 0, 0, time.Local)
+	occurrences, err := notice.occurrencesBetween(from, from.AddDate(0, 0, 7))
+	require.NoError(err)
+	require.Len(occurrences, 2)
+	assert.Equal("2021-11-08 09:00", occurrences[0].Start.Format(noticeTimeLayout))
+	assert.Equal("2021-11-15 10:00", occurrences[1].End.Format(noticeTimeLayout))
+
+	s, _ := newTestStore()
+	notice.ChannelId = "c"
+	require.NoError(s.CreateNotice(notice))
+	list, err := s.ListNoticesByDateRange(from, from.AddDate(0, 0, 1))
+	require.NoError(err)
+	assert.Len(list, 1)
+	list, err = s.ListNoticesByDateRange(from.AddDate(0, 0, 1), from.AddDate(0, 0, 2))
+	require.NoError(err)
+	assert.Empty(list)
+}
@@ -0,0 +1,387 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost-plugin-api/cluster"
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/pkg/errors"
+)
+
+const (
+	reminderJobKey   = "reminder_job"
+	reminderInterval = time.Minute
+
+	// reminderMaxDelay bounds how late a reminder is still sent, e.g. after the plugin was down.
+	reminderMaxDelay = 6 * time.Hour
+
+	// noRemindersSpec disables the reminders of a notice.
+	noRemindersSpec = "none"
+
+	defaultReminderLeadTimes = "1d,1h,0m"
+
+	// personalReminderLeadTime is how long before an occurrence a user who clicked "Remind me"
+	// gets a direct message.
+	personalReminderLeadTime = 15 * time.Minute
+
+	// recurringReminderOccurrences is the number of upcoming occurrences of a recurring notice
+	// whose reminders are queued. The queue is topped up as the reminders are sent.
+	recurringReminderOccurrences = 2
+
+	// recurringReminderHorizon bounds how far ahead the next occurrences are looked for.
+	recurringReminderHorizon = 400 * 24 * time.Hour
+)
+
+// Reminder is a reply posted in the thread of a notice, LeadTime before the notice starts.
+type Reminder struct {
+	NoticeId string `json:"notice_id"`
+	LeadTime string `json:"lead_time"`
+	At       int64  `json:"at"`
+	// StartAt is the start of the occurrence the reminder is for, set for recurring notices and
+	// personal reminders.
+	StartAt int64 `json:"start_at,omitempty"`
+	// UserId is set for a personal reminder, which is sent to the user as a direct message.
+	UserId string `json:"user_id,omitempty"`
+}
+
+// startReminders schedules the cluster-wide job sending due reminders.
+func (p *Plugin) startReminders() error {
+	job, err := cluster.Schedule(p.API, reminderJobKey, cluster.MakeWaitForInterval(reminderInterval), p.sendDueReminders)
+	if err != nil {
+		return errors.Wrap(err, "failed to schedule reminder job")
+	}
+	p.reminderJob = job
+	return nil
+}
+
+// stopReminders stops the reminder job on this node.
+func (p *Plugin) stopReminders() error {
+	if p.reminderJob == nil {
+		return nil
+	}
+	return p.reminderJob.Close()
+}
+
+// scheduleReminders replaces the queued reminders of the notice with the ones still ahead. For
+// a recurring notice, only the reminders of the next few occurrences are queued.
+func (p *Plugin) scheduleReminders(notice *Notice) error {
+	var reminders []Reminder
+	if notice.DeleteAt == 0 {
+		start, _, err := notice.period()
+		if err != nil {
+			return err
+		}
+
+		leadTimes, err := parseLeadTimes(p.reminderSpec(notice))
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		starts := []time.Time{start}
+		if notice.Recurrence != nil {
+			var maxLeadTime time.Duration
+			for _, leadTime := range leadTimes {
+				if leadTime > maxLeadTime {
+					maxLeadTime = leadTime
+				}
+			}
+			occurrences, err := notice.occurrencesBetween(now, now.Add(maxLeadTime+recurringReminderHorizon))
+			if err != nil {
+				return err
+			}
+			starts = nil
+			for _, occurrence := range occurrences {
+				starts = append(starts, occurrence.Start)
+			}
+		}
+
+		scheduled := 0
+		for _, start := range starts {
+			if scheduled == recurringReminderOccurrences {
+				break
+			}
+			found := false
+			for _, leadTime := range leadTimes {
+				at := start.Add(-leadTime)
+				if at.Before(now) {
+					continue
+				}
+				reminder := Reminder{
+					NoticeId: notice.Id,
+					LeadTime: formatLeadTimeSpec(leadTime),
+					At:       model.GetMillisForTime(at),
+				}
+				if notice.Recurrence != nil {
+					reminder.StartAt = model.GetMillisForTime(start)
+				}
+				reminders = append(reminders, reminder)
+				found = true
+			}
+			if found {
+				scheduled++
+			}
+		}
+	}
+
+	return p.store.SetNoticeReminders(notice.Id, reminders)
+}
+
+// reminderSpec returns the lead times of the notice reminders, falling back to the configured
+// default.
+func (p *Plugin) reminderSpec(notice *Notice) string {
+	if notice.Reminders != "" {
+		return notice.Reminders
+	}
+	if spec := p.getConfiguration().ReminderLeadTimes; spec != "" {
+		return spec
+	}
+	return defaultReminderLeadTimes
+}
+
+// sendDueReminders posts every due reminder. It runs on one cluster node at a time.
+func (p *Plugin) sendDueReminders() {
+	now := model.GetMillis()
+	due, err := p.store.ListDueReminders(now)
+	if err != nil {
+		p.API.LogError("Failed to list due reminders", "err", err.Error())
+		return
+	}
+
+	recurring := map[string]bool{}
+	for _, reminder := range due {
+		if reminder.StartAt != 0 && reminder.UserId == "" {
+			recurring[reminder.NoticeId] = true
+		}
+
+		if now-reminder.At <= reminderMaxDelay.Milliseconds() {
+			if err := p.sendReminder(reminder); err != nil {
+				p.API.LogError("Failed to send reminder", "notice_id", reminder.NoticeId, "lead_time", reminder.LeadTime, "err", err.Error())
+			}
+		} else {
+			p.API.LogWarn("Dropped overdue reminder", "notice_id", reminder.NoticeId, "lead_time", reminder.LeadTime)
+		}
+
+		if err := p.store.RemoveReminder(reminder); err != nil {
+			p.API.LogError("Failed to remove reminder", "notice_id", reminder.NoticeId, "err", err.Error())
+		}
+	}
+
+	// Queue the reminders of the following occurrences of the recurring notices.
+	for noticeId := range recurring {
+		notice, err := p.store.GetNotice(noticeId)
+		if err == ErrNoticeNotFound {
+			continue
+		}
+		if err == nil {
+			err = p.scheduleReminders(notice)
+		}
+		if err != nil {
+			p.API.LogError("Failed to schedule recurring reminders", "notice_id", noticeId, "err", err.Error())
+		}
+	}
+}
+
+// sendReminder replies to the notice post, or sends it to the attendees of an event who answered
+// "going" or "maybe" to the occurrence. Reminders of deleted or cancelled notices are skipped.
+func (p *Plugin) sendReminder(reminder Reminder) error {
+	notice, err := p.store.GetNotice(reminder.NoticeId)
+	if err == ErrNoticeNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if notice.DeleteAt != 0 {
+		return nil
+	}
+
+	leadTime, err := parseLeadTime(reminder.LeadTime)
+	if err != nil {
+		return err
+	}
+	if reminder.UserId != "" {
+		return p.sendPersonalReminder(notice, reminder, leadTime)
+	}
+	if notice.isEvent() {
+		start, _, err := notice.period()
+		if err != nil {
+			return err
+		}
+		if reminder.StartAt != 0 {
+			start = model.GetTimeForMillis(reminder.StartAt)
+		}
+		rsvps, err := p.store.GetNoticeRSVPs(notice.Id, notice.rsvpOccurrenceKey(start))
+		if err != nil {
+			return err
+		}
+		return p.sendAttendeeReminders(notice, reminder, leadTime, rsvps)
+	}
+
+	// The reminder is read by the whole channel, so the time is shown in the author's timezone.
+	post := &model.Post{
+		UserId:    p.botUserID,
+		ChannelId: notice.ChannelId,
+		RootId:    notice.PostId,
+		Message:   reminderMessage(notice, reminder, leadTime, notice.location()),
+	}
+	if _, appErr := p.API.CreatePost(post); appErr != nil {
+		return errors.Wrap(appErr, "failed to create reminder post")
+	}
+	return nil
+}
+
+// remindUser queues a personal reminder of an occurrence of the notice, and returns the message
+// to show to the user.
+func (p *Plugin) remindUser(userId string, notice *Notice, start time.Time) (string, error) {
+	ok, err := notice.hasOccurrenceAt(start)
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return "This occurrence of the notice was moved or cancelled.", nil
+	}
+	now := time.Now()
+	if !start.After(now) {
+		return "This notice has already started.", nil
+	}
+
+	leadTime := personalReminderLeadTime
+	if start.Add(-leadTime).Before(now) {
+		leadTime = start.Sub(now).Truncate(time.Minute)
+	}
+	added, err := p.store.AddReminder(Reminder{
+		NoticeId: notice.Id,
+		LeadTime: formatLeadTimeSpec(leadTime),
+		At:       model.GetMillisForTime(start.Add(-leadTime)),
+		StartAt:  model.GetMillisForTime(start),
+		UserId:   userId,
+	})
+	if err != nil {
+		return "", err
+	}
+	if !added {
+		return "You will already be reminded of this notice.", nil
+	}
+	if leadTime == 0 {
+		return ":alarm_clock: I will remind you when it starts.", nil
+	}
+	return fmt.Sprintf(":alarm_clock: I will remind you %s before it starts.", formatLeadTime(leadTime)), nil
+}
+
+// sendPersonalReminder sends a direct message to the user of the reminder, if the occurrence
+// still takes place and the user can still read the notice.
+func (p *Plugin) sendPersonalReminder(notice *Notice, reminder Reminder, leadTime time.Duration) error {
+	ok, err := notice.hasOccurrenceAt(model.GetTimeForMillis(reminder.StartAt))
+	if err != nil || !ok {
+		return err
+	}
+	if _, appErr := p.API.GetChannelMember(notice.ChannelId, reminder.UserId); appErr != nil {
+		return nil
+	}
+
+	return p.sendDirectMessage(reminder.UserId, p.directReminderMessage(notice, reminder, leadTime, reminder.UserId))
+}
+
+// directReminderMessage is the reminder sent to the user as a direct message, in the timezone of
+// the user.
+func (p *Plugin) directReminderMessage(notice *Notice, reminder Reminder, leadTime time.Duration, userId string) string {
+	message := reminderMessage(notice, reminder, leadTime, p.userLocation(userId))
+	message += "\n> " + previewMessage(notice.Message)
+	if notice.PostId != "" {
+		message += fmt.Sprintf("\n\n[Open the notice](%s/_redirect/pl/%s)", p.siteURL(), notice.PostId)
+	}
+	return message
+}
+
+func reminderMessage(notice *Notice, reminder Reminder, leadTime time.Duration, loc *time.Location) string {
+	what := "Starts"
+	if notice.StartTime == notice.EndTime {
+		what = "Due"
+	}
+
+	start, _ := notice.formatPeriod(loc)
+	if reminder.StartAt != 0 {
+		start = formatNoticeTime(model.GetTimeForMillis(reminder.StartAt), loc)
+	}
+
+	if leadTime == 0 {
+		return fmt.Sprintf(":alarm_clock: **%s now** (%s)", what, start)
+	}
+	return fmt.Sprintf(":alarm_clock: **Reminder**: %s in %s (%s)", strings.ToLower(what), formatLeadTime(leadTime), start)
+}
+
+// parseLeadTimes parses a comma separated list of lead times, such as "1d,1h,0m". The
+// noRemindersSpec disables reminders.
+func parseLeadTimes(spec string) ([]time.Duration, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" || spec == noRemindersSpec {
+		return nil, nil
+	}
+
+	var leadTimes []time.Duration
+	for _, value := range strings.Split(spec, ",") {
+		leadTime, err := parseLeadTime(strings.TrimSpace(value))
+		if err != nil {
+			return nil, err
+		}
+		leadTimes = append(leadTimes, leadTime)
+	}
+	return leadTimes, nil
+}
+
+// parseLeadTime parses a duration like "2d", "1h", "30m" or "1h30m".
+func parseLeadTime(value string) (time.Duration, error) {
+	if value == "0" {
+		return 0, nil
+	}
+	if strings.HasSuffix(value, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(value, "d"))
+		if err != nil || days < 0 {
+			return 0, errors.Errorf("invalid lead time %q", value)
+		}
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+
+	leadTime, err := time.ParseDuration(value)
+	if err != nil || leadTime < 0 {
+		return 0, errors.Errorf("invalid lead time %q", value)
+	}
+	return leadTime, nil
+}
+
+// formatLeadTimeSpec formats a lead time so that parseLeadTime reads it back.
+func formatLeadTimeSpec(leadTime time.Duration) string {
+	switch {
+	case leadTime == 0:
+		return "0m"
+	case leadTime%(24*time.Hour) == 0:
+		return strconv.Itoa(int(leadTime/(24*time.Hour))) + "d"
+	case leadTime%time.Hour == 0:
+		return strconv.Itoa(int(leadTime/time.Hour)) + "h"
+	default:
+		return strconv.Itoa(int(leadTime/time.Minute)) + "m"
+	}
+}
+
+// formatLeadTime formats a lead time for humans, e.g. "1 day" or "30 minutes".
+func formatLeadTime(leadTime time.Duration) string {
+	plural := func(n int, unit string) string {
+		if n == 1 {
+			return "1 " + unit
+		}
+		return strconv.Itoa(n) + " " + unit + "s"
+	}
+
+	switch {
+	case leadTime%(24*time.Hour) == 0:
+		return plural(int(leadTime/(24*time.Hour)), "day")
+	case leadTime%time.Hour == 0:
+		return plural(int(leadTime/time.Hour), "hour")
+	default:
+		return plural(int(leadTime/time.Minute), "minute")
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/mattermost/mattermost-server/v5/plugin/plugintest/mock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLeadTimes(t *testing.T) {
+	assert := assert.New(t)
+
+	leadTimes, err := parseLeadTimes("1d, 1h,30m,0m")
+	assert.NoError(err)
+	assert.Equal([]time.Duration{24 * time.Hour, time.Hour, 30 * time.Minute, 0}, leadTimes)
+
+	leadTimes, err = parseLeadTimes(noRemindersSpec)
+	assert.NoError(err)
+	assert.Empty(leadTimes)
+
+	_, err = parseLeadTimes("1w")
+	assert.Error(err)
+	_, err = parseLeadTimes("-1h")
+	assert.Error(err)
+
+	for _, leadTime := range []time.Duration{0, 48 * time.Hour, 3 * time.Hour, 90 * time.Minute} {
+		parsed, err := parseLeadTime(formatLeadTimeSpec(leadTime))
+		assert.NoError(err)
+		assert.Equal(leadTime, parsed)
+	}
+	assert.Equal("2 days", formatLeadTime(48*time.Hour))
+	assert.Equal("1 hour", formatLeadTime(time.Hour))
+}
+
+func TestReminders(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	api := newKVAPI()
+	p := &Plugin{botUserID: "bot"}
+	p.SetAPI(api)
+	p.store = NewStore(p)
+	p.setConfiguration(&configuration{ReminderLeadTimes: "1d,1h"})
+
+	start := time.Now().Add(2 * time.Hour).Truncate(time.Minute)
+	notice := &Notice{
+		ChannelId: "channel1",
+		PostId:    "post1",
+		StartTime: start.Format(noticeTimeLayout),
+		EndTime:   start.Format(noticeTimeLayout),
+	}
+	require.NoError(p.store.CreateNotice(notice))
+	require.NoError(p.scheduleReminders(notice))
+
+	// The reminder a day before is already past, only the one an hour before is queued.
+	due, err := p.store.ListDueReminders(model.GetMillisForTime(start))
+	require.NoError(err)
+	require.Len(due, 1)
+	assert.Equal("1h", due[0].LeadTime)
+
+	due, err = p.store.ListDueReminders(model.GetMillis())
+	require.NoError(err)
+	assert.Empty(due)
+
+	api.On("CreatePost", mock.MatchedBy(func(post *model.Post) bool {
+		return post.RootId == "post1" && post.ChannelId == "channel1"
+	})).Return(&model.Post{}, nil).Once()
+	require.NoError(p.store.SetNoticeReminders(notice.Id, []Reminder{{NoticeId: notice.Id, LeadTime: "1h", At: model.GetMillis() - 1000}}))
+	p.sendDueReminders()
+	api.AssertExpectations(t)
+
+	due, err = p.store.ListDueReminders(model.GetMillisForTime(start))
+	require.NoError(err)
+	assert.Empty(due)
+}
+
+func TestPersonalReminders(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	api := newKVAPI()
+	api.On("GetUser", "user1").Return(&model.User{Id: "user1"}, nil)
+	api.On("GetChannelMember", "channel1", "user1").Return(&model.ChannelMember{}, nil)
+	api.On("GetDirectChannel", "user1", "bot").Return(&model.Channel{Id: "dm"}, nil)
+	api.On("GetConfig").Return(&model.Config{})
+	p := &Plugin{botUserID: "bot"}
+	p.SetAPI(api)
+	p.store = NewStore(p)
+
+	start := time.Now().Add(10 * time.Minute).Truncate(time.Minute)
+	notice := &Notice{
+		ChannelId: "channel1",
+		PostId:    "post1",
+		Message:   "Fire drill",
+		StartTime: start.UTC().Format(time.RFC3339),
+		EndTime:   start.UTC().Format(time.RFC3339),
+	}
+	require.NoError(p.store.CreateNotice(notice))
+
+	message, err := p.remindUser("user1", notice, start.Add(time.Hour))
+	require.NoError(err)
+	assert.Equal("This occurrence of the notice was moved or cancelled.", message)
+
+	// The notice starts in less than the lead time of personal reminders.
+	message, err = p.remindUser("user1", notice, start)
+	require.NoError(err)
+	assert.Contains(message, "I will remind you")
+	message, err = p.remindUser("user1", notice, start)
+	require.NoError(err)
+	assert.Equal("You will already be reminded of this notice.", message)
+
+	due, err := p.store.ListDueReminders(model.GetMillisForTime(start))
+	require.NoError(err)
+	require.Len(due, 1)
+	assert.Equal("user1", due[0].UserId)
+
+	api.On("CreatePost", mock.MatchedBy(func(post *model.Post) bool {
+		return post.ChannelId == "dm" && post.RootId == ""
+	})).Return(&model.Post{}, nil).Once()
+	require.NoError(p.sendReminder(due[0]))
+	api.AssertExpectations(t)
+}
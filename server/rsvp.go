@@ -0,0 +1,414 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/mattermost/mattermost-server/v5/plugin"
+	"github.com/pkg/errors"
+)
+
+const (
+	rsvpGoing    = "going"
+	rsvpMaybe    = "maybe"
+	rsvpNotGoing = "not_going"
+
+	attendeesUsage = "Usage: `/mbotc attendees [export] <notice-or-post-id>`"
+
+	// rsvpLookahead bounds the search of the next occurrence of a recurring event.
+	rsvpLookahead = 366 * 24 * time.Hour
+)
+
+// RSVP is the answer of a user to an event-style notice.
+type RSVP struct {
+	Response string `json:"response"`
+	UpdateAt int64  `json:"update_at"`
+}
+
+// rsvpResponses are the possible answers, in the order they are shown.
+var rsvpResponses = []struct {
+	value, actionId, name, reply string
+}{
+	{rsvpGoing, "going", "Going", ":white_check_mark: You're going. You will get the reminders of the notice."},
+	{rsvpMaybe, "maybe", "Maybe", ":grey_question: You might go. You will get the reminders of the notice."},
+	{rsvpNotGoing, "notgoing", "Not going", ":x: You're not going. You won't get the reminders of the notice."},
+}
+
+func rsvpResponseName(response string) string {
+	for _, r := range rsvpResponses {
+		if r.value == response {
+			return r.name
+		}
+	}
+	return response
+}
+
+// isEvent reports whether the notice has a start and an end time, such as a meeting, rather than
+// a deadline. Users can RSVP to events.
+func (n *Notice) isEvent() bool {
+	return n.StartTime != n.EndTime
+}
+
+// nextRSVPOccurrence returns the occurrence of the event users answer to: the next one that
+// hasn't ended for a recurring notice, or its only one. It returns false if there is none.
+func (n *Notice) nextRSVPOccurrence(now time.Time) (Occurrence, bool, error) {
+	if n.Recurrence == nil {
+		start, end, err := n.period()
+		return Occurrence{Start: start, End: end}, err == nil, nil
+	}
+	occurrences, err := n.occurrencesBetween(now, now.Add(rsvpLookahead))
+	if err != nil || len(occurrences) == 0 {
+		return Occurrence{}, false, err
+	}
+	return occurrences[0], true, nil
+}
+
+// rsvpOccurrenceKey returns the occurrence of the notice starting at start, as the RSVPs to it
+// are stored: the date it starts on in the timezone of the notice, or none for one-off notices.
+func (n *Notice) rsvpOccurrenceKey(start time.Time) string {
+	if n.Recurrence == nil {
+		return ""
+	}
+	return start.In(n.location()).Format(dateIndexLayout)
+}
+
+// formatRSVPOccurrence renders the day of an occurrence of a recurring event, e.g.
+// " on Fri 2021-11-05". One-off events have a single occurrence, which isn't named.
+func (n *Notice) formatRSVPOccurrence(occurrence Occurrence, loc *time.Location) string {
+	if n.Recurrence == nil {
+		return ""
+	}
+	return " on " + occurrence.Start.In(loc).Format("Mon "+listingDayLayout)
+}
+
+// rsvpActions returns the RSVP buttons of the notice post.
+func rsvpActions(notice Notice) []*model.PostAction {
+	var actions []*model.PostAction
+	for _, r := range rsvpResponses {
+		actions = append(actions, &model.PostAction{
+			Id:   r.actionId,
+			Name: r.name,
+			Type: model.POST_ACTION_TYPE_BUTTON,
+			Integration: &model.PostActionIntegration{
+				URL:     "/plugins/" + manifest.Id + "/actions/rsvp",
+				Context: map[string]interface{}{"notice_id": notice.Id, "response": r.value},
+			},
+		})
+	}
+	return actions
+}
+
+// respondToNoticeAs records the answer of the user to the next occurrence of the event, and
+// returns the message to show to the user. The counts on the notice post are updated.
+func (p *Plugin) respondToNoticeAs(userId string, notice *Notice, response string) (string, error) {
+	occurrence, ok, err := notice.nextRSVPOccurrence(time.Now())
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return "This event has no upcoming occurrence.", nil
+	}
+	when := notice.formatRSVPOccurrence(occurrence, p.userLocation(userId))
+
+	changed, err := p.store.SetNoticeRSVP(notice.Id, notice.rsvpOccurrenceKey(occurrence.Start), userId, RSVP{Response: response, UpdateAt: model.GetMillis()})
+	if err != nil {
+		return "", err
+	}
+	if !changed {
+		return fmt.Sprintf("You already answered \"%s\"%s.", rsvpResponseName(response), when), nil
+	}
+
+	if notice.PostId != "" {
+		if err := p.updateNoticePost(notice); err != nil {
+			p.API.LogWarn("Failed to update RSVPs of notice post", "notice_id", notice.Id, "err", err.Error())
+		}
+	}
+	for _, r := range rsvpResponses {
+		if r.value == response {
+			if when != "" {
+				return fmt.Sprintf("%s This answer is for the event%s.", r.reply, when), nil
+			}
+			return r.reply, nil
+		}
+	}
+	return "", errors.Errorf("unknown RSVP response %s", response)
+}
+
+// rsvpField shows on the notice post how many users answered each response for the next
+// occurrence of the event. It is only shown once someone did.
+func (p *Plugin) rsvpField(notice Notice) (*model.SlackAttachmentField, error) {
+	if !notice.isEvent() {
+		return nil, nil
+	}
+	occurrence, ok, err := notice.nextRSVPOccurrence(time.Now())
+	if err != nil || !ok {
+		return nil, err
+	}
+	rsvps, err := p.store.GetNoticeRSVPs(notice.Id, notice.rsvpOccurrenceKey(occurrence.Start))
+	if err != nil || len(rsvps) == 0 {
+		return nil, err
+	}
+
+	counts := map[string]int{}
+	for _, rsvp := range rsvps {
+		counts[rsvp.Response]++
+	}
+	var values []string
+	for _, r := range rsvpResponses {
+		values = append(values, fmt.Sprintf("%s: %d", r.name, counts[r.value]))
+	}
+	return &model.SlackAttachmentField{
+		Title: ":busts_in_silhouette: RSVP" + notice.formatRSVPOccurrence(occurrence, notice.location()),
+		Value: strings.Join(values, " · "),
+		Short: false,
+	}, nil
+}
+
+// handleRSVPAction handles the RSVP buttons of a notice post.
+func (p *Plugin) handleRSVPAction(w http.ResponseWriter, r *http.Request) {
+	userId := r.Header.Get("Mattermost-User-ID")
+	log := p.loggerFromContext(r.Context())
+
+	request := model.PostActionIntegrationRequestFromJson(r.Body)
+	if request == nil {
+		http.Error(w, "Invalid action request", http.StatusBadRequest)
+		return
+	}
+	noticeId, _ := request.Context["notice_id"].(string)
+	response, _ := request.Context["response"].(string)
+	log = log.With("notice_id", noticeId, "user_id", userId)
+
+	if response != rsvpGoing && response != rsvpMaybe && response != rsvpNotGoing {
+		http.Error(w, "Invalid RSVP response", http.StatusBadRequest)
+		return
+	}
+	notice := p.getReadableNotice(noticeId, userId)
+	if notice == nil {
+		writeActionResponse(w, "This notice was cancelled or doesn't exist anymore.")
+		return
+	}
+	if !notice.isEvent() {
+		writeActionResponse(w, "This notice is not an event anymore.")
+		return
+	}
+
+	text, err := p.respondToNoticeAs(userId, notice, response)
+	if err != nil {
+		log.Error("Failed to save RSVP", "err", err.Error())
+		text = "Failed to save your answer. Please try again later."
+	}
+	writeActionResponse(w, text)
+}
+
+// attendee is a member of the channel of a notice who answered it.
+type attendee struct {
+	user *model.User
+	rsvp RSVP
+}
+
+// listAttendees returns the members of the channel of the notice who answered the occurrence,
+// ordered by response and username. Answers of users who left the channel are not counted.
+func (p *Plugin) listAttendees(notice *Notice, occurrence Occurrence) (attendees []attendee, unanswered int, err error) {
+	rsvps, err := p.store.GetNoticeRSVPs(notice.Id, notice.rsvpOccurrenceKey(occurrence.Start))
+	if err != nil {
+		return nil, 0, err
+	}
+	audience, err := p.listNoticeAudience(notice.ChannelId)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	order := map[string]int{}
+	for i, r := range rsvpResponses {
+		order[r.value] = i
+	}
+	for _, user := range audience {
+		if rsvp, ok := rsvps[user.Id]; ok {
+			attendees = append(attendees, attendee{user: user, rsvp: rsvp})
+		} else {
+			unanswered++
+		}
+	}
+	sort.SliceStable(attendees, func(i, j int) bool {
+		if attendees[i].rsvp.Response != attendees[j].rsvp.Response {
+			return order[attendees[i].rsvp.Response] < order[attendees[j].rsvp.Response]
+		}
+		return attendees[i].user.Username < attendees[j].user.Username
+	})
+	return attendees, unanswered, nil
+}
+
+// findEventForAuthor returns the event of the command and its next occurrence, or posts the
+// reason why the user can't see its attendees.
+func (p *Plugin) findEventForAuthor(header *model.CommandArgs, id string) (*Notice, Occurrence) {
+	notice, err := p.findNotice(id)
+	if err == ErrNoticeNotFound {
+		p.postCommandResponse(header, fmt.Sprintf("Notice %s was not found.", id))
+		return nil, Occurrence{}
+	}
+	if err != nil {
+		p.API.LogError("Failed to get notice", "user_id", header.UserId, "notice_id", id, "err", err.Error())
+		p.postCommandResponse(header, "Failed to get the notice. Please try again later.")
+		return nil, Occurrence{}
+	}
+	if !p.canManageNotice(header.UserId, notice) {
+		p.postCommandResponse(header, "Only the author or a channel admin can see the attendees of this notice.")
+		return nil, Occurrence{}
+	}
+	if !notice.isEvent() {
+		p.postCommandResponse(header, "This notice is a deadline, not an event. Nobody can RSVP to it.")
+		return nil, Occurrence{}
+	}
+	occurrence, ok, err := notice.nextRSVPOccurrence(time.Now())
+	if err != nil {
+		p.API.LogError("Failed to get next occurrence of event", "notice_id", notice.Id, "err", err.Error())
+		p.postCommandResponse(header, "Failed to get the attendees. Please try again later.")
+		return nil, Occurrence{}
+	}
+	if !ok {
+		p.postCommandResponse(header, "This event has no upcoming occurrence.")
+		return nil, Occurrence{}
+	}
+	return notice, occurrence
+}
+
+func executeAttendees(p *Plugin, c *plugin.Context, header *model.CommandArgs, args ...string) *model.CommandResponse {
+	if len(args) != 1 {
+		p.postCommandResponse(header, attendeesUsage)
+		return &model.CommandResponse{}
+	}
+	notice, occurrence := p.findEventForAuthor(header, args[0])
+	if notice == nil {
+		return &model.CommandResponse{}
+	}
+
+	attendees, unanswered, err := p.listAttendees(notice, occurrence)
+	if err != nil {
+		p.API.LogError("Failed to get attendees", "notice_id", notice.Id, "err", err.Error())
+		p.postCommandResponse(header, "Failed to get the attendees. Please try again later.")
+		return &model.CommandResponse{}
+	}
+	when := notice.formatRSVPOccurrence(occurrence, p.userLocation(header.UserId))
+	p.postCommandResponse(header, formatAttendees(notice, when, attendees, unanswered))
+	return &model.CommandResponse{}
+}
+
+func formatAttendees(notice *Notice, when string, attendees []attendee, unanswered int) string {
+	text := fmt.Sprintf("#### Attendees of \"%s\"%s\n", previewMessage(notice.Message), when)
+	for _, r := range rsvpResponses {
+		var names []string
+		for _, a := range attendees {
+			if a.rsvp.Response == r.value {
+				names = append(names, "@"+a.user.Username)
+			}
+		}
+		text += fmt.Sprintf("**%s** (%d): %s\n", r.name, len(names), strings.Join(names, ", "))
+	}
+	text += fmt.Sprintf("%d members haven't answered.\n", unanswered)
+	return text + fmt.Sprintf("Export the list with `/mbotc attendees export %s`.\n", notice.Id)
+}
+
+// executeAttendeesExport sends the attendee list to the user as a CSV file in a direct message.
+func executeAttendeesExport(p *Plugin, c *plugin.Context, header *model.CommandArgs, args ...string) *model.CommandResponse {
+	if len(args) != 1 {
+		p.postCommandResponse(header, attendeesUsage)
+		return &model.CommandResponse{}
+	}
+	notice, occurrence := p.findEventForAuthor(header, args[0])
+	if notice == nil {
+		return &model.CommandResponse{}
+	}
+
+	if err := p.exportAttendees(header.UserId, notice, occurrence); err != nil {
+		p.API.LogError("Failed to export attendees", "notice_id", notice.Id, "err", err.Error())
+		p.postCommandResponse(header, "Failed to export the attendees. Please try again later.")
+		return &model.CommandResponse{}
+	}
+	p.postCommandResponse(header, "I sent you the attendee list as a CSV file in a direct message.")
+	return &model.CommandResponse{}
+}
+
+func (p *Plugin) exportAttendees(userId string, notice *Notice, occurrence Occurrence) error {
+	attendees, _, err := p.listAttendees(notice, occurrence)
+	if err != nil {
+		return err
+	}
+	data, err := attendeesCSV(attendees)
+	if err != nil {
+		return err
+	}
+
+	channel, appErr := p.API.GetDirectChannel(userId, p.botUserID)
+	if appErr != nil {
+		return errors.Wrapf(appErr, "failed to get direct channel of %s", userId)
+	}
+	fileInfo, appErr := p.API.UploadFile(data, channel.Id, fmt.Sprintf("attendees-%s.csv", notice.Id))
+	if appErr != nil {
+		return errors.Wrap(appErr, "failed to upload attendee list")
+	}
+	post := &model.Post{
+		UserId:    p.botUserID,
+		ChannelId: channel.Id,
+		Message:   fmt.Sprintf("Attendees of \"%s\"%s", previewMessage(notice.Message), notice.formatRSVPOccurrence(occurrence, p.userLocation(userId))),
+		FileIds:   []string{fileInfo.Id},
+	}
+	if _, appErr := p.API.CreatePost(post); appErr != nil {
+		return errors.Wrap(appErr, "failed to send attendee list")
+	}
+	return nil
+}
+
+func attendeesCSV(attendees []attendee) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	records := [][]string{{"username", "name", "response", "answered_at"}}
+	for _, a := range attendees {
+		records = append(records, []string{
+			a.user.Username,
+			csvText(a.user.GetFullName()),
+			rsvpResponseName(a.rsvp.Response),
+			model.GetTimeForMillis(a.rsvp.UpdateAt).UTC().Format(time.RFC3339),
+		})
+	}
+	if err := w.WriteAll(records); err != nil {
+		return nil, errors.Wrap(err, "failed to write attendee list")
+	}
+	return buf.Bytes(), nil
+}
+
+// csvText escapes user-entered text for a CSV cell: text starting like a formula is prefixed
+// with a quote, so that spreadsheet apps show it rather than evaluate it.
+func csvText(text string) string {
+	if text != "" && strings.ContainsRune("=+-@\t\r", rune(text[0])) {
+		return "'" + text
+	}
+	return text
+}
+
+// sendAttendeeReminders sends the reminder of an event as a direct message to the members who
+// answered "going" or "maybe" to the occurrence. Nobody is reminded until someone does.
+func (p *Plugin) sendAttendeeReminders(notice *Notice, reminder Reminder, leadTime time.Duration, rsvps map[string]RSVP) error {
+	var userIds []string
+	for userId, rsvp := range rsvps {
+		if rsvp.Response == rsvpGoing || rsvp.Response == rsvpMaybe {
+			userIds = append(userIds, userId)
+		}
+	}
+	sort.Strings(userIds)
+
+	for _, userId := range userIds {
+		if _, appErr := p.API.GetChannelMember(notice.ChannelId, userId); appErr != nil {
+			continue
+		}
+		if err := p.sendDirectMessage(userId, p.directReminderMessage(notice, reminder, leadTime, userId)); err != nil {
+			p.API.LogError("Failed to send reminder to attendee", "notice_id", notice.Id, "user_id", userId, "err", err.Error())
+		}
+	}
+	return nil
+}
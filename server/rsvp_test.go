@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/mattermost/mattermost-server/v5/plugin/plugintest/mock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRSVP(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	api := newKVAPI()
+	api.On("GetUser", mock.Anything).Return(&model.User{Id: "author", Username: "author"}, nil)
+	for _, userId := range []string{"author", "alice", "bob", "carol"} {
+		api.On("GetChannelMember", "channel1", userId).Return(&model.ChannelMember{}, nil)
+	}
+	api.On("HasPermissionToChannel", "bob", "channel1", model.PERMISSION_MANAGE_CHANNEL_ROLES).Return(false)
+	api.On("GetChannel", "channel1").Return(&model.Channel{Id: "channel1", TeamId: "team1", DisplayName: "Town Square"}, nil)
+	api.On("GetTeam", "team1").Return(&model.Team{Id: "team1", DisplayName: "Team"}, nil)
+	api.On("GetUsersInChannel", "channel1", "username", 0, audiencePageSize).Return([]*model.User{
+		{Id: "alice", Username: "alice", FirstName: "Alice", LastName: "Kim"},
+		{Id: "author", Username: "author"},
+		{Id: "bob", Username: "bob"},
+		{Id: "carol", Username: "carol"},
+	}, nil)
+	api.On("GetConfig").Return(&model.Config{})
+	api.On("GetPost", "post1").Return(&model.Post{Id: "post1"}, nil)
+	var updated *model.Post
+	api.On("UpdatePost", mock.Anything).Return(&model.Post{}, nil).Run(func(args mock.Arguments) {
+		updated = args.Get(0).(*model.Post)
+	})
+	var replies []string
+	api.On("SendEphemeralPost", mock.Anything, mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+		replies = append(replies, args.Get(1).(*model.Post).Message)
+	})
+	for _, userId := range []string{"author", "alice", "bob", "carol"} {
+		api.On("GetDirectChannel", userId, "bot").Return(&model.Channel{Id: "dm_" + userId}, nil)
+	}
+	var uploaded []byte
+	api.On("UploadFile", mock.Anything, "dm_author", mock.Anything).Return(&model.FileInfo{Id: "file1"}, nil).Run(func(args mock.Arguments) {
+		uploaded = args.Get(0).([]byte)
+	})
+	var posts []*model.Post
+	api.On("CreatePost", mock.Anything).Return(&model.Post{}, nil).Run(func(args mock.Arguments) {
+		posts = append(posts, args.Get(0).(*model.Post))
+	})
+
+	p := &Plugin{botUserID: "bot"}
+	p.SetAPI(api)
+	p.store = NewStore(p)
+	p.router = p.initRouter()
+
+	notice := &Notice{UserId: "author", TeamId: "team1", ChannelId: "channel1", PostId: "post1", Message: "Study session",
+		StartTime: "2021-11-05T09:00:00Z", EndTime: "2021-11-05T11:00:00Z"}
+	require.NoError(p.store.CreateNotice(notice))
+
+	actions := map[string]bool{}
+	for _, action := range noticeActions(*notice) {
+		actions[action.Id] = true
+	}
+	assert.True(actions["going"] && actions["maybe"] && actions["notgoing"])
+	assert.Equal("acknowledge", noticeActions(Notice{StartTime: notice.StartTime, EndTime: notice.StartTime})[0].Id)
+
+	respond := func(noticeId, userId, answer string) string {
+		request := &model.PostActionIntegrationRequest{PostId: "post1", ChannelId: "channel1",
+			Context: map[string]interface{}{"notice_id": noticeId, "response": answer}}
+		r := httptest.NewRequest(http.MethodPost, "/actions/rsvp", bytes.NewReader(request.ToJson()))
+		r.Header.Set("Mattermost-User-ID", userId)
+		w := httptest.NewRecorder()
+		p.ServeHTTP(nil, w, r)
+		result := model.PostActionIntegrationResponseFromJson(w.Body)
+		require.NotNil(result)
+		return result.EphemeralText
+	}
+
+	assert.Contains(respond(notice.Id, "alice", rsvpGoing), "You're going.")
+	require.NotNil(updated)
+	fields := updated.Attachments()[0].Fields
+	assert.Equal(":busts_in_silhouette: RSVP", fields[len(fields)-1].Title)
+	assert.Equal("Going: 1 · Maybe: 0 · Not going: 0", fields[len(fields)-1].Value)
+
+	updated = nil
+	assert.Equal("You already answered \"Going\".", respond(notice.Id, "alice", rsvpGoing))
+	assert.Nil(updated)
+	assert.Contains(respond(notice.Id, "bob", rsvpMaybe), "You might go.")
+	assert.Contains(respond(notice.Id, "carol", rsvpGoing), "You're going.")
+	assert.Contains(respond(notice.Id, "carol", rsvpNotGoing), "You're not going.")
+	fields = updated.Attachments()[0].Fields
+	assert.Equal("Going: 1 · Maybe: 1 · Not going: 1", fields[len(fields)-1].Value)
+
+	execute := func(userId, command string) string {
+		replies = nil
+		_, appErr := p.ExecuteCommand(nil, &model.CommandArgs{UserId: userId, ChannelId: "channel1", Command: command})
+		require.Nil(appErr)
+		require.Len(replies, 1)
+		return replies[0]
+	}
+	assert.Equal("#### Attendees of \"Study session\"\n"+
+		"**Going** (1): @alice\n"+
+		"**Maybe** (1): @bob\n"+
+		"**Not going** (1): @carol\n"+
+		"1 members haven't answered.\n"+
+		"Export the list with `/mbotc attendees export "+notice.Id+"`.\n",
+		execute("author", "/mbotc attendees "+notice.Id))
+	assert.Contains(execute("bob", "/mbotc attendees "+notice.Id), "Only the author or a channel admin")
+
+	assert.Contains(execute("author", "/mbotc attendees export "+notice.Id), "CSV file")
+	require.Len(posts, 1)
+	assert.Equal(model.StringArray{"file1"}, posts[0].FileIds)
+	lines := strings.Split(strings.TrimSpace(string(uploaded)), "\n")
+	require.Len(lines, 4)
+	assert.Equal("username,name,response,answered_at", lines[0])
+	assert.True(strings.HasPrefix(lines[1], "alice,Alice Kim,Going,"))
+
+	for name, expected := range map[string]string{
+		"=HYPERLINK(\"http://evil\")": "'=HYPERLINK(\"http://evil\")",
+		"+1":                          "'+1", "-1": "'-1", "@SUM(A1)": "'@SUM(A1)", "Alice Kim": "Alice Kim", "": "",
+	} {
+		assert.Equal(expected, csvText(name), name)
+	}
+	data, err := attendeesCSV([]attendee{{user: &model.User{Username: "mallory", FirstName: "=cmd"}, rsvp: RSVP{Response: rsvpGoing}}})
+	require.NoError(err)
+	assert.Contains(string(data), "\nmallory,'=cmd,Going,")
+
+	// Reminders only go to the members who answered "going" or "maybe".
+	posts = nil
+	require.NoError(p.sendReminder(Reminder{NoticeId: notice.Id, LeadTime: "1h"}))
+	require.Len(posts, 2)
+	assert.Equal("dm_alice", posts[0].ChannelId)
+	assert.Equal("dm_bob", posts[1].ChannelId)
+	assert.Contains(posts[0].Message, "Study session")
+
+	// Events nobody answered "going" or "maybe" to are not reminded, not even in the thread.
+	unanswered := &Notice{UserId: "author", TeamId: "team1", ChannelId: "channel1", PostId: "post1", Message: "Workshop",
+		StartTime: "2021-11-06T09:00:00Z", EndTime: "2021-11-06T11:00:00Z"}
+	require.NoError(p.store.CreateNotice(unanswered))
+	posts = nil
+	require.NoError(p.sendReminder(Reminder{NoticeId: unanswered.Id, LeadTime: "1h"}))
+	assert.Empty(posts)
+
+	// Answers to a recurring event are for its next occurrence only.
+	next := time.Now().UTC().Add(24 * time.Hour).Truncate(time.Minute)
+	weekly := &Notice{UserId: "author", TeamId: "team1", ChannelId: "channel1", PostId: "post1", Message: "Weekly sync",
+		StartTime: next.Format(storedTimeLayout), EndTime: next.Add(time.Hour).Format(storedTimeLayout), TimeZone: "UTC",
+		Recurrence: &RecurrenceRule{Frequency: FrequencyWeekly, Interval: 1}}
+	require.NoError(p.store.CreateNotice(weekly))
+	assert.Contains(respond(weekly.Id, "alice", rsvpGoing), "This answer is for the event on "+next.Format("Mon 2006-01-02")+".")
+
+	posts = nil
+	require.NoError(p.sendReminder(Reminder{NoticeId: weekly.Id, LeadTime: "1h", StartAt: model.GetMillisForTime(next)}))
+	require.Len(posts, 1)
+	assert.Equal("dm_alice", posts[0].ChannelId)
+	posts = nil
+	require.NoError(p.sendReminder(Reminder{NoticeId: weekly.Id, LeadTime: "1h", StartAt: model.GetMillisForTime(next.AddDate(0, 0, 7))}))
+	assert.Empty(posts)
+
+	require.NoError(p.store.DeleteNotice(weekly.Id))
+	rsvps, err := p.store.GetNoticeRSVPs(weekly.Id, weekly.rsvpOccurrenceKey(next))
+	require.NoError(err)
+	assert.Empty(rsvps)
+}
@@ -1,6 +1,168 @@
 package main
 
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/pkg/errors"
+)
+
+const (
+	noticeKeyPrefix           = "notice_"
+	postNoticeKeyPrefix       = "post_notice_"
+	channelIndexKeyPrefix     = "idx_channel_"
+	teamIndexKeyPrefix        = "idx_team_"
+	userIndexKeyPrefix        = "idx_user_"
+	dateIndexKeyPrefix        = "idx_date_"
+	recurringIndexKey         = "idx_recurring"
+	outboxKeyPrefix           = "outbox_"
+	outboxIndexKey            = "idx_outbox"
+	reminderKeyPrefix         = "reminder_"
+	reminderIndexKeyPrefix    = "idx_reminder_"
+	reminderDayIndexKeyPrefix = "idx_reminder_day_"
+	reminderDaysIndexKey      = "idx_reminder_days"
+	feedTokenKeyPrefix        = "feed_token_"
+	feedUserKeyPrefix         = "feed_user_"
+	importKeyPrefix           = "import_"
+	ackKeyPrefix              = "ack_"
+	rsvpKeyPrefix             = "rsvp_"
+	rsvpIndexKeyPrefix        = "idx_rsvp_"
+	broadcastKeyPrefix        = "broadcast_"
+	broadcastIndexKey         = "idx_broadcast"
+	dialogConfirmPrefix       = "dialog_confirm_"
+	channelDigestPrefix       = "digest_channel_"
+	channelDigestIndexKey     = "idx_digest_channel"
+	userDigestPrefix          = "digest_user_"
+	userDigestIndexKey        = "idx_digest_user"
+
+	// noticeTimeLayout is the format times are entered in.
+	noticeTimeLayout = "2006-01-02 15:04"
+	// dateIndexLayout is the format of the UTC days of the date index keys.
+	dateIndexLayout = "20060102"
+
+	// maxIndexedDays bounds the number of per-day index keys written for a single notice.
+	maxIndexedDays = 366
+
+	maxKeyUpdateRetries = 5
+)
+
+var (
+	// ErrNoticeNotFound is returned when a notice does not exist in the KV store.
+	ErrNoticeNotFound = errors.New("notice not found")
+
+	// ErrOutboxItemNotFound is returned when an outbox item does not exist in the KV store.
+	ErrOutboxItemNotFound = errors.New("outbox item not found")
+
+	// ErrNoticeImportNotFound is returned when an import was confirmed, cancelled or expired.
+	ErrNoticeImportNotFound = errors.New("notice import not found")
+
+	// ErrDialogAlreadyConfirmed is returned when another request confirmed the same dialog
+	// submission first.
+	ErrDialogAlreadyConfirmed = errors.New("dialog submission already confirmed")
+
+	// ErrChannelDigestNotFound is returned when a channel has no digest.
+	ErrChannelDigestNotFound = errors.New("channel digest not found")
+
+	// ErrUserDigestNotFound is returned when a user has no personal digest.
+	ErrUserDigestNotFound = errors.New("user digest not found")
+)
+
+// Store persists notices, the backend outbox and the reminder queue in the plugin KV store.
+//
+// Every notice is saved under its own key and referenced from secondary index keys
+// (channel, team, author and day, or recurring), so that listings don't need to scan the whole
+// store.
 type Store interface {
+	CreateNotice(notice *Notice) error
+	GetNotice(id string) (*Notice, error)
+	GetNoticeByPostId(postId string) (*Notice, error)
+	UpdateNotice(notice *Notice) error
+	DeleteNotice(id string) error
+
+	ListNoticesByChannel(channelId string) ([]*Notice, error)
+	ListNoticesByTeam(teamId string) ([]*Notice, error)
+	ListNoticesByUser(userId string) ([]*Notice, error)
+	// ListNoticesByDateRange returns the notices with an occurrence overlapping [from, to].
+	ListNoticesByDateRange(from, to time.Time) ([]*Notice, error)
+
+	// Outbox items are kept in the order they were enqueued.
+	EnqueueOutboxItem(item *OutboxItem) error
+	GetOutboxItem(id string) (*OutboxItem, error)
+	UpdateOutboxItem(item *OutboxItem) error
+	DeleteOutboxItem(id string) error
+	ListOutboxItems() ([]*OutboxItem, error)
+
+	// Reminders are kept under one key each, indexed by the UTC day they are due.
+	// SetNoticeReminders replaces the reminders posted in the channel of the notice. The personal
+	// reminders of its readers are kept.
+	SetNoticeReminders(noticeId string, reminders []Reminder) error
+	// AddReminder queues a personal reminder, unless the user is already reminded of the same
+	// occurrence. It returns whether the reminder was added.
+	AddReminder(reminder Reminder) (bool, error)
+	ListDueReminders(now int64) ([]Reminder, error)
+	RemoveReminder(reminder Reminder) error
+
+	// Feed tokens authenticate the calendar feeds of a user. A user has at most one token.
+	GetFeedToken(userId string) (string, error)
+	ResetFeedToken(userId string) (string, error)
+	RevokeFeedToken(userId string) error
+	// GetFeedTokenUser returns the user of the token, or an empty string for an unknown token.
+	GetFeedTokenUser(token string) (string, error)
+
+	// Notice imports wait for the confirmation of the user for a limited time.
+	SaveNoticeImport(noticeImport *NoticeImport, expiry time.Duration) error
+	GetNoticeImport(id string) (*NoticeImport, error)
+	// TakeNoticeImport deletes the import and returns it, so that it is confirmed only once.
+	TakeNoticeImport(id string) (*NoticeImport, error)
+
+	// ConfirmDialogSubmission remembers the submission, by digest, a user was asked to confirm
+	// for a limited time. It returns true when the digest is the one waiting for confirmation,
+	// and otherwise makes it the one. ErrDialogAlreadyConfirmed is returned to all but one of
+	// concurrent confirmations of the same digest.
+	ConfirmDialogSubmission(userId, digest string, expiry time.Duration) (bool, error)
+
+	// Acknowledgements are the users who acknowledged a notice, in the order they did.
+	// AcknowledgeNotice returns false if the user already acknowledged it.
+	AcknowledgeNotice(noticeId, userId string) (bool, error)
+	ListNoticeAcks(noticeId string) ([]string, error)
+
+	// RSVPs are the answers of users to an event-style notice, by user id. The answers to a
+	// recurring notice are kept by occurrence, the date it starts on as dateIndexLayout, and
+	// indexed so that they are deleted with the notice. One-off notices have no occurrence.
+	// SetNoticeRSVP returns false if the user already gave the same answer.
+	SetNoticeRSVP(noticeId, occurrence, userId string, rsvp RSVP) (bool, error)
+	GetNoticeRSVPs(noticeId, occurrence string) (map[string]RSVP, error)
+
+	// Broadcasts are the priority notices still to send to the members of their channel, listed
+	// in the order they were queued.
+	QueueBroadcast(broadcast Broadcast) error
+	ListBroadcasts() ([]Broadcast, error)
+	// UpdateBroadcast saves the progress of a queued broadcast.
+	UpdateBroadcast(broadcast Broadcast) error
+	RemoveBroadcast(noticeId string) error
+
+	// Channel digests are indexed, so that the digest job finds them all.
+	SaveChannelDigest(digest *ChannelDigest) error
+	GetChannelDigest(channelId string) (*ChannelDigest, error)
+	DeleteChannelDigest(channelId string) error
+	ListChannelDigests() ([]*ChannelDigest, error)
+	// ClaimChannelDigest records that the digest of the channel is posted for the day. It
+	// returns false if it already was.
+	ClaimChannelDigest(channelId, day string) (bool, error)
+
+	// Personal digests are indexed like channel digests.
+	SaveUserDigest(digest *UserDigest) error
+	GetUserDigest(userId string) (*UserDigest, error)
+	DeleteUserDigest(userId string) error
+	ListUserDigests() ([]*UserDigest, error)
+	ClaimUserDigest(userId, day string) (bool, error)
 }
 
 type store struct {
@@ -10,3 +172,1021 @@ type store struct {
 func NewStore(p *Plugin) Store {
 	return &store{plugin: p}
 }
+
+func (s *store) CreateNotice(notice *Notice) error {
+	if notice.Id == "" {
+		notice.Id = model.NewId()
+	}
+	notice.CreateAt = model.GetMillis()
+	notice.UpdateAt = notice.CreateAt
+
+	if err := s.saveNotice(notice); err != nil {
+		return err
+	}
+
+	return s.updateIndexes(nil, notice)
+}
+
+func (s *store) GetNotice(id string) (*Notice, error) {
+	data, appErr := s.plugin.API.KVGet(noticeKeyPrefix + id)
+	if appErr != nil {
+		return nil, errors.Wrapf(appErr, "failed to get notice %s", id)
+	}
+	if data == nil {
+		return nil, ErrNoticeNotFound
+	}
+
+	var notice Notice
+	if err := json.Unmarshal(data, &notice); err != nil {
+		return nil, errors.Wrapf(err, "failed to decode notice %s", id)
+	}
+	return &notice, nil
+}
+
+func (s *store) GetNoticeByPostId(postId string) (*Notice, error) {
+	data, appErr := s.plugin.API.KVGet(postNoticeKeyPrefix + postId)
+	if appErr != nil {
+		return nil, errors.Wrapf(appErr, "failed to get notice for post %s", postId)
+	}
+	if data == nil {
+		return nil, ErrNoticeNotFound
+	}
+	return s.GetNotice(string(data))
+}
+
+func (s *store) UpdateNotice(notice *Notice) error {
+	old, err := s.GetNotice(notice.Id)
+	if err != nil {
+		return err
+	}
+
+	notice.CreateAt = old.CreateAt
+	notice.UpdateAt = model.GetMillis()
+
+	if err := s.saveNotice(notice); err != nil {
+		return err
+	}
+
+	return s.updateIndexes(old, notice)
+}
+
+func (s *store) DeleteNotice(id string) error {
+	old, err := s.GetNotice(id)
+	if err != nil {
+		return err
+	}
+
+	if err := s.updateIndexes(old, nil); err != nil {
+		return err
+	}
+
+	if appErr := s.plugin.API.KVDelete(noticeKeyPrefix + id); appErr != nil {
+		return errors.Wrapf(appErr, "failed to delete notice %s", id)
+	}
+	if appErr := s.plugin.API.KVDelete(ackKeyPrefix + id); appErr != nil {
+		return errors.Wrapf(appErr, "failed to delete acknowledgements of notice %s", id)
+	}
+	occurrences, err := s.getIndex(rsvpIndexKeyPrefix + id)
+	if err != nil {
+		return err
+	}
+	for _, occurrence := range append(occurrences, "") {
+		if appErr := s.plugin.API.KVDelete(rsvpKey(id, occurrence)); appErr != nil {
+			return errors.Wrapf(appErr, "failed to delete RSVPs of notice %s", id)
+		}
+	}
+	if appErr := s.plugin.API.KVDelete(rsvpIndexKeyPrefix + id); appErr != nil {
+		return errors.Wrapf(appErr, "failed to delete RSVP index of notice %s", id)
+	}
+	return nil
+}
+
+func (s *store) ListNoticesByChannel(channelId string) ([]*Notice, error) {
+	return s.listNotices(channelIndexKeyPrefix + channelId)
+}
+
+func (s *store) ListNoticesByTeam(teamId string) ([]*Notice, error) {
+	return s.listNotices(teamIndexKeyPrefix + teamId)
+}
+
+func (s *store) ListNoticesByUser(userId string) ([]*Notice, error) {
+	return s.listNotices(userIndexKeyPrefix + userId)
+}
+
+func (s *store) ListNoticesByDateRange(from, to time.Time) ([]*Notice, error) {
+	if to.Before(from) {
+		return nil, errors.New("invalid date range: end is before start")
+	}
+
+	keys := []string{recurringIndexKey}
+	for _, day := range daysBetween(from.UTC(), to.UTC()) {
+		keys = append(keys, dateIndexKeyPrefix+day)
+	}
+
+	notices, err := s.listNotices(keys...)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []*Notice
+	for _, notice := range notices {
+		occurrences, err := notice.occurrencesBetween(from, to)
+		if err != nil {
+			return nil, err
+		}
+		if len(occurrences) > 0 {
+			result = append(result, notice)
+		}
+	}
+	return result, nil
+}
+
+func (s *store) EnqueueOutboxItem(item *OutboxItem) error {
+	if item.Id == "" {
+		item.Id = model.NewId()
+	}
+	item.CreateAt = model.GetMillis()
+
+	if err := s.UpdateOutboxItem(item); err != nil {
+		return err
+	}
+	return s.addToIndex(outboxIndexKey, item.Id)
+}
+
+func (s *store) GetOutboxItem(id string) (*OutboxItem, error) {
+	data, appErr := s.plugin.API.KVGet(outboxKeyPrefix + id)
+	if appErr != nil {
+		return nil, errors.Wrapf(appErr, "failed to get outbox item %s", id)
+	}
+	if data == nil {
+		return nil, ErrOutboxItemNotFound
+	}
+
+	var item OutboxItem
+	if err := json.Unmarshal(data, &item); err != nil {
+		return nil, errors.Wrapf(err, "failed to decode outbox item %s", id)
+	}
+	return &item, nil
+}
+
+func (s *store) UpdateOutboxItem(item *OutboxItem) error {
+	data, err := json.Marshal(item)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode outbox item")
+	}
+	if appErr := s.plugin.API.KVSet(outboxKeyPrefix+item.Id, data); appErr != nil {
+		return errors.Wrapf(appErr, "failed to save outbox item %s", item.Id)
+	}
+	return nil
+}
+
+func (s *store) DeleteOutboxItem(id string) error {
+	if err := s.removeFromIndex(outboxIndexKey, id); err != nil {
+		return err
+	}
+	if appErr := s.plugin.API.KVDelete(outboxKeyPrefix + id); appErr != nil {
+		return errors.Wrapf(appErr, "failed to delete outbox item %s", id)
+	}
+	return nil
+}
+
+func (s *store) ListOutboxItems() ([]*OutboxItem, error) {
+	ids, err := s.getIndex(outboxIndexKey)
+	if err != nil {
+		return nil, err
+	}
+
+	var items []*OutboxItem
+	for _, id := range ids {
+		item, err := s.GetOutboxItem(id)
+		if err == ErrOutboxItemNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+func (s *store) SetNoticeReminders(noticeId string, reminders []Reminder) error {
+	indexKey := reminderIndexKeyPrefix + noticeId
+	ids, err := s.getIndex(indexKey)
+	if err != nil {
+		return err
+	}
+
+	wanted := map[string]Reminder{}
+	for _, reminder := range reminders {
+		wanted[reminderId(reminder)] = reminder
+	}
+	for _, id := range ids {
+		if _, ok := wanted[id]; ok {
+			delete(wanted, id)
+			continue
+		}
+		reminder, err := s.getReminder(id)
+		if err != nil {
+			return err
+		}
+		if reminder == nil {
+			if err := s.removeFromIndex(indexKey, id); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := s.RemoveReminder(*reminder); err != nil {
+			return err
+		}
+	}
+
+	for id, reminder := range wanted {
+		data, err := json.Marshal(reminder)
+		if err != nil {
+			return errors.Wrap(err, "failed to encode reminder")
+		}
+		if appErr := s.plugin.API.KVSet(reminderKeyPrefix+id, data); appErr != nil {
+			return errors.Wrapf(appErr, "failed to save reminder of notice %s", noticeId)
+		}
+		if err := s.indexReminder(id, reminder); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *store) AddReminder(reminder Reminder) (bool, error) {
+	data, err := json.Marshal(reminder)
+	if err != nil {
+		return false, errors.Wrap(err, "failed to encode reminder")
+	}
+
+	// The key of a personal reminder is derived from its occurrence and user, so the reminder is
+	// only added if the key does not exist yet.
+	id := reminderId(reminder)
+	added, appErr := s.plugin.API.KVCompareAndSet(reminderKeyPrefix+id, nil, data)
+	if appErr != nil {
+		return false, errors.Wrapf(appErr, "failed to save reminder of notice %s", reminder.NoticeId)
+	}
+	if !added {
+		return false, nil
+	}
+	return true, s.indexReminder(id, reminder)
+}
+
+func (s *store) ListDueReminders(now int64) ([]Reminder, error) {
+	days, err := s.getIndex(reminderDaysIndexKey)
+	if err != nil {
+		return nil, err
+	}
+
+	today := model.GetTimeForMillis(now).UTC().Format(dateIndexLayout)
+	var due []Reminder
+	for _, day := range days {
+		if day > today {
+			continue
+		}
+
+		ids, err := s.getIndex(reminderDayIndexKeyPrefix + day)
+		if err != nil {
+			return nil, err
+		}
+		// Reminders are not added to past days, so their emptied buckets can be dropped.
+		if len(ids) == 0 && day < today {
+			if err := s.removeFromIndex(reminderDaysIndexKey, day); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		for _, id := range ids {
+			reminder, err := s.getReminder(id)
+			if err != nil {
+				return nil, err
+			}
+			if reminder != nil && reminder.At <= now {
+				due = append(due, *reminder)
+			}
+		}
+	}
+
+	sort.SliceStable(due, func(i, j int) bool { return due[i].At < due[j].At })
+	return due, nil
+}
+
+func (s *store) RemoveReminder(reminder Reminder) error {
+	id := reminderId(reminder)
+	if err := s.removeFromIndex(reminderDayIndexKeyPrefix+reminderDay(reminder), id); err != nil {
+		return err
+	}
+	if reminder.UserId == "" {
+		if err := s.removeFromIndex(reminderIndexKeyPrefix+reminder.NoticeId, id); err != nil {
+			return err
+		}
+	}
+	if appErr := s.plugin.API.KVDelete(reminderKeyPrefix + id); appErr != nil {
+		return errors.Wrapf(appErr, "failed to delete reminder of notice %s", reminder.NoticeId)
+	}
+	return nil
+}
+
+func (s *store) getReminder(id string) (*Reminder, error) {
+	data, appErr := s.plugin.API.KVGet(reminderKeyPrefix + id)
+	if appErr != nil {
+		return nil, errors.Wrapf(appErr, "failed to get reminder %s", id)
+	}
+	if data == nil {
+		return nil, nil
+	}
+
+	var reminder Reminder
+	if err := json.Unmarshal(data, &reminder); err != nil {
+		return nil, errors.Wrapf(err, "failed to decode reminder %s", id)
+	}
+	return &reminder, nil
+}
+
+// indexReminder adds a saved reminder to the bucket of the UTC day it is due, and the reminder
+// of a notice to the index of the notice.
+func (s *store) indexReminder(id string, reminder Reminder) error {
+	day := reminderDay(reminder)
+	if err := s.addToIndex(reminderDayIndexKeyPrefix+day, id); err != nil {
+		return err
+	}
+	if err := s.addToIndex(reminderDaysIndexKey, day); err != nil {
+		return err
+	}
+	if reminder.UserId == "" {
+		return s.addToIndex(reminderIndexKeyPrefix+reminder.NoticeId, id)
+	}
+	return nil
+}
+
+// reminderId identifies a reminder by the fields that make it unique: the occurrence and user
+// of a personal reminder, the due time and occurrence of the reminder of a notice.
+func reminderId(reminder Reminder) string {
+	fields := []string{reminder.NoticeId, strconv.FormatInt(reminder.StartAt, 10)}
+	if reminder.UserId != "" {
+		fields = append(fields, reminder.UserId)
+	} else {
+		fields = append(fields, reminder.LeadTime, strconv.FormatInt(reminder.At, 10))
+	}
+	sum := sha256.Sum256([]byte(strings.Join(fields, "|")))
+	return hex.EncodeToString(sum[:16])
+}
+
+// reminderDay is the UTC day the reminder is due, as in the date index keys.
+func reminderDay(reminder Reminder) string {
+	return model.GetTimeForMillis(reminder.At).UTC().Format(dateIndexLayout)
+}
+
+func (s *store) QueueBroadcast(broadcast Broadcast) error {
+	data, err := json.Marshal(broadcast)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode broadcast")
+	}
+
+	// A notice is broadcast once, so an already queued broadcast is kept as is.
+	added, appErr := s.plugin.API.KVCompareAndSet(broadcastKeyPrefix+broadcast.NoticeId, nil, data)
+	if appErr != nil {
+		return errors.Wrapf(appErr, "failed to queue broadcast of notice %s", broadcast.NoticeId)
+	}
+	if !added {
+		return nil
+	}
+	return s.addToIndex(broadcastIndexKey, broadcast.NoticeId)
+}
+
+func (s *store) ListBroadcasts() ([]Broadcast, error) {
+	ids, err := s.getIndex(broadcastIndexKey)
+	if err != nil {
+		return nil, err
+	}
+
+	var broadcasts []Broadcast
+	for _, id := range ids {
+		data, appErr := s.plugin.API.KVGet(broadcastKeyPrefix + id)
+		if appErr != nil {
+			return nil, errors.Wrapf(appErr, "failed to get broadcast of notice %s", id)
+		}
+		if data == nil {
+			continue
+		}
+
+		var broadcast Broadcast
+		if err := json.Unmarshal(data, &broadcast); err != nil {
+			return nil, errors.Wrapf(err, "failed to decode broadcast of notice %s", id)
+		}
+		broadcasts = append(broadcasts, broadcast)
+	}
+	return broadcasts, nil
+}
+
+func (s *store) UpdateBroadcast(broadcast Broadcast) error {
+	return s.modifyKey(broadcastKeyPrefix+broadcast.NoticeId, func(data []byte) ([]byte, error) {
+		// A removed broadcast is not queued again.
+		if data == nil {
+			return nil, nil
+		}
+		return json.Marshal(broadcast)
+	})
+}
+
+func (s *store) RemoveBroadcast(noticeId string) error {
+	if err := s.removeFromIndex(broadcastIndexKey, noticeId); err != nil {
+		return err
+	}
+	if appErr := s.plugin.API.KVDelete(broadcastKeyPrefix + noticeId); appErr != nil {
+		return errors.Wrapf(appErr, "failed to delete broadcast of notice %s", noticeId)
+	}
+	return nil
+}
+
+func (s *store) GetFeedToken(userId string) (string, error) {
+	data, appErr := s.plugin.API.KVGet(feedTokenKeyPrefix + userId)
+	if appErr != nil {
+		return "", errors.Wrapf(appErr, "failed to get feed token of %s", userId)
+	}
+	return string(data), nil
+}
+
+func (s *store) ResetFeedToken(userId string) (string, error) {
+	if err := s.RevokeFeedToken(userId); err != nil {
+		return "", err
+	}
+
+	token := model.NewId()
+	if appErr := s.plugin.API.KVSet(feedUserKeyPrefix+token, []byte(userId)); appErr != nil {
+		return "", errors.Wrapf(appErr, "failed to save feed token of %s", userId)
+	}
+	if appErr := s.plugin.API.KVSet(feedTokenKeyPrefix+userId, []byte(token)); appErr != nil {
+		return "", errors.Wrapf(appErr, "failed to save feed token of %s", userId)
+	}
+	return token, nil
+}
+
+func (s *store) RevokeFeedToken(userId string) error {
+	token, err := s.GetFeedToken(userId)
+	if err != nil || token == "" {
+		return err
+	}
+
+	if appErr := s.plugin.API.KVDelete(feedUserKeyPrefix + token); appErr != nil {
+		return errors.Wrapf(appErr, "failed to revoke feed token of %s", userId)
+	}
+	if appErr := s.plugin.API.KVDelete(feedTokenKeyPrefix + userId); appErr != nil {
+		return errors.Wrapf(appErr, "failed to revoke feed token of %s", userId)
+	}
+	return nil
+}
+
+func (s *store) GetFeedTokenUser(token string) (string, error) {
+	if !model.IsValidId(token) {
+		return "", nil
+	}
+	data, appErr := s.plugin.API.KVGet(feedUserKeyPrefix + token)
+	if appErr != nil {
+		return "", errors.Wrap(appErr, "failed to get feed token")
+	}
+	return string(data), nil
+}
+
+func (s *store) SaveNoticeImport(noticeImport *NoticeImport, expiry time.Duration) error {
+	if noticeImport.Id == "" {
+		noticeImport.Id = model.NewId()
+	}
+	noticeImport.CreateAt = model.GetMillis()
+
+	data, err := json.Marshal(noticeImport)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode notice import")
+	}
+	if appErr := s.plugin.API.KVSetWithExpiry(importKeyPrefix+noticeImport.Id, data, int64(expiry/time.Second)); appErr != nil {
+		return errors.Wrapf(appErr, "failed to save notice import %s", noticeImport.Id)
+	}
+	return nil
+}
+
+func (s *store) GetNoticeImport(id string) (*NoticeImport, error) {
+	data, appErr := s.plugin.API.KVGet(importKeyPrefix + id)
+	if appErr != nil {
+		return nil, errors.Wrapf(appErr, "failed to get notice import %s", id)
+	}
+	return decodeNoticeImport(id, data)
+}
+
+func (s *store) TakeNoticeImport(id string) (*NoticeImport, error) {
+	var taken []byte
+	err := s.modifyKey(importKeyPrefix+id, func(data []byte) ([]byte, error) {
+		taken = data
+		return nil, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return decodeNoticeImport(id, taken)
+}
+
+func decodeNoticeImport(id string, data []byte) (*NoticeImport, error) {
+	if data == nil {
+		return nil, ErrNoticeImportNotFound
+	}
+
+	var noticeImport NoticeImport
+	if err := json.Unmarshal(data, &noticeImport); err != nil {
+		return nil, errors.Wrapf(err, "failed to decode notice import %s", id)
+	}
+	return &noticeImport, nil
+}
+
+func (s *store) ConfirmDialogSubmission(userId, digest string, expiry time.Duration) (bool, error) {
+	key := dialogConfirmPrefix + userId
+	data, appErr := s.plugin.API.KVGet(key)
+	if appErr != nil {
+		return false, errors.Wrapf(appErr, "failed to get dialog confirmation of %s", userId)
+	}
+	if string(data) == digest {
+		deleted, appErr := s.plugin.API.KVCompareAndDelete(key, data)
+		if appErr != nil {
+			return false, errors.Wrapf(appErr, "failed to delete dialog confirmation of %s", userId)
+		}
+		if !deleted {
+			return false, ErrDialogAlreadyConfirmed
+		}
+		return true, nil
+	}
+	if appErr := s.plugin.API.KVSetWithExpiry(key, []byte(digest), int64(expiry/time.Second)); appErr != nil {
+		return false, errors.Wrapf(appErr, "failed to save dialog confirmation of %s", userId)
+	}
+	return false, nil
+}
+
+func (s *store) AcknowledgeNotice(noticeId, userId string) (bool, error) {
+	added := false
+	err := s.modifyIndex(ackKeyPrefix+noticeId, func(userIds []string) []string {
+		added = false
+		for _, existing := range userIds {
+			if existing == userId {
+				return userIds
+			}
+		}
+		added = true
+		return append(userIds, userId)
+	})
+	return added && err == nil, err
+}
+
+func (s *store) ListNoticeAcks(noticeId string) ([]string, error) {
+	return s.getIndex(ackKeyPrefix + noticeId)
+}
+
+// rsvpKey is the key of the RSVPs to an occurrence of a notice.
+func rsvpKey(noticeId, occurrence string) string {
+	if occurrence == "" {
+		return rsvpKeyPrefix + noticeId
+	}
+	return rsvpKeyPrefix + noticeId + "_" + occurrence
+}
+
+func (s *store) SetNoticeRSVP(noticeId, occurrence, userId string, rsvp RSVP) (bool, error) {
+	if occurrence != "" {
+		err := s.modifyIndex(rsvpIndexKeyPrefix+noticeId, func(occurrences []string) []string {
+			for _, existing := range occurrences {
+				if existing == occurrence {
+					return occurrences
+				}
+			}
+			return append(occurrences, occurrence)
+		})
+		if err != nil {
+			return false, err
+		}
+	}
+
+	changed := false
+	err := s.modifyKey(rsvpKey(noticeId, occurrence), func(data []byte) ([]byte, error) {
+		changed = false
+		rsvps, err := decodeRSVPs(noticeId, data)
+		if err != nil {
+			return nil, err
+		}
+		if rsvps[userId].Response == rsvp.Response {
+			return data, nil
+		}
+		changed = true
+		rsvps[userId] = rsvp
+		return json.Marshal(rsvps)
+	})
+	return changed && err == nil, err
+}
+
+func (s *store) GetNoticeRSVPs(noticeId, occurrence string) (map[string]RSVP, error) {
+	data, appErr := s.plugin.API.KVGet(rsvpKey(noticeId, occurrence))
+	if appErr != nil {
+		return nil, errors.Wrapf(appErr, "failed to get RSVPs of notice %s", noticeId)
+	}
+	return decodeRSVPs(noticeId, data)
+}
+
+func decodeRSVPs(noticeId string, data []byte) (map[string]RSVP, error) {
+	rsvps := map[string]RSVP{}
+	if data == nil {
+		return rsvps, nil
+	}
+	if err := json.Unmarshal(data, &rsvps); err != nil {
+		return nil, errors.Wrapf(err, "failed to decode RSVPs of notice %s", noticeId)
+	}
+	return rsvps, nil
+}
+
+func (s *store) SaveChannelDigest(digest *ChannelDigest) error {
+	data, err := json.Marshal(digest)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode channel digest")
+	}
+	if appErr := s.plugin.API.KVSet(channelDigestPrefix+digest.ChannelId, data); appErr != nil {
+		return errors.Wrapf(appErr, "failed to save digest of channel %s", digest.ChannelId)
+	}
+	return s.addToIndex(channelDigestIndexKey, digest.ChannelId)
+}
+
+func (s *store) GetChannelDigest(channelId string) (*ChannelDigest, error) {
+	data, appErr := s.plugin.API.KVGet(channelDigestPrefix + channelId)
+	if appErr != nil {
+		return nil, errors.Wrapf(appErr, "failed to get digest of channel %s", channelId)
+	}
+	return decodeChannelDigest(channelId, data)
+}
+
+func (s *store) DeleteChannelDigest(channelId string) error {
+	if err := s.removeFromIndex(channelDigestIndexKey, channelId); err != nil {
+		return err
+	}
+	if appErr := s.plugin.API.KVDelete(channelDigestPrefix + channelId); appErr != nil {
+		return errors.Wrapf(appErr, "failed to delete digest of channel %s", channelId)
+	}
+	return nil
+}
+
+func (s *store) ListChannelDigests() ([]*ChannelDigest, error) {
+	channelIds, err := s.getIndex(channelDigestIndexKey)
+	if err != nil {
+		return nil, err
+	}
+
+	var digests []*ChannelDigest
+	for _, channelId := range channelIds {
+		digest, err := s.GetChannelDigest(channelId)
+		if err == ErrChannelDigestNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		digests = append(digests, digest)
+	}
+	return digests, nil
+}
+
+func (s *store) ClaimChannelDigest(channelId, day string) (bool, error) {
+	return s.claimDigestDay(channelDigestPrefix+channelId, day, ErrChannelDigestNotFound)
+}
+
+func decodeChannelDigest(channelId string, data []byte) (*ChannelDigest, error) {
+	if data == nil {
+		return nil, ErrChannelDigestNotFound
+	}
+
+	var digest ChannelDigest
+	if err := json.Unmarshal(data, &digest); err != nil {
+		return nil, errors.Wrapf(err, "failed to decode digest of channel %s", channelId)
+	}
+	return &digest, nil
+}
+
+func (s *store) SaveUserDigest(digest *UserDigest) error {
+	data, err := json.Marshal(digest)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode user digest")
+	}
+	if appErr := s.plugin.API.KVSet(userDigestPrefix+digest.UserId, data); appErr != nil {
+		return errors.Wrapf(appErr, "failed to save digest of user %s", digest.UserId)
+	}
+	return s.addToIndex(userDigestIndexKey, digest.UserId)
+}
+
+func (s *store) GetUserDigest(userId string) (*UserDigest, error) {
+	data, appErr := s.plugin.API.KVGet(userDigestPrefix + userId)
+	if appErr != nil {
+		return nil, errors.Wrapf(appErr, "failed to get digest of user %s", userId)
+	}
+	if data == nil {
+		return nil, ErrUserDigestNotFound
+	}
+
+	var digest UserDigest
+	if err := json.Unmarshal(data, &digest); err != nil {
+		return nil, errors.Wrapf(err, "failed to decode digest of user %s", userId)
+	}
+	return &digest, nil
+}
+
+func (s *store) DeleteUserDigest(userId string) error {
+	if err := s.removeFromIndex(userDigestIndexKey, userId); err != nil {
+		return err
+	}
+	if appErr := s.plugin.API.KVDelete(userDigestPrefix + userId); appErr != nil {
+		return errors.Wrapf(appErr, "failed to delete digest of user %s", userId)
+	}
+	return nil
+}
+
+func (s *store) ListUserDigests() ([]*UserDigest, error) {
+	userIds, err := s.getIndex(userDigestIndexKey)
+	if err != nil {
+		return nil, err
+	}
+
+	var digests []*UserDigest
+	for _, userId := range userIds {
+		digest, err := s.GetUserDigest(userId)
+		if err == ErrUserDigestNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		digests = append(digests, digest)
+	}
+	return digests, nil
+}
+
+func (s *store) ClaimUserDigest(userId, day string) (bool, error) {
+	return s.claimDigestDay(userDigestPrefix+userId, day, ErrUserDigestNotFound)
+}
+
+// claimDigestDay sets the last_day of the digest saved under key, unless it already is day. It
+// returns whether it was set.
+func (s *store) claimDigestDay(key, day string, notFound error) (bool, error) {
+	claimed := false
+	err := s.modifyKey(key, func(data []byte) ([]byte, error) {
+		claimed = false
+		if data == nil {
+			return nil, notFound
+		}
+		var digest map[string]interface{}
+		if err := json.Unmarshal(data, &digest); err != nil {
+			return nil, errors.Wrapf(err, "failed to decode digest %s", key)
+		}
+		if digest["last_day"] == day {
+			return data, nil
+		}
+		claimed = true
+		digest["last_day"] = day
+		return json.Marshal(digest)
+	})
+	return claimed && err == nil, err
+}
+
+func (s *store) saveNotice(notice *Notice) error {
+	data, err := json.Marshal(notice)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode notice")
+	}
+	if appErr := s.plugin.API.KVSet(noticeKeyPrefix+notice.Id, data); appErr != nil {
+		return errors.Wrapf(appErr, "failed to save notice %s", notice.Id)
+	}
+	return nil
+}
+
+// listNotices loads the notices referenced by the given index keys, without duplicates.
+// Index entries pointing to notices that no longer exist are skipped.
+func (s *store) listNotices(indexKeys ...string) ([]*Notice, error) {
+	seen := map[string]bool{}
+	var notices []*Notice
+	for _, key := range indexKeys {
+		ids, err := s.getIndex(key)
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range ids {
+			if seen[id] {
+				continue
+			}
+			seen[id] = true
+
+			notice, err := s.GetNotice(id)
+			if err == ErrNoticeNotFound {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			notices = append(notices, notice)
+		}
+	}
+	return notices, nil
+}
+
+// updateIndexes moves a notice from the index keys of old to the index keys of updated.
+// Either may be nil, for a created or a deleted notice respectively.
+func (s *store) updateIndexes(old, updated *Notice) error {
+	oldKeys, newKeys := map[string]bool{}, map[string]bool{}
+	if old != nil {
+		for _, key := range old.indexKeys() {
+			oldKeys[key] = true
+		}
+	}
+	if updated != nil {
+		for _, key := range updated.indexKeys() {
+			newKeys[key] = true
+		}
+	}
+
+	for key := range oldKeys {
+		if newKeys[key] {
+			continue
+		}
+		if err := s.removeFromIndex(key, old.Id); err != nil {
+			return err
+		}
+	}
+	for key := range newKeys {
+		if oldKeys[key] {
+			continue
+		}
+		if err := s.addToIndex(key, updated.Id); err != nil {
+			return err
+		}
+	}
+
+	if old != nil && old.PostId != "" && (updated == nil || updated.PostId != old.PostId) {
+		if appErr := s.plugin.API.KVDelete(postNoticeKeyPrefix + old.PostId); appErr != nil {
+			return errors.Wrapf(appErr, "failed to delete post mapping of notice %s", old.Id)
+		}
+	}
+	if updated != nil && updated.PostId != "" {
+		if appErr := s.plugin.API.KVSet(postNoticeKeyPrefix+updated.PostId, []byte(updated.Id)); appErr != nil {
+			return errors.Wrapf(appErr, "failed to save post mapping of notice %s", updated.Id)
+		}
+	}
+	return nil
+}
+
+func (s *store) getIndex(key string) ([]string, error) {
+	data, appErr := s.plugin.API.KVGet(key)
+	if appErr != nil {
+		return nil, errors.Wrapf(appErr, "failed to get index %s", key)
+	}
+	if data == nil {
+		return nil, nil
+	}
+
+	var ids []string
+	if err := json.Unmarshal(data, &ids); err != nil {
+		return nil, errors.Wrapf(err, "failed to decode index %s", key)
+	}
+	return ids, nil
+}
+
+func (s *store) addToIndex(key, id string) error {
+	return s.modifyIndex(key, func(ids []string) []string {
+		for _, existing := range ids {
+			if existing == id {
+				return ids
+			}
+		}
+		return append(ids, id)
+	})
+}
+
+func (s *store) removeFromIndex(key, id string) error {
+	return s.modifyIndex(key, func(ids []string) []string {
+		result := ids[:0]
+		for _, existing := range ids {
+			if existing != id {
+				result = append(result, existing)
+			}
+		}
+		return result
+	})
+}
+
+// modifyIndex applies modify to the ids stored under key. Empty indexes are deleted.
+func (s *store) modifyIndex(key string, modify func(ids []string) []string) error {
+	return s.modifyKey(key, func(data []byte) ([]byte, error) {
+		var ids []string
+		if data != nil {
+			if err := json.Unmarshal(data, &ids); err != nil {
+				return nil, errors.Wrapf(err, "failed to decode index %s", key)
+			}
+		}
+
+		ids = modify(ids)
+		if len(ids) == 0 {
+			return nil, nil
+		}
+		return json.Marshal(ids)
+	})
+}
+
+// modifyKey applies modify to the value stored under key with compare-and-set, retrying when
+// another writer changed the value concurrently. The key is deleted when modify returns nil.
+func (s *store) modifyKey(key string, modify func(data []byte) ([]byte, error)) error {
+	for i := 0; i < maxKeyUpdateRetries; i++ {
+		oldData, appErr := s.plugin.API.KVGet(key)
+		if appErr != nil {
+			return errors.Wrapf(appErr, "failed to get %s", key)
+		}
+
+		newData, err := modify(oldData)
+		if err != nil {
+			return err
+		}
+		if bytes.Equal(oldData, newData) {
+			return nil
+		}
+
+		var ok bool
+		if newData == nil {
+			ok, appErr = s.plugin.API.KVCompareAndDelete(key, oldData)
+		} else {
+			ok, appErr = s.plugin.API.KVCompareAndSet(key, oldData, newData)
+		}
+		if appErr != nil {
+			return errors.Wrapf(appErr, "failed to update %s", key)
+		}
+		if ok {
+			return nil
+		}
+	}
+	return errors.Errorf("failed to update %s: too many concurrent updates", key)
+}
+
+// indexKeys returns every secondary index key the notice should be listed under. Cancelled
+// notices aren't listed.
+func (n *Notice) indexKeys() []string {
+	if n.DeleteAt != 0 {
+		return nil
+	}
+
+	var keys []string
+	if n.ChannelId != "" {
+		keys = append(keys, channelIndexKeyPrefix+n.ChannelId)
+	}
+	if n.TeamId != "" {
+		keys = append(keys, teamIndexKeyPrefix+n.TeamId)
+	}
+	if n.UserId != "" {
+		keys = append(keys, userIndexKeyPrefix+n.UserId)
+	}
+	if n.Recurrence != nil {
+		// Recurring notices have no last day, so they are listed for every date range.
+		keys = append(keys, recurringIndexKey)
+	} else if start, end, err := n.period(); err == nil {
+		for _, day := range daysBetween(start.UTC(), end.UTC()) {
+			keys = append(keys, dateIndexKeyPrefix+day)
+		}
+	}
+	return keys
+}
+
+// period parses the start and end time of the notice, in the timezone they were entered in.
+func (n *Notice) period() (start, end time.Time, err error) {
+	start, err = parseStoredTime(n.StartTime, n.location())
+	if err != nil {
+		return start, end, errors.Wrap(err, "invalid start time")
+	}
+	if n.EndTime == "" {
+		return start, start, nil
+	}
+	end, err = parseStoredTime(n.EndTime, n.location())
+	if err != nil {
+		return start, end, errors.Wrap(err, "invalid end time")
+	}
+	if end.Before(start) {
+		return start, end, errors.New("end time is before start time")
+	}
+	return start, end, nil
+}
+
+// parseStoredTime reads a stored notice time. Notices saved before times were stored in UTC
+// hold a noticeTimeLayout time of the server timezone.
+func parseStoredTime(value string, loc *time.Location) (time.Time, error) {
+	if t, err := time.Parse(storedTimeLayout, value); err == nil {
+		return t.In(loc), nil
+	}
+	return time.ParseInLocation(noticeTimeLayout, value, time.Local)
+}
+
+// daysBetween lists the calendar days from start to end inclusive, capped at maxIndexedDays.
+func daysBetween(start, end time.Time) []string {
+	var days []string
+	day := time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, start.Location())
+	for !day.After(end) && len(days) < maxIndexedDays {
+		days = append(days, day.Format(dateIndexLayout))
+		day = day.AddDate(0, 0, 1)
+	}
+	return days
+}
@@ -0,0 +1,306 @@
+package main
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/mattermost/mattermost-server/v5/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// kvAPI is a plugin API whose KV store is kept in memory and whose logs are discarded. Every
+// other method is mocked.
+type kvAPI struct {
+	*plugintest.API
+
+	lock sync.Mutex
+	kv   map[string][]byte
+}
+
+func newKVAPI() *kvAPI {
+	return &kvAPI{API: &plugintest.API{}, kv: map[string][]byte{}}
+}
+
+func (a *kvAPI) KVGet(key string) ([]byte, *model.AppError) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	return a.kv[key], nil
+}
+
+func (a *kvAPI) KVSet(key string, value []byte) *model.AppError {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.kv[key] = value
+	return nil
+}
+
+func (a *kvAPI) KVSetWithExpiry(key string, value []byte, expireInSeconds int64) *model.AppError {
+	return a.KVSet(key, value)
+}
+
+func (a *kvAPI) KVDelete(key string) *model.AppError {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	delete(a.kv, key)
+	return nil
+}
+
+func (a *kvAPI) KVCompareAndSet(key string, oldValue, newValue []byte) (bool, *model.AppError) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if !bytes.Equal(a.kv[key], oldValue) {
+		return false, nil
+	}
+	a.kv[key] = newValue
+	return true, nil
+}
+
+func (a *kvAPI) KVCompareAndDelete(key string, oldValue []byte) (bool, *model.AppError) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if !bytes.Equal(a.kv[key], oldValue) {
+		return false, nil
+	}
+	delete(a.kv, key)
+	return true, nil
+}
+
+func (a *kvAPI) LogDebug(msg string, keyValuePairs ...interface{}) {}
+func (a *kvAPI) LogInfo(msg string, keyValuePairs ...interface{})  {}
+func (a *kvAPI) LogWarn(msg string, keyValuePairs ...interface{})  {}
+func (a *kvAPI) LogError(msg string, keyValuePairs ...interface{}) {}
+
+func newTestStore() (Store, *kvAPI) {
+	api := newKVAPI()
+	p := &Plugin{}
+	p.SetAPI(api)
+	return NewStore(p), api
+}
+
+func TestStoreCRUD(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	s, _ := newTestStore()
+
+	notice := &Notice{
+		UserId:    "user1",
+		TeamId:    "team1",
+		ChannelId: "channel1",
+		PostId:    "post1",
+		Message:   "hello",
+		StartTime: "2021-11-05 09:00",
+		EndTime:   "2021-11-06 18:00",
+	}
+	require.NoError(s.CreateNotice(notice))
+	require.NotEmpty(notice.Id)
+
+	got, err := s.GetNotice(notice.Id)
+	require.NoError(err)
+	assert.Equal("hello", got.Message)
+
+	got, err = s.GetNoticeByPostId("post1")
+	require.NoError(err)
+	assert.Equal(notice.Id, got.Id)
+
+	notice.Message = "updated"
+	notice.ChannelId = "channel2"
+	require.NoError(s.UpdateNotice(notice))
+
+	list, err := s.ListNoticesByChannel("channel1")
+	require.NoError(err)
+	assert.Empty(list)
+	list, err = s.ListNoticesByChannel("channel2")
+	require.NoError(err)
+	require.Len(list, 1)
+	assert.Equal("updated", list[0].Message)
+
+	require.NoError(s.DeleteNotice(notice.Id))
+	_, err = s.GetNotice(notice.Id)
+	assert.Equal(ErrNoticeNotFound, err)
+	_, err = s.GetNoticeByPostId("post1")
+	assert.Equal(ErrNoticeNotFound, err)
+	list, err = s.ListNoticesByUser("user1")
+	require.NoError(err)
+	assert.Empty(list)
+}
+
+func TestStoreListNoticesByDateRange(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	s, _ := newTestStore()
+
+	for _, notice := range []*Notice{
+		{ChannelId: "c", Message: "single day", StartTime: "2021-11-05 09:00", EndTime: "2021-11-05 09:00"},
+		{ChannelId: "c", Message: "spanning", StartTime: "2021-11-01 09:00", EndTime: "2021-11-10 18:00"},
+		{ChannelId: "c", Message: "later", StartTime: "2021-12-01 09:00", EndTime: "2021-12-01 09:00"},
+	} {
+		require.NoError(s.CreateNotice(notice))
+	}
+
+	from := time.Date(2021, 11, 5, 0, 0, 0, 0, time.Local)
+	to := time.Date(2021, 11, 5, 23, 59, 0, 0, time.Local)
+	list, err := s.ListNoticesByDateRange(from, to)
+	require.NoError(err)
+
+	var messages []string
+	for _, notice := range list {
+		messages = append(messages, notice.Message)
+	}
+	assert.ElementsMatch([]string{"single day", "spanning"}, messages)
+
+	_, err = s.ListNoticesByDateRange(to, from)
+	assert.Error(err)
+}
+
+func TestStoreCancelledNoticesAreNotListed(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	s, _ := newTestStore()
+
+	notice := &Notice{UserId: "user1", ChannelId: "channel1", PostId: "post1", StartTime: "2021-11-05 09:00", EndTime: "2021-11-05 09:00"}
+	require.NoError(s.CreateNotice(notice))
+
+	notice.DeleteAt = model.GetMillis()
+	require.NoError(s.UpdateNotice(notice))
+
+	list, err := s.ListNoticesByChannel("channel1")
+	require.NoError(err)
+	assert.Empty(list)
+
+	got, err := s.GetNoticeByPostId("post1")
+	require.NoError(err)
+	assert.NotZero(got.DeleteAt)
+}
+
+func TestStoreAcknowledgeNotice(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	s, _ := newTestStore()
+
+	for _, userId := range []string{"user1", "user2", "user1"} {
+		_, err := s.AcknowledgeNotice("notice1", userId)
+		require.NoError(err)
+	}
+	added, err := s.AcknowledgeNotice("notice1", "user2")
+	require.NoError(err)
+	assert.False(added)
+
+	acks, err := s.ListNoticeAcks("notice1")
+	require.NoError(err)
+	assert.Equal([]string{"user1", "user2"}, acks)
+}
+
+func TestStorePersonalReminders(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	s, _ := newTestStore()
+
+	personal := Reminder{NoticeId: "notice1", LeadTime: "15m", At: 2000, StartAt: 2900, UserId: "user1"}
+	added, err := s.AddReminder(personal)
+	require.NoError(err)
+	assert.True(added)
+	added, err = s.AddReminder(personal)
+	require.NoError(err)
+	assert.False(added)
+
+	// Rescheduling the reminders of the notice keeps the personal ones.
+	require.NoError(s.SetNoticeReminders("notice1", []Reminder{{NoticeId: "notice1", LeadTime: "1h", At: 1000}}))
+	due, err := s.ListDueReminders(3000)
+	require.NoError(err)
+	require.Len(due, 2)
+	assert.Equal("1h", due[0].LeadTime)
+	assert.Equal(personal, due[1])
+}
+
+func TestStoreReminderDays(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	s, api := newTestStore()
+
+	day := int64(24 * time.Hour / time.Millisecond)
+	first := Reminder{NoticeId: "notice1", LeadTime: "1h", At: 1000}
+	second := Reminder{NoticeId: "notice1", LeadTime: "0m", At: 2*day + 1000}
+	require.NoError(s.SetNoticeReminders("notice1", []Reminder{first, second}))
+	assert.NotNil(api.kv[reminderDayIndexKeyPrefix+"19700101"])
+	assert.NotNil(api.kv[reminderDayIndexKeyPrefix+"19700103"])
+
+	due, err := s.ListDueReminders(day)
+	require.NoError(err)
+	assert.Equal([]Reminder{first}, due)
+
+	// Sent reminders are removed, and the emptied past days are dropped.
+	require.NoError(s.RemoveReminder(first))
+	due, err = s.ListDueReminders(3 * day)
+	require.NoError(err)
+	assert.Equal([]Reminder{second}, due)
+	days, err := s.(*store).getIndex(reminderDaysIndexKey)
+	require.NoError(err)
+	assert.Equal([]string{"19700103"}, days)
+
+	// Rescheduling replaces the reminders of the notice.
+	require.NoError(s.SetNoticeReminders("notice1", nil))
+	due, err = s.ListDueReminders(3 * day)
+	require.NoError(err)
+	assert.Empty(due)
+	assert.Nil(api.kv[reminderIndexKeyPrefix+"notice1"])
+}
+
+func TestStoreBroadcasts(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	s, _ := newTestStore()
+
+	require.NoError(s.QueueBroadcast(Broadcast{NoticeId: "notice1"}))
+	require.NoError(s.QueueBroadcast(Broadcast{NoticeId: "notice2"}))
+	require.NoError(s.UpdateBroadcast(Broadcast{NoticeId: "notice1", UserIds: []string{"user1", "user2"}, Next: 1}))
+	// Queueing a notice again keeps its progress.
+	require.NoError(s.QueueBroadcast(Broadcast{NoticeId: "notice1"}))
+
+	broadcasts, err := s.ListBroadcasts()
+	require.NoError(err)
+	assert.Equal([]Broadcast{{NoticeId: "notice1", UserIds: []string{"user1", "user2"}, Next: 1}, {NoticeId: "notice2"}}, broadcasts)
+
+	// A removed broadcast is not brought back by a late update.
+	require.NoError(s.RemoveBroadcast("notice1"))
+	require.NoError(s.UpdateBroadcast(Broadcast{NoticeId: "notice1", Next: 2}))
+	broadcasts, err = s.ListBroadcasts()
+	require.NoError(err)
+	assert.Equal([]Broadcast{{NoticeId: "notice2"}}, broadcasts)
+}
+
+// staleKVAPI returns the values of stale from KVGet, as if another request changed them since.
+type staleKVAPI struct {
+	*kvAPI
+	stale map[string][]byte
+}
+
+func (a *staleKVAPI) KVGet(key string) ([]byte, *model.AppError) {
+	return a.stale[key], nil
+}
+
+func TestStoreConfirmDialogSubmission(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	s, _ := newTestStore()
+
+	confirmed, err := s.ConfirmDialogSubmission("user1", "digest1", time.Minute)
+	require.NoError(err)
+	assert.False(confirmed)
+	confirmed, err = s.ConfirmDialogSubmission("user1", "digest2", time.Minute)
+	require.NoError(err)
+	assert.False(confirmed)
+	confirmed, err = s.ConfirmDialogSubmission("user1", "digest2", time.Minute)
+	require.NoError(err)
+	assert.True(confirmed)
+
+	// A confirmation racing with another one of the same digest doesn't confirm it again.
+	api := &staleKVAPI{kvAPI: newKVAPI(), stale: map[string][]byte{dialogConfirmPrefix + "user1": []byte("digest1")}}
+	p := &Plugin{}
+	p.SetAPI(api)
+	_, err = NewStore(p).ConfirmDialogSubmission("user1", "digest1", time.Minute)
+	assert.Equal(ErrDialogAlreadyConfirmed, err)
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/mattermost/mattermost-plugin-starter-template/server/dateparse"
+)
+
+// storedTimeLayout is the format of Notice.StartTime and Notice.EndTime once the notice is
+// localized: an ISO 8601 time in UTC.
+const storedTimeLayout = time.RFC3339
+
+// userLocation returns the Mattermost timezone of the user, or the server timezone when the
+// user has none or can't be read.
+func (p *Plugin) userLocation(userId string) *time.Location {
+	user, appErr := p.API.GetUser(userId)
+	if appErr != nil {
+		return time.Local
+	}
+	return loadLocation(user.GetPreferredTimezone())
+}
+
+// loadLocation returns the IANA time zone with the name, falling back to the server timezone.
+func loadLocation(name string) *time.Location {
+	if name == "" {
+		return time.Local
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return time.Local
+	}
+	return loc
+}
+
+// location returns the timezone the notice times were entered in.
+func (n *Notice) location() *time.Location {
+	return loadLocation(n.TimeZone)
+}
+
+// localize parses the start and end time entered by a user in loc, and stores them in UTC
+// together with loc.
+func (n *Notice) localize(loc *time.Location) error {
+	start, err := parseNoticeTime(n.StartTime, loc)
+	if err != nil {
+		return errors.Wrap(err, "invalid start time")
+	}
+	end := start
+	if n.EndTime != "" {
+		if end, err = parseNoticeTime(n.EndTime, loc); err != nil {
+			return errors.Wrap(err, "invalid end time")
+		}
+	}
+	if end.Before(start) {
+		return errors.New("end time is before start time")
+	}
+
+	n.StartTime = start.UTC().Format(storedTimeLayout)
+	n.EndTime = end.UTC().Format(storedTimeLayout)
+	n.TimeZone = ""
+	if loc != time.Local {
+		n.TimeZone = loc.String()
+	}
+	return nil
+}
+
+// parseNoticeTime reads a time entered as noticeTimeLayout in loc, as an ISO 8601 time with its
+// own offset, or in words such as "tomorrow 9am" or "내일 오후 3시".
+func parseNoticeTime(value string, loc *time.Location) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if t, err := time.ParseInLocation(noticeTimeLayout, value, loc); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(storedTimeLayout, value); err == nil {
+		return t, nil
+	}
+	return dateparse.Parse(value, time.Now().In(loc))
+}
+
+// formatNoticeTime renders a time in the timezone of a viewer, e.g. "2021-11-05 09:00 KST".
+func formatNoticeTime(t time.Time, loc *time.Location) string {
+	return t.In(loc).Format(noticeTimeLayout + " MST")
+}
+
+// formatPeriod renders the start and end of the notice in loc.
+func (n *Notice) formatPeriod(loc *time.Location) (start, end string) {
+	startTime, endTime, err := n.period()
+	if err != nil {
+		return n.StartTime, n.EndTime
+	}
+	return formatNoticeTime(startTime, loc), formatNoticeTime(endTime, loc)
+}
+
+// resolvedTimes returns how the times of the notice typed in words, as in entered, were
+// understood, by create dialog field. Times typed as noticeTimeLayout are left out.
+func resolvedTimes(entered, notice Notice) map[string]string {
+	start, end := notice.formatPeriod(notice.location())
+
+	resolved := map[string]string{}
+	if !noticeTimeRegexp.MatchString(entered.StartTime) {
+		resolved["start_time"] = start
+	}
+	if entered.EndTime != entered.StartTime && !noticeTimeRegexp.MatchString(entered.EndTime) {
+		resolved["end_time"] = end
+	}
+	return resolved
+}
+
+// echoResolvedTimes tells the user how the times of the notice they typed in words, as in
+// entered, were understood, before the notice is posted.
+func (p *Plugin) echoResolvedTimes(userId, channelId string, entered, notice Notice) {
+	resolved := resolvedTimes(entered, notice)
+
+	var lines []string
+	if start, ok := resolved["start_time"]; ok {
+		lines = append(lines, "- `"+entered.StartTime+"` → "+start)
+	}
+	if end, ok := resolved["end_time"]; ok {
+		lines = append(lines, "- `"+entered.EndTime+"` → "+end)
+	}
+	if len(lines) == 0 {
+		return
+	}
+	p.postEphemeral(userId, channelId, ":calendar: Understood your dates as:\n"+strings.Join(lines, "\n"))
+}
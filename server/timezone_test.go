@@ -0,0 +1,85 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNoticeLocalize(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	seoul, err := time.LoadLocation("Asia/Seoul")
+	require.NoError(err)
+	newYork, err := time.LoadLocation("America/New_York")
+	require.NoError(err)
+
+	notice := &Notice{StartTime: "2021-11-05 09:00", EndTime: "2021-11-05 18:00"}
+	require.NoError(notice.localize(seoul))
+	assert.Equal("2021-11-05T00:00:00Z", notice.StartTime)
+	assert.Equal("2021-11-05T09:00:00Z", notice.EndTime)
+	assert.Equal("Asia/Seoul", notice.TimeZone)
+
+	start, end, err := notice.period()
+	require.NoError(err)
+	assert.Equal(seoul, start.Location())
+	assert.Equal("2021-11-05 09:00 KST", formatNoticeTime(start, seoul))
+	assert.Equal("2021-11-04 20:00 EDT", formatNoticeTime(start, newYork))
+	assert.Equal("2021-11-05 05:00 EDT", formatNoticeTime(end, newYork))
+
+	notice = &Notice{StartTime: "2021-11-05T09:00:00+09:00"}
+	require.NoError(notice.localize(newYork))
+	assert.Equal("2021-11-05T00:00:00Z", notice.StartTime)
+	assert.Equal(notice.StartTime, notice.EndTime)
+
+	notice = &Notice{StartTime: "tomorrow 9am", EndTime: "내일 오후 6시"}
+	require.NoError(notice.localize(seoul))
+	start, end, err = notice.period()
+	require.NoError(err)
+	assert.Equal(time.Now().In(seoul).AddDate(0, 0, 1).Format("2006-01-02")+" 09:00", start.Format(noticeTimeLayout))
+	assert.Equal(9*time.Hour, end.Sub(start))
+
+	assert.Error((&Notice{StartTime: "someday"}).localize(seoul))
+	assert.Error((&Notice{StartTime: "2021-11-05 09:00", EndTime: "2021-11-04 09:00"}).localize(seoul))
+}
+
+func TestUserLocation(t *testing.T) {
+	assert := assert.New(t)
+
+	api := newKVAPI()
+	api.On("GetUser", "user1").Return(&model.User{Timezone: map[string]string{
+		"useAutomaticTimezone": "false",
+		"manualTimezone":       "Asia/Seoul",
+	}}, nil)
+	api.On("GetUser", "user2").Return(nil, &model.AppError{Message: "not found"})
+
+	p := &Plugin{}
+	p.SetAPI(api)
+
+	assert.Equal("Asia/Seoul", p.userLocation("user1").String())
+	assert.Equal(time.Local, p.userLocation("user2"))
+}
+
+func TestStoreListsNoticesAcrossTimezones(t *testing.T) {
+	require := require.New(t)
+	s, _ := newTestStore()
+
+	// 2021-11-05 08:00 in Seoul is still November 4th in UTC.
+	notice := &Notice{ChannelId: "c", StartTime: "2021-11-05 08:00", EndTime: "2021-11-05 08:00"}
+	require.NoError(notice.localize(loadLocation("Asia/Seoul")))
+	require.NoError(s.CreateNotice(notice))
+
+	newYork := loadLocation("America/New_York")
+	from := time.Date(2021, 11, 4, 0, 0, 0, 0, newYork)
+	list, err := s.ListNoticesByDateRange(from, from.AddDate(0, 0, 1).Add(-time.Minute))
+	require.NoError(err)
+	require.Len(list, 1)
+
+	list, err = s.ListNoticesByDateRange(from.AddDate(0, 0, 1), from.AddDate(0, 0, 2))
+	require.NoError(err)
+	require.Empty(list)
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// maxNoticeMessageRunes keeps the notice post, its reminders and its calendar event readable.
+	maxNoticeMessageRunes = 4000
+	// maxNoticeFiles is the number of files a Mattermost post can have.
+	maxNoticeFiles = 5
+)
+
+// Codes of ValidationError, for clients that react to specific problems.
+const (
+	ValidationRequired          = "required"
+	ValidationInvalidDate       = "invalid_date"
+	ValidationPastDate          = "past_date"
+	ValidationEndBeforeStart    = "end_before_start"
+	ValidationTooLong           = "too_long"
+	ValidationInvalidReminders  = "invalid_reminders"
+	ValidationInvalidRecurrence = "invalid_recurrence"
+	ValidationInvalidPriority   = "invalid_priority"
+	ValidationChannelNotFound   = "channel_not_found"
+	ValidationChannelArchived   = "channel_archived"
+	ValidationTooManyFiles      = "too_many_files"
+	ValidationFileTooLarge      = "file_too_large"
+	ValidationForbidden         = "forbidden"
+)
+
+// ValidationError is a reason a notice can't be posted.
+type ValidationError struct {
+	// Field is the create dialog field the error is about, "channel_id" or "files", or empty
+	// when it is about the whole notice.
+	Field   string `json:"field,omitempty"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// ValidationErrors are all the reasons a notice can't be posted.
+type ValidationErrors []ValidationError
+
+func (e ValidationErrors) Error() string {
+	messages := make([]string, 0, len(e))
+	for _, err := range e {
+		if err.Field != "" {
+			messages = append(messages, err.Field+": "+err.Message)
+		} else {
+			messages = append(messages, err.Message)
+		}
+	}
+	return strings.Join(messages, "; ")
+}
+
+// Has tells whether one of the errors has the code.
+func (e ValidationErrors) Has(code string) bool {
+	for _, err := range e {
+		if err.Code == code {
+			return true
+		}
+	}
+	return false
+}
+
+// DialogErrors splits the errors into those shown next to a field of the create dialog, and a
+// message for the others.
+func (e ValidationErrors) DialogErrors() (fields map[string]string, general string) {
+	dialogFields := map[string]bool{}
+	for _, element := range getDialog().Elements {
+		dialogFields[element.Name] = true
+	}
+
+	fields = map[string]string{}
+	var messages []string
+	for _, err := range e {
+		if _, ok := fields[err.Field]; !ok && dialogFields[err.Field] {
+			fields[err.Field] = err.Message
+		} else {
+			messages = append(messages, err.Message)
+		}
+	}
+	return fields, strings.Join(messages, " ")
+}
+
+// asValidationErrors returns the validation errors in err, if it is made of them.
+func asValidationErrors(err error) (ValidationErrors, bool) {
+	var errs ValidationErrors
+	ok := errors.As(err, &errs)
+	return errs, ok
+}
+
+// noticeFile is a file to attach to a notice.
+type noticeFile struct {
+	Name string
+	Size int64
+}
+
+// noticeValidation is what a notice is checked against, besides its own fields.
+type noticeValidation struct {
+	// Location is the timezone the times of the notice were entered in. Nil means the Mattermost
+	// timezone of the author.
+	Location *time.Location
+	// Now is compared with the start of the notice, which must not have passed.
+	Now time.Time
+	// Previous is the notice being edited, if any. Its start may be kept even once it has passed.
+	Previous *Notice
+	// AllowPastStart accepts a start that has passed, such as the first occurrence of a recurring
+	// event imported from a calendar.
+	AllowPastStart bool
+	// Files are the files to attach to the notice.
+	Files []noticeFile
+}
+
+// validateNotice checks that the author of the notice may post it in its channel, and the
+// fields and files they entered. The notice is localized when it is valid.
+// The returned errors are nil when the notice is valid.
+func (p *Plugin) validateNotice(notice *Notice, v noticeValidation) ValidationErrors {
+	if errs := p.validateNoticeChannel(notice.UserId, notice.ChannelId); errs != nil {
+		return errs
+	}
+	if v.Location == nil {
+		v.Location = p.userLocation(notice.UserId)
+	}
+
+	errs := validateNoticeFields(notice, v)
+	if len(v.Files) > 0 {
+		errs = append(errs, validateNoticeFiles(v.Files, *p.API.GetConfig().FileSettings.MaxFileSize)...)
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+
+	if err := notice.localize(v.Location); err != nil {
+		return ValidationErrors{{Field: "start_time", Code: ValidationInvalidDate, Message: err.Error()}}
+	}
+	return nil
+}
+
+// validateNoticeChannel checks that the user may post notices in the channel, and that the
+// channel takes posts.
+func (p *Plugin) validateNoticeChannel(userId, channelId string) ValidationErrors {
+	if err := p.authorizeNoticeAuthor(userId, channelId); err != nil {
+		return ValidationErrors{{Code: ValidationForbidden, Message: "You can't post notices in this channel."}}
+	}
+	channel, appErr := p.API.GetChannel(channelId)
+	if appErr != nil {
+		return ValidationErrors{{Field: "channel_id", Code: ValidationChannelNotFound, Message: "The channel doesn't exist."}}
+	}
+	if channel.DeleteAt != 0 {
+		return ValidationErrors{{Field: "channel_id", Code: ValidationChannelArchived, Message: "The channel is archived."}}
+	}
+	return nil
+}
+
+// validateNoticeFields checks the fields of a notice as entered by a user.
+func validateNoticeFields(notice *Notice, v noticeValidation) ValidationErrors {
+	var errs ValidationErrors
+	add := func(field, code, message string) {
+		errs = append(errs, ValidationError{Field: field, Code: code, Message: message})
+	}
+
+	var start, end time.Time
+	var err error
+	startValid := false
+	if strings.TrimSpace(notice.StartTime) == "" {
+		add("start_time", ValidationRequired, "Enter when the notice starts.")
+	} else if start, err = parseNoticeTime(notice.StartTime, v.Location); err != nil {
+		add("start_time", ValidationInvalidDate, "Enter a date such as 2021-11-05 09:00 or tomorrow 9am.")
+	} else if start.Before(v.Now) && !v.AllowPastStart && !startsAt(v.Previous, start) {
+		add("start_time", ValidationPastDate, "The date is in the past.")
+	} else {
+		startValid = true
+	}
+
+	if notice.EndTime != "" && notice.EndTime != notice.StartTime {
+		if end, err = parseNoticeTime(notice.EndTime, v.Location); err != nil {
+			add("end_time", ValidationInvalidDate, "Enter a date such as 2021-11-05 18:00 or in 3 days.")
+		} else if startValid && end.Before(start) {
+			add("end_time", ValidationEndBeforeStart, "The end date is before the start.")
+		}
+	}
+
+	if err := validateNoticeMessage(notice.Message); err != nil {
+		errs = append(errs, *err)
+	}
+	if _, err := parseLeadTimes(notice.Reminders); err != nil {
+		add("reminders", ValidationInvalidReminders, "Use lead times such as 1d,1h,30m, 0m for the start, or none.")
+	}
+	if notice.Priority != "" && !isNoticePriority(notice.Priority) {
+		add("priority", ValidationInvalidPriority, "Choose a priority: low, normal, high or urgent.")
+	}
+	return errs
+}
+
+// validateNoticeMessage checks the content of a notice.
+func validateNoticeMessage(message string) *ValidationError {
+	if strings.TrimSpace(message) == "" {
+		return &ValidationError{Field: "content", Code: ValidationRequired, Message: "Write the content of the notice."}
+	}
+	if length := utf8.RuneCountInString(message); length > maxNoticeMessageRunes {
+		return &ValidationError{Field: "content", Code: ValidationTooLong,
+			Message: fmt.Sprintf("The content is %d characters long, over the limit of %d.", length, maxNoticeMessageRunes)}
+	}
+	return nil
+}
+
+// validateNoticeFiles checks the files to attach to a notice against the Mattermost limits.
+func validateNoticeFiles(files []noticeFile, maxFileSize int64) ValidationErrors {
+	var errs ValidationErrors
+	if len(files) > maxNoticeFiles {
+		errs = append(errs, ValidationError{Field: "files", Code: ValidationTooManyFiles,
+			Message: fmt.Sprintf("Attach at most %d files.", maxNoticeFiles)})
+	}
+	for _, file := range files {
+		if file.Size > maxFileSize {
+			errs = append(errs, ValidationError{Field: "files", Code: ValidationFileTooLarge,
+				Message: fmt.Sprintf("%s is larger than the limit of %d MB.", file.Name, maxFileSize>>20)})
+		}
+	}
+	return errs
+}
+
+// parseRecurrenceFields reads the repeat and skip dates fields of a notice.
+func parseRecurrenceFields(repeat, skipDates string) (*RecurrenceRule, error) {
+	if _, err := ParseRecurrenceRule(repeat, ""); err != nil {
+		return nil, ValidationErrors{{Field: "repeat", Code: ValidationInvalidRecurrence, Message: "Invalid rule: " + err.Error() + "."}}
+	}
+	recurrence, err := ParseRecurrenceRule(repeat, skipDates)
+	if err != nil {
+		return nil, ValidationErrors{{Field: "skip_dates", Code: ValidationInvalidRecurrence, Message: "Invalid dates: " + err.Error() + "."}}
+	}
+	return recurrence, nil
+}
+
+// startsAt tells whether notice exists and starts at t.
+func startsAt(notice *Notice, t time.Time) bool {
+	if notice == nil {
+		return false
+	}
+	start, _, err := notice.period()
+	return err == nil && start.Equal(t)
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateNoticeFields(t *testing.T) {
+	assert := assert.New(t)
+
+	seoul := loadLocation("Asia/Seoul")
+	v := noticeValidation{Location: seoul, Now: time.Date(2021, 11, 3, 14, 20, 0, 0, seoul)}
+
+	for name, tc := range map[string]struct {
+		notice Notice
+		codes  []string
+	}{
+		"valid":          {Notice{Message: "x", StartTime: "2021-11-05 09:00", EndTime: "2021-11-06 18:00", Reminders: "1h"}, nil},
+		"empty":          {Notice{}, []string{"start_time:required", "content:required"}},
+		"invalid start":  {Notice{Message: "x", StartTime: "someday"}, []string{"start_time:invalid_date"}},
+		"in the past":    {Notice{Message: "x", StartTime: "2021-11-03 09:00"}, []string{"start_time:past_date"}},
+		"end before":     {Notice{Message: "x", StartTime: "2021-11-05 09:00", EndTime: "2021-11-04 09:00"}, []string{"end_time:end_before_start"}},
+		"invalid end":    {Notice{Message: "x", StartTime: "2021-11-05 09:00", EndTime: "later"}, []string{"end_time:invalid_date"}},
+		"past, end fine": {Notice{Message: "x", StartTime: "2021-11-01 09:00", EndTime: "2021-11-02 09:00"}, []string{"start_time:past_date"}},
+		"blank content":  {Notice{Message: " \n", StartTime: "2021-11-05 09:00"}, []string{"content:required"}},
+		"long content":   {Notice{Message: strings.Repeat("공", maxNoticeMessageRunes+1), StartTime: "2021-11-05 09:00"}, []string{"content:too_long"}},
+		"bad reminders":  {Notice{Message: "x", StartTime: "2021-11-05 09:00", Reminders: "soon"}, []string{"reminders:invalid_reminders"}},
+		"bad priority":   {Notice{Message: "x", StartTime: "2021-11-05 09:00", Priority: "asap"}, []string{"priority:invalid_priority"}},
+	} {
+		var codes []string
+		for _, err := range validateNoticeFields(&tc.notice, v) {
+			codes = append(codes, err.Field+":"+err.Code)
+		}
+		assert.ElementsMatch(tc.codes, codes, name)
+	}
+	assert.Empty(validateNoticeFields(&Notice{Message: strings.Repeat("공", maxNoticeMessageRunes), StartTime: "2021-11-05 09:00"}, v))
+
+	// An edited notice may keep a start that has passed, but not move to another one.
+	v.Previous = &Notice{StartTime: "2021-11-01T00:00:00Z", TimeZone: "Asia/Seoul"}
+	assert.Empty(validateNoticeFields(&Notice{Message: "x", StartTime: "2021-11-01 09:00"}, v))
+	assert.True(validateNoticeFields(&Notice{Message: "x", StartTime: "2021-11-02 09:00"}, v).Has(ValidationPastDate))
+}
+
+func TestValidateNoticeFiles(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Empty(validateNoticeFiles([]noticeFile{{Name: "a.pdf", Size: 10 << 20}}, 10<<20))
+
+	errs := validateNoticeFiles([]noticeFile{{Name: "a.pdf", Size: 11 << 20}}, 10<<20)
+	assert.Equal(ValidationErrors{{Field: "files", Code: ValidationFileTooLarge, Message: "a.pdf is larger than the limit of 10 MB."}}, errs)
+
+	files := make([]noticeFile, maxNoticeFiles+1)
+	assert.True(validateNoticeFiles(files, 10<<20).Has(ValidationTooManyFiles))
+}
+
+func TestValidateNotice(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	api := newKVAPI()
+	api.On("GetChannelMember", "channel1", "user1").Return(&model.ChannelMember{}, nil)
+	api.On("GetChannelMember", "archived", "user1").Return(&model.ChannelMember{}, nil)
+	api.On("GetChannelMember", "channel2", "user1").Return(nil, &model.AppError{Message: "not found"})
+	api.On("HasPermissionToChannel", "user1", "channel1", model.PERMISSION_CREATE_POST).Return(true)
+	api.On("HasPermissionToChannel", "user1", "archived", model.PERMISSION_CREATE_POST).Return(true)
+	api.On("GetChannel", "channel1").Return(&model.Channel{Id: "channel1"}, nil)
+	api.On("GetChannel", "archived").Return(&model.Channel{Id: "archived", DeleteAt: 1}, nil)
+	api.On("GetConfig").Return(&model.Config{FileSettings: model.FileSettings{MaxFileSize: model.NewInt64(1 << 20)}})
+
+	p := &Plugin{}
+	p.SetAPI(api)
+
+	seoul := loadLocation("Asia/Seoul")
+	v := noticeValidation{Location: seoul, Now: time.Date(2021, 11, 3, 14, 20, 0, 0, seoul)}
+	newNotice := func(channelId string) *Notice {
+		return &Notice{UserId: "user1", ChannelId: channelId, Message: "x", StartTime: "2021-11-05 09:00", EndTime: "2021-11-05 09:00"}
+	}
+
+	notice := newNotice("channel1")
+	require.Nil(p.validateNotice(notice, v))
+	assert.Equal("2021-11-05T00:00:00Z", notice.StartTime)
+
+	assert.True(p.validateNotice(newNotice("channel2"), v).Has(ValidationForbidden))
+	assert.True(p.validateNotice(newNotice("archived"), v).Has(ValidationChannelArchived))
+
+	v.Files = []noticeFile{{Name: "big.zip", Size: 2 << 20}}
+	notice = newNotice("channel1")
+	assert.True(p.validateNotice(notice, v).Has(ValidationFileTooLarge))
+	assert.Equal("2021-11-05 09:00", notice.StartTime, "invalid notices are not localized")
+}
+
+func TestValidationErrors(t *testing.T) {
+	assert := assert.New(t)
+
+	errs := ValidationErrors{
+		{Field: "start_time", Code: ValidationPastDate, Message: "The date is in the past."},
+		{Field: "files", Code: ValidationTooManyFiles, Message: "Attach at most 5 files."},
+		{Code: ValidationForbidden, Message: "You can't post notices in this channel."},
+	}
+	assert.Equal("start_time: The date is in the past.; files: Attach at most 5 files.; You can't post notices in this channel.", errs.Error())
+
+	fields, general := errs.DialogErrors()
+	assert.Equal(map[string]string{"start_time": "The date is in the past."}, fields)
+	assert.Equal("Attach at most 5 files. You can't post notices in this channel.", general)
+}
+
+func TestParseRecurrenceFields(t *testing.T) {
+	assert := assert.New(t)
+
+	field := func(_ *RecurrenceRule, err error) string {
+		errs, _ := asValidationErrors(err)
+		if len(errs) == 0 {
+			return ""
+		}
+		return errs[0].Field
+	}
+	assert.Equal("repeat", field(parseRecurrenceFields("FREQ=HOURLY", "")))
+	assert.Equal("skip_dates", field(parseRecurrenceFields("weekly", "someday")))
+	assert.Equal("skip_dates", field(parseRecurrenceFields("", "2021-12-24")))
+
+	recurrence, err := parseRecurrenceFields("weekly", "2021-12-24")
+	assert.NoError(err)
+	assert.Equal([]string{"2021-12-24"}, recurrence.Exceptions)
+}
+
+func TestHandleDialogNoticeValidationErrors(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	api := newKVAPI()
+	api.On("GetUser", "user1").Return(&model.User{Id: "user1"}, nil)
+	api.On("GetChannelMember", "channel1", "user1").Return(&model.ChannelMember{}, nil)
+	api.On("HasPermissionToChannel", "user1", "channel1", model.PERMISSION_CREATE_POST).Return(true)
+	api.On("GetChannel", "channel1").Return(&model.Channel{Id: "channel1"}, nil)
+	api.On("GetChannelMember", "channel2", "user1").Return(nil, &model.AppError{Message: "not found"})
+
+	p := &Plugin{}
+	p.SetAPI(api)
+	p.store = NewStore(p)
+	p.router = p.initRouter()
+
+	submit := func(dialogForm DialogForm) *model.SubmitDialogResponse {
+		body, err := json.Marshal(dialogForm)
+		require.NoError(err)
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/mm", bytes.NewReader(body))
+		r.Header.Set("Mattermost-User-ID", "user1")
+		p.ServeHTTP(nil, w, r)
+		require.Equal(http.StatusOK, w.Result().StatusCode)
+		return model.SubmitDialogResponseFromJson(w.Body)
+	}
+
+	past := Sub{StartTime: "2000-01-01 09:00", EndTime: "1999-01-01 09:00", Content: " "}
+
+	response := submit(DialogForm{CallbackId: createNoticeCallbackId, UserId: "user1", ChannelId: "channel1", Submission: Sub{StartTime: "2000-01-01 09:00", Repeat: "FREQ=HOURLY"}})
+	require.NotNil(response)
+	assert.Contains(response.Errors, "repeat")
+
+	response = submit(DialogForm{CallbackId: createNoticeCallbackId, UserId: "user1", ChannelId: "channel1", Submission: past})
+	require.NotNil(response)
+	assert.Equal([]string{"content", "start_time"}, sortedKeys(response.Errors))
+	assert.Empty(response.Error)
+
+	response = submit(DialogForm{CallbackId: createNoticeCallbackId, UserId: "user1", ChannelId: "channel2", Submission: past})
+	require.NotNil(response)
+	assert.Empty(response.Errors)
+	assert.Equal("You can't post notices in this channel.", response.Error)
+
+	response = submit(DialogForm{UserId: "user1", ChannelId: "channel1", CallbackId: editNoticeCallbackId, State: encodeDialogState(editNoticeState{NoticeId: "missing"})})
+	require.NotNil(response)
+	assert.Equal("The notice you edited doesn't exist anymore.", response.Error)
+}
+
+func TestHandleFrontendNoticeValidationErrors(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	api := newKVAPI()
+	api.On("GetUser", "user1").Return(&model.User{Id: "user1"}, nil)
+	api.On("GetChannelMember", "channel1", "user1").Return(&model.ChannelMember{}, nil)
+	api.On("HasPermissionToChannel", "user1", "channel1", model.PERMISSION_CREATE_POST).Return(true)
+	api.On("GetChannel", "channel1").Return(&model.Channel{Id: "channel1"}, nil)
+
+	p := &Plugin{}
+	p.SetAPI(api)
+	p.router = p.initRouter()
+
+	w := httptest.NewRecorder()
+	p.ServeHTTP(nil, w, newNoticeRequest("user1", "user1", "channel1"))
+
+	require.Equal(http.StatusBadRequest, w.Result().StatusCode)
+	var response validationErrorResponse
+	require.NoError(json.NewDecoder(w.Body).Decode(&response))
+	assert.Equal("Invalid notice", response.Error)
+	require.Len(response.Errors, 1)
+	assert.Equal("start_time", response.Errors[0].Field)
+	assert.Equal(ValidationPastDate, response.Errors[0].Code)
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}